@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"api/store"
+)
+
+const (
+	// apiKeyPrefix starts every API key so that authenticate can tell keys
+	// from JWTs, and so that leaked keys are easy to search for.
+	apiKeyPrefix = "ak_"
+	// apiKeyPrefixLen is how much of a key is stored in clear to identify it.
+	apiKeyPrefixLen = len(apiKeyPrefix) + 8
+	// apiKeyTouchInterval limits how often last-used tracking writes.
+	apiKeyTouchInterval = time.Minute
+)
+
+// errAPIKeyInvalid is returned for unknown, expired and revoked API keys.
+var errAPIKeyInvalid = errors.New("invalid API key")
+
+// apiKeyBody is how API keys are read from and written to the admin API. The
+// key itself is only returned once, when it is created.
+type apiKeyBody struct {
+	ID         uint       `json:"id"`
+	Key        string     `json:"key,omitempty"`
+	UserID     uint       `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP string     `json:"last_used_ip"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+func newAPIKeyBody(key store.APIKey) apiKeyBody {
+	return apiKeyBody{
+		ID:         key.ID,
+		UserID:     key.UserID,
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		Scopes:     key.Scopes,
+		CreatedAt:  key.CreatedAt,
+		ExpiresAt:  key.ExpiresAt,
+		LastUsedAt: key.LastUsedAt,
+		LastUsedIP: key.LastUsedIP,
+		RevokedAt:  key.RevokedAt,
+	}
+}
+
+// apiKeyFrom returns the API key a request was made with, from either the
+// X-API-Key header or a bearer token that starts with apiKeyPrefix.
+func apiKeyFrom(r *http.Request) (string, bool) {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key, true
+	}
+	if token, ok := bearerToken(r); ok && strings.HasPrefix(token, apiKeyPrefix) {
+		return token, true
+	}
+	return "", false
+}
+
+// verifyAPIKey looks up an API key and its user, records the use and returns
+// them if the key is still valid and the account enabled.
+func (s *server) verifyAPIKey(ctx context.Context, r *http.Request, rawKey string) (*store.APIKey, *store.User, error) {
+	key, err := s.store.APIKeys.GetAPIKeyByHash(ctx, hashToken(rawKey))
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, nil, errAPIKeyInvalid
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	if key.RevokedAt != nil || now.After(key.ExpiresAt) {
+		return nil, nil, errAPIKeyInvalid
+	}
+
+	user, err := s.store.Users.GetUser(ctx, key.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if user.Disabled {
+		return nil, nil, errAPIKeyInvalid
+	}
+
+	err = s.store.APIKeys.TouchAPIKey(ctx, key.ID, s.clientIP(r), now, now.Add(-apiKeyTouchInterval))
+	if err != nil {
+		log.Printf("Failed to record use of API key %d: %v", key.ID, err)
+	}
+	return key, user, nil
+}
+
+func (s *server) createAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	p := principalFrom(r.Context())
+
+	userId, err := pathID(r, "userid")
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	var body struct {
+		Name      string     `json:"name"`
+		Scopes    []string   `json:"scopes"`
+		ExpiresAt *time.Time `json:"expires_at"` // Defaults to APIKeyTTL from now
+	}
+	err = json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if body.Name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	if len(body.Scopes) == 0 {
+		http.Error(w, "scopes must name at least one permission", http.StatusBadRequest)
+		return
+	}
+	if err := validatePermissions(body.Scopes); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(s.cfg.APIKeyTTL)
+	if body.ExpiresAt != nil {
+		expiresAt = *body.ExpiresAt
+	}
+	if !expiresAt.After(now) || expiresAt.After(now.Add(s.cfg.APIKeyMaxTTL)) {
+		http.Error(w, fmt.Sprintf("expires_at must be in the next %s", s.cfg.APIKeyMaxTTL), http.StatusBadRequest)
+		return
+	}
+
+	if _, err := s.store.Users.GetUser(r.Context(), userId); errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// A key can only carry permissions its user holds
+	permissions, err := s.store.Roles.GetUserPermissions(r.Context(), userId)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, scope := range body.Scopes {
+		if !slices.Contains(permissions, scope) {
+			http.Error(w, fmt.Sprintf("The user does not have permission %q", scope), http.StatusBadRequest)
+			return
+		}
+	}
+
+	secret, err := newOpaqueToken()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rawKey := apiKeyPrefix + secret
+	key := store.APIKey{
+		UserID:      userId,
+		Name:        body.Name,
+		Prefix:      rawKey[:apiKeyPrefixLen],
+		KeyHash:     hashToken(rawKey),
+		Scopes:      body.Scopes,
+		CreatedByID: &p.UserID,
+		ExpiresAt:   expiresAt,
+	}
+	if err := s.store.APIKeys.CreateAPIKey(r.Context(), &key); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := newAPIKeyBody(key)
+	response.Key = rawKey
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// listAPIKeysHandler lists the keys of the user in the path, or every key.
+func (s *server) listAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	var userId uint
+	if _, ok := mux.Vars(r)["userid"]; ok {
+		var err error
+		if userId, err = pathID(r, "userid"); err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	keys, err := s.store.APIKeys.ListAPIKeys(r.Context(), userId)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]apiKeyBody, len(keys))
+	for i, key := range keys {
+		response[i] = newAPIKeyBody(key)
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *server) revokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "keyid")
+	if err != nil {
+		http.Error(w, "Invalid API key ID", http.StatusBadRequest)
+		return
+	}
+
+	err = s.store.APIKeys.RevokeAPIKey(r.Context(), id)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "API key not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// createAPIKey has admin mint a key for userId and returns the raw key.
+func (ts *testServer) createAPIKey(admin string, userId uint, scopes ...string) string {
+	ts.t.Helper()
+	var key apiKeyBody
+	body := map[string]interface{}{"name": "sync", "scopes": scopes}
+	ts.request("POST", fmt.Sprintf("/admin/users/%d/api-keys", userId), admin, body, http.StatusCreated, &key)
+	return key.Key
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	ts := newTestServer(t, nil)
+	tom := ts.createUser("tom", "teacher")
+	ts.createUser("root", "admin")
+	admin := ts.login("root").Token
+
+	key := ts.createAPIKey(admin, tom.ID, PermTeacherSelf)
+
+	// In scope, as a bearer token or in X-API-Key
+	ts.request("GET", "/teacher/self", key, nil, http.StatusOK, nil)
+	req := httptest.NewRequest("GET", "/teacher/self", nil)
+	req.Header.Set("X-API-Key", key)
+	ts.do(req, http.StatusOK, nil)
+
+	// Held by the user but not granted to the key
+	ts.request("GET", "/teacher/claims", key, nil, http.StatusForbidden, nil)
+	// Routes without permissions manage the user's own session
+	ts.request("GET", "/mfa", key, nil, http.StatusForbidden, nil)
+	ts.request("POST", "/password/change", key, map[string]string{}, http.StatusForbidden, nil)
+}
+
+func TestAPIKeyScopesLimitedToUserPermissions(t *testing.T) {
+	ts := newTestServer(t, nil)
+	tom := ts.createUser("tom", "teacher")
+	ts.createUser("root", "admin")
+	admin := ts.login("root").Token
+
+	body := map[string]interface{}{"name": "sync", "scopes": []string{PermUsersManage}}
+	ts.request("POST", fmt.Sprintf("/admin/users/%d/api-keys", tom.ID), admin, body, http.StatusBadRequest, nil)
+	body = map[string]interface{}{"name": "sync", "scopes": []string{"nonsense"}}
+	ts.request("POST", fmt.Sprintf("/admin/users/%d/api-keys", tom.ID), admin, body, http.StatusBadRequest, nil)
+
+	// Scopes the user loses stop working on existing keys
+	key := ts.createAPIKey(admin, tom.ID, PermTeacherSelf)
+	ts.request("DELETE", fmt.Sprintf("/admin/users/%d/roles/teacher", tom.ID), admin, nil, http.StatusNoContent, nil)
+	ts.request("GET", "/teacher/self", key, nil, http.StatusForbidden, nil)
+}
+
+func TestAPIKeyRevoke(t *testing.T) {
+	ts := newTestServer(t, nil)
+	tom := ts.createUser("tom", "teacher")
+	ts.createUser("root", "admin")
+	admin := ts.login("root").Token
+
+	var key apiKeyBody
+	body := map[string]interface{}{"name": "sync", "scopes": []string{PermTeacherSelf}}
+	ts.request("POST", fmt.Sprintf("/admin/users/%d/api-keys", tom.ID), admin, body, http.StatusCreated, &key)
+	ts.request("GET", "/teacher/self", key.Key, nil, http.StatusOK, nil)
+
+	ts.request("DELETE", fmt.Sprintf("/admin/api-keys/%d", key.ID), admin, nil, http.StatusNoContent, nil)
+	ts.request("GET", "/teacher/self", key.Key, nil, http.StatusUnauthorized, nil)
+	ts.request("GET", "/teacher/self", "ak_unknown", nil, http.StatusUnauthorized, nil)
+}
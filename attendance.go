@@ -2,66 +2,499 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 
-	"gorm.io/gorm"
+	"api/store"
 )
 
-type Attendance struct {
-	gorm.Model
-	StudentId uint
-	Course    string
-	Period    string
-	Date      string
-	TeacherId string
-	IsPresent bool
-	IsApplied bool
-	IsClaimed bool
-}
-
-func createAttendanceHandler(w http.ResponseWriter, r *http.Request) {
-	// Parse and decode the request body into a new 'Attendance' instance
-	attendance := &Attendance{}
-	err := json.NewDecoder(r.Body).Decode(attendance)
+func (s *server) createAttendanceHandler(w http.ResponseWriter, r *http.Request) {
+	// Parse and decode the request body. Only these fields come from the
+	// client; the rest of the record, such as the teacher and whether a
+	// claim covers it, is the server's to set. They keep the names clients
+	// already send.
+	var body struct {
+		StudentId uint
+		SectionID uint
+		Date      store.Date
+		Period    string
+		Status    string
+		Reason    string
+		IsPresent *bool // Sent by clients that predate statuses
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	attendance := &store.Attendance{
+		StudentId: body.StudentId,
+		SectionID: body.SectionID,
+		Date:      body.Date,
+		Period:    body.Period,
+		Status:    body.Status,
+		Reason:    body.Reason,
+	}
+	if attendance.Status == "" && body.IsPresent != nil {
+		attendance.Status = store.AttendanceAbsent
+		if *body.IsPresent {
+			attendance.Status = store.AttendancePresent
+		}
+	}
+	if !s.checkMark(w, r, store.Mark{Status: attendance.Status, Reason: attendance.Reason}) {
+		return
+	}
+
+	// Attendance is taken for a class the timetable has, by someone
+	// allowed to take it
+	p := principalFrom(r.Context())
+	class, ok := s.authorizeClass(w, r, attendance.SectionID, attendance.Date, attendance.Period)
+	if !ok {
+		return
+	}
+	attendance.TeacherId = attendanceTeacher(p, class)
 
-	// Connect to the database
-	db, sqlDB, err := connectDB()
+	// Make sure the student exists
+	_, err = s.store.Students.GetStudent(r.Context(), attendance.StudentId)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Student not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
-		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	defer sqlDB.Close()
 
-	// Find the student
-	var student Student
-	result := db.Preload("Attendance").First(&student, attendance.StudentId)
-	if result.Error != nil {
-		http.Error(w, result.Error.Error(), http.StatusNotFound)
+	// Attendance is recorded for a section the student is enrolled in
+	enrolled, err := s.store.Courses.IsEnrolled(r.Context(), attendance.SectionID, attendance.StudentId)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !enrolled {
+		http.Error(w, "The student is not enrolled in the section", http.StatusBadRequest)
 		return
 	}
 
 	// Insert the new attendance into the database
-	result = db.Create(attendance)
-	if result.Error != nil {
-		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+	err = s.store.Attendance.CreateAttendance(r.Context(), attendance, p.UserID)
+	if errors.Is(err, store.ErrDuplicate) {
+		http.Error(w, "The student's attendance for the class is already recorded", http.StatusConflict)
+		return
+	}
+	if errors.Is(err, store.ErrConflict) {
+		http.Error(w, "The day was made a holiday or exam day meanwhile", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// Append the new attendance to the student's attendance slice
-	student.Attendance = append(student.Attendance, *attendance)
+	// Respond with the newly created attendance
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(attendance)
+}
 
-	// Save the student
-	result = db.Save(&student)
-	if result.Error != nil {
-		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+// updateAttendanceHandler changes the status and reason of an attendance
+// record. Holders of PermAttendanceWrite may change any record, even one
+// whose class is no longer in the timetable; others only the records they
+// took, of a class the timetable still has, within the edit window. Older
+// records are changed with a correction request instead.
+func (s *server) updateAttendanceHandler(w http.ResponseWriter, r *http.Request) {
+	attendance, ok := s.pathAttendance(w, r)
+	if !ok {
 		return
 	}
 
-	// Respond with the newly created attendance
+	var mark store.Mark
+	err := json.NewDecoder(r.Body).Decode(&mark)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !s.checkMark(w, r, mark) {
+		return
+	}
+
+	p := principalFrom(r.Context())
+	if !p.Can(PermAttendanceWrite) {
+		if !takenBy(p, attendance) {
+			http.Error(w, "You did not take this attendance", http.StatusForbidden)
+			return
+		}
+		if _, ok := s.findClass(w, r, attendance.SectionID, attendance.Date, attendance.Period); !ok {
+			return
+		}
+		if !s.withinEditWindow(attendance.Date) {
+			http.Error(w, "The class is too long ago to edit; request a correction instead", http.StatusForbidden)
+			return
+		}
+	}
+
+	err = s.store.Attendance.SetAttendanceStatus(r.Context(), attendance.ID, mark, p.UserID)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Attendance not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	attendance.Status, attendance.Reason = mark.Status, mark.Reason
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(attendance)
 }
+
+// checkMark makes sure the status is known and the reason, if any, is one
+// of the admins' reason codes. Otherwise it writes the error response and
+// returns false.
+func (s *server) checkMark(w http.ResponseWriter, r *http.Request, mark store.Mark) bool {
+	if !slices.Contains(store.AttendanceStatuses, mark.Status) {
+		http.Error(w, fmt.Sprintf("Status must be one of %s", strings.Join(store.AttendanceStatuses, ", ")), http.StatusBadRequest)
+		return false
+	}
+	if mark.Reason == "" {
+		return true
+	}
+	_, err := s.store.Attendance.GetReason(r.Context(), mark.Reason)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, fmt.Sprintf("Unknown reason code %q", mark.Reason), http.StatusBadRequest)
+		return false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// authorizeClass finds the class the section has in period on date, which
+// must be a day of the section's term with classes in the academic
+// calendar, and checks that the principal may take its attendance: anyone
+// holding PermAttendanceWrite may, others only if they teach it and the
+// class is within the edit window. Otherwise it writes the error response
+// and returns false.
+func (s *server) authorizeClass(w http.ResponseWriter, r *http.Request, sectionId uint, date store.Date, period string) (store.ScheduledClass, bool) {
+	class, ok := s.findClass(w, r, sectionId, date, period)
+	if !ok {
+		return store.ScheduledClass{}, false
+	}
+
+	p := principalFrom(r.Context())
+	if !p.Can(PermAttendanceWrite) {
+		if p.TeacherID == 0 || class.TeacherID == nil || *class.TeacherID != p.TeacherID {
+			http.Error(w, "You do not teach this class", http.StatusForbidden)
+			return store.ScheduledClass{}, false
+		}
+		if !s.withinEditWindow(date) {
+			http.Error(w, "The class is too long ago to edit; request a correction instead", http.StatusForbidden)
+			return store.ScheduledClass{}, false
+		}
+	}
+	return class, true
+}
+
+// findClass finds the class the section has in period on date, which must
+// be a day of the section's term with classes in the academic calendar. If
+// there is none it writes the error response and returns false.
+func (s *server) findClass(w http.ResponseWriter, r *http.Request, sectionId uint, date store.Date, period string) (store.ScheduledClass, bool) {
+	if date.IsZero() {
+		http.Error(w, "date is required", http.StatusBadRequest)
+		return store.ScheduledClass{}, false
+	}
+	classes, err := s.scheduledClasses(r.Context(), store.ClassFilter{SectionID: sectionId}, date, period)
+	var closed *closedDayError
+	if errors.As(err, &closed) {
+		http.Error(w, closed.Error(), http.StatusBadRequest)
+		return store.ScheduledClass{}, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return store.ScheduledClass{}, false
+	}
+	if len(classes) == 0 {
+		http.Error(w, "The section has no class in period "+period+" on "+date.String(), http.StatusBadRequest)
+		return store.ScheduledClass{}, false
+	}
+
+	// Sections only meet in their own term, if the calendar has it
+	class := classes[0]
+	term, err := s.store.Calendar.GetTermByName(r.Context(), class.Section.Term)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return store.ScheduledClass{}, false
+	}
+	if err == nil && !termContains(*term, date) {
+		http.Error(w, "The section's term "+term.Name+" runs from "+term.StartDate.String()+" to "+term.EndDate.String(), http.StatusBadRequest)
+		return store.ScheduledClass{}, false
+	}
+	return class, true
+}
+
+// withinEditWindow reports whether attendance taken on date may still be
+// edited without a correction request.
+func (s *server) withinEditWindow(date store.Date) bool {
+	return !date.Before(store.Today().AddDays(-s.cfg.EditWindowDays))
+}
+
+// attendanceTeacher is the teacher attendance for class is recorded
+// against: the teacher the timetable has for it, whoever takes it, or p
+// if the timetable names no teacher.
+func attendanceTeacher(p *Principal, class store.ScheduledClass) string {
+	if class.TeacherID != nil {
+		return store.TeacherKey(*class.TeacherID)
+	}
+	if p.TeacherID != 0 {
+		return store.TeacherKey(p.TeacherID)
+	}
+	return ""
+}
+
+// takenBy reports whether attendance was recorded against p, the teacher
+// who may then edit and correct it without PermAttendanceWrite.
+func takenBy(p *Principal, attendance *store.Attendance) bool {
+	return p.TeacherID != 0 && attendance.TeacherId == store.TeacherKey(p.TeacherID)
+}
+
+// rollCallHandler records the attendance of a whole class at once. The body
+// lists either the absent or the present students; everyone else enrolled
+// in the section gets the opposite. Marks give students any other status,
+// such as late, overriding the lists. Repeating a roll call is harmless: it
+// only updates records whose status or reason changed.
+func (s *server) rollCallHandler(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		SectionID uint       `json:"section_id"`
+		Date      store.Date `json:"date"`
+		Period    string     `json:"period"`
+		Absent    []uint     `json:"absent"`
+		Present   []uint     `json:"present"`
+		Marks     []struct {
+			StudentID uint   `json:"student_id"`
+			Status    string `json:"status"`
+			Reason    string `json:"reason"`
+		} `json:"marks"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if (body.Absent == nil) == (body.Present == nil) {
+		http.Error(w, "Give either absent or present", http.StatusBadRequest)
+		return
+	}
+
+	section, err := s.store.Courses.GetSection(r.Context(), body.SectionID)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Section not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	p := principalFrom(r.Context())
+	class, ok := s.authorizeClass(w, r, section.ID, body.Date, body.Period)
+	if !ok {
+		return
+	}
+
+	students, err := s.store.Courses.ListEnrolledStudents(r.Context(), section.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Everyone starts out with the opposite of the list they may be on
+	listed, listedStatus, otherStatus := body.Absent, store.AttendanceAbsent, store.AttendancePresent
+	if body.Present != nil {
+		listed, listedStatus, otherStatus = body.Present, store.AttendancePresent, store.AttendanceAbsent
+	}
+	rollCall := store.RollCall{
+		SectionID: section.ID,
+		Date:      body.Date,
+		Period:    body.Period,
+		TeacherID: attendanceTeacher(p, class),
+		Marks:     map[uint]store.Mark{},
+		ChangedBy: p.UserID,
+	}
+	for _, student := range students {
+		rollCall.Marks[student.ID] = store.Mark{Status: otherStatus}
+	}
+	var notEnrolled []uint
+	for _, studentId := range listed {
+		if _, ok := rollCall.Marks[studentId]; !ok {
+			notEnrolled = append(notEnrolled, studentId)
+			continue
+		}
+		rollCall.Marks[studentId] = store.Mark{Status: listedStatus}
+	}
+	for _, mark := range body.Marks {
+		if _, ok := rollCall.Marks[mark.StudentID]; !ok {
+			notEnrolled = append(notEnrolled, mark.StudentID)
+			continue
+		}
+		if !s.checkMark(w, r, store.Mark{Status: mark.Status, Reason: mark.Reason}) {
+			return
+		}
+		rollCall.Marks[mark.StudentID] = store.Mark{Status: mark.Status, Reason: mark.Reason}
+	}
+	if len(notEnrolled) > 0 {
+		http.Error(w, fmt.Sprintf("Students %v are not enrolled in the section", notEnrolled), http.StatusBadRequest)
+		return
+	}
+
+	results, err := s.store.Attendance.RecordRollCall(r.Context(), rollCall)
+	if errors.Is(err, store.ErrDuplicate) {
+		http.Error(w, "Attendance for the class was recorded at the same time; try again", http.StatusConflict)
+		return
+	}
+	if errors.Is(err, store.ErrConflict) {
+		http.Error(w, "The day was made a holiday or exam day meanwhile", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	type resultBody struct {
+		StudentID    uint   `json:"student_id"`
+		AttendanceID uint   `json:"attendance_id"`
+		Status       string `json:"status"`
+		Reason       string `json:"reason,omitempty"`
+		Outcome      string `json:"outcome"`
+	}
+	response := struct {
+		SectionID uint         `json:"section_id"`
+		Date      store.Date   `json:"date"`
+		Period    string       `json:"period"`
+		Results   []resultBody `json:"results"`
+	}{section.ID, body.Date, body.Period, make([]resultBody, len(results))}
+	for i, result := range results {
+		response.Results[i] = resultBody{result.StudentID, result.AttendanceID, result.Mark.Status, result.Mark.Reason, result.Outcome}
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// attendanceBody is how attendance records are listed.
+type attendanceBody struct {
+	ID        uint       `json:"id"`
+	StudentID uint       `json:"student_id"`
+	SectionID uint       `json:"section_id"`
+	Date      store.Date `json:"date"`
+	Period    string     `json:"period"`
+	TeacherID string     `json:"teacher_id"`
+	Status    string     `json:"status"`
+	Reason    string     `json:"reason"`
+	IsClaimed bool       `json:"is_claimed"`
+	IsApplied bool       `json:"is_applied"`
+}
+
+func newAttendanceBody(attendance store.Attendance) attendanceBody {
+	return attendanceBody{
+		ID:        attendance.ID,
+		StudentID: attendance.StudentId,
+		SectionID: attendance.SectionID,
+		Date:      attendance.Date,
+		Period:    attendance.Period,
+		TeacherID: attendance.TeacherId,
+		Status:    attendance.Status,
+		Reason:    attendance.Reason,
+		IsClaimed: attendance.IsClaimed,
+		IsApplied: attendance.IsApplied,
+	}
+}
+
+// listAttendanceHandler returns a page of attendance records in date order.
+// ?from= and ?to= bound the dates, inclusive, within ?term= if given;
+// ?course_id=, ?section_id=, ?student_id= and ?status= filter; ?page= and
+// ?per_page= page. Students only see their own records and teachers the
+// ones they took.
+func (s *server) listAttendanceHandler(w http.ResponseWriter, r *http.Request) {
+	page, err := pageParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := store.AttendanceFilter{
+		Status: query.Get("status"),
+		Offset: page.offset(),
+		Limit:  page.PerPage,
+	}
+	if filter.Status != "" && !slices.Contains(store.AttendanceStatuses, filter.Status) {
+		http.Error(w, fmt.Sprintf("Status must be one of %s", strings.Join(store.AttendanceStatuses, ", ")), http.StatusBadRequest)
+		return
+	}
+	for key, date := range map[string]*store.Date{"from": &filter.From, "to": &filter.To} {
+		if value := query.Get(key); value != "" {
+			if *date, err = store.ParseDate(value); err != nil {
+				http.Error(w, key+": "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+	term, ok := s.queryTerm(w, r)
+	if !ok {
+		return
+	}
+	if term != nil {
+		if filter.From.IsZero() || filter.From.Before(term.StartDate) {
+			filter.From = term.StartDate
+		}
+		if filter.To.IsZero() || filter.To.After(term.EndDate) {
+			filter.To = term.EndDate
+		}
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && filter.To.Before(filter.From) {
+		http.Error(w, "to must not be before from", http.StatusBadRequest)
+		return
+	}
+	for key, id := range map[string]*uint{"course_id": &filter.CourseID, "section_id": &filter.SectionID, "student_id": &filter.StudentID} {
+		if value := query.Get(key); value != "" {
+			n, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				http.Error(w, "Invalid "+key, http.StatusBadRequest)
+				return
+			}
+			*id = uint(n)
+		}
+	}
+
+	p := principalFrom(r.Context())
+	switch {
+	case p.Can(PermAttendanceWrite) || p.Can(PermAttendanceReview):
+	case p.Can(PermAttendanceMark) && p.TeacherID != 0:
+		filter.TeacherID = store.TeacherKey(p.TeacherID)
+	case p.Can(PermStudentSelf) && p.StudentID != 0:
+		filter.StudentID = p.StudentID
+	default:
+		http.Error(w, "You have no attendance to see", http.StatusForbidden)
+		return
+	}
+
+	records, total, err := s.store.Attendance.ListAttendance(r.Context(), filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := struct {
+		Attendance []attendanceBody `json:"attendance"`
+		pagination
+	}{Attendance: make([]attendanceBody, len(records)), pagination: page}
+	for i, record := range records {
+		response.Attendance[i] = newAttendanceBody(record)
+	}
+	response.Total = total
+	json.NewEncoder(w).Encode(response)
+}
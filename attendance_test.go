@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"api/store"
+)
+
+// classFixture is a section taught by a teacher with enrolled students and
+// a Monday class in period 01.
+type classFixture struct {
+	section  *store.Section
+	slot     *store.TimetableSlot
+	date     store.Date // The latest Monday
+	teacher  string     // Token of the section's teacher
+	other    string     // Token of a teacher of no section
+	admin    string
+	students []uint
+}
+
+func (ts *testServer) newClass() classFixture {
+	ts.t.Helper()
+	ctx := context.Background()
+	ts.createUser("tom", "teacher")
+	ts.createUser("ann", "teacher")
+	ts.createUser("root", "admin")
+	tom, err := ts.store.Teachers.GetTeacherByUsername(ctx, "tom")
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+
+	course := &store.Course{Code: "CS101", Name: "Programming"}
+	if err := ts.store.Courses.CreateCourse(ctx, course); err != nil {
+		ts.t.Fatal(err)
+	}
+	section := &store.Section{CourseID: course.ID, Name: "A", Term: "2026-odd", TeacherID: &tom.ID}
+	if err := ts.store.Courses.CreateSection(ctx, section); err != nil {
+		ts.t.Fatal(err)
+	}
+	period := &store.Period{Weekday: time.Monday, Name: "01", StartTime: "09:00", EndTime: "09:50"}
+	if err := ts.store.Timetable.CreatePeriod(ctx, period); err != nil {
+		ts.t.Fatal(err)
+	}
+	slot := &store.TimetableSlot{SectionID: section.ID, PeriodID: period.ID}
+	if err := ts.store.Timetable.CreateSlot(ctx, slot); err != nil {
+		ts.t.Fatal(err)
+	}
+
+	var students []uint
+	for _, username := range []string{"alice", "bob", "carol"} {
+		ts.createUser(username, "student")
+		student, err := ts.store.Students.GetStudentByUsername(ctx, username)
+		if err != nil {
+			ts.t.Fatal(err)
+		}
+		students = append(students, student.ID)
+	}
+	if err := ts.store.Courses.Enroll(ctx, section.ID, students); err != nil {
+		ts.t.Fatal(err)
+	}
+
+	day := time.Now()
+	for day.Weekday() != time.Monday {
+		day = day.AddDate(0, 0, -1)
+	}
+	return classFixture{
+		section:  section,
+		slot:     slot,
+		date:     store.DateOf(day),
+		teacher:  ts.login("tom").Token,
+		other:    ts.login("ann").Token,
+		admin:    ts.login("root").Token,
+		students: students,
+	}
+}
+
+type rollCallResult struct {
+	StudentID    uint   `json:"student_id"`
+	AttendanceID uint   `json:"attendance_id"`
+	Status       string `json:"status"`
+	Outcome      string `json:"outcome"`
+}
+
+// rollCall takes the class's attendance with absent students and returns
+// the outcome for each student.
+func (ts *testServer) rollCall(class classFixture, token string, absent ...uint) map[uint]rollCallResult {
+	ts.t.Helper()
+	body := map[string]interface{}{
+		"section_id": class.section.ID,
+		"date":       class.date.String(),
+		"period":     "01",
+		"absent":     append([]uint{}, absent...),
+	}
+	var response struct {
+		Results []rollCallResult `json:"results"`
+	}
+	ts.request("POST", "/attendance/roll-call", token, body, http.StatusOK, &response)
+	results := map[uint]rollCallResult{}
+	for _, result := range response.Results {
+		results[result.StudentID] = result
+	}
+	return results
+}
+
+func TestRollCallIsIdempotent(t *testing.T) {
+	ts := newTestServer(t, nil)
+	class := ts.newClass()
+	alice, bob := class.students[0], class.students[1]
+
+	first := ts.rollCall(class, class.admin, alice)
+	if len(first) != len(class.students) {
+		t.Fatalf("got %d results, want %d", len(first), len(class.students))
+	}
+	for _, id := range class.students {
+		if first[id].Outcome != "created" {
+			t.Errorf("student %d: got outcome %q, want created", id, first[id].Outcome)
+		}
+	}
+	if first[alice].Status != store.AttendanceAbsent || first[bob].Status != store.AttendancePresent {
+		t.Errorf("got statuses %q and %q", first[alice].Status, first[bob].Status)
+	}
+
+	again := ts.rollCall(class, class.admin, alice)
+	for _, id := range class.students {
+		if again[id].Outcome != "unchanged" || again[id].AttendanceID != first[id].AttendanceID {
+			t.Errorf("student %d: repeat gave %+v, first gave %+v", id, again[id], first[id])
+		}
+	}
+
+	changed := ts.rollCall(class, class.admin, bob)
+	if changed[alice].Outcome != "updated" || changed[bob].Outcome != "updated" || changed[class.students[2]].Outcome != "unchanged" {
+		t.Errorf("got %+v", changed)
+	}
+
+	records, err := ts.store.Attendance.ListAttendanceChanges(context.Background(), first[alice].AttendanceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Errorf("got %d changes for the absent-then-present record, want 2", len(records))
+	}
+}
+
+func TestRollCallNeedsPermission(t *testing.T) {
+	ts := newTestServer(t, nil)
+	class := ts.newClass()
+	body := map[string]interface{}{"section_id": class.section.ID, "date": class.date.String(), "period": "01", "absent": []uint{}}
+
+	ts.request("POST", "/attendance/roll-call", class.teacher, body, http.StatusOK, nil)
+	ts.request("POST", "/attendance/roll-call", class.other, body, http.StatusForbidden, nil)
+	ts.request("POST", "/attendance/roll-call", ts.login("alice").Token, body, http.StatusForbidden, nil)
+	ts.request("POST", "/attendance/roll-call", class.admin, map[string]interface{}{"section_id": class.section.ID, "date": class.date.String(), "period": "01"}, http.StatusBadRequest, nil)
+}
+
+func TestCreateAttendance(t *testing.T) {
+	ts := newTestServer(t, nil)
+	class := ts.newClass()
+	body := map[string]interface{}{
+		"StudentId": class.students[0],
+		"SectionID": class.section.ID,
+		"Date":      class.date.String(),
+		"Period":    "01",
+		"Status":    store.AttendanceAbsent,
+	}
+
+	var created store.Attendance
+	ts.request("POST", "/attendance/create", class.admin, body, http.StatusOK, &created)
+	if created.ID == 0 || created.Status != store.AttendanceAbsent {
+		t.Errorf("got %+v", created)
+	}
+
+	// One record per student and class, whichever way it is taken
+	ts.request("POST", "/attendance/create", class.admin, body, http.StatusConflict, nil)
+	if results := ts.rollCall(class, class.admin); results[class.students[0]].AttendanceID != created.ID {
+		t.Errorf("roll call gave %+v, want record %d", results[class.students[0]], created.ID)
+	}
+
+	body["StudentId"] = 9999
+	ts.request("POST", "/attendance/create", class.admin, body, http.StatusNotFound, nil)
+}
+
+func TestTeacherEditsAttendanceTheyTook(t *testing.T) {
+	ts := newTestServer(t, nil)
+	class := ts.newClass()
+	body := map[string]interface{}{
+		"StudentId": class.students[0],
+		"SectionID": class.section.ID,
+		"Date":      class.date.String(),
+		"Period":    "01",
+		"Status":    store.AttendancePresent,
+		"IsClaimed": true, // Not the client's to set
+		"TeacherId": "9999",
+	}
+
+	ts.request("POST", "/attendance/create", class.other, body, http.StatusForbidden, nil)
+	var taken store.Attendance
+	ts.request("POST", "/attendance/create", class.teacher, body, http.StatusOK, &taken)
+	if taken.IsClaimed || taken.TeacherId != store.TeacherKey(*class.section.TeacherID) {
+		t.Errorf("got %+v", taken)
+	}
+
+	// Records are the class teacher's even when someone else takes them
+	body["StudentId"] = class.students[1]
+	var byAdmin store.Attendance
+	ts.request("POST", "/attendance/create", class.admin, body, http.StatusOK, &byAdmin)
+	if byAdmin.TeacherId != taken.TeacherId {
+		t.Errorf("got teacher %q, want %q", byAdmin.TeacherId, taken.TeacherId)
+	}
+
+	absent := map[string]string{"Status": store.AttendanceAbsent}
+	for _, id := range []uint{taken.ID, byAdmin.ID} {
+		path := fmt.Sprintf("/attendance/%d", id)
+		ts.request("PUT", path, class.other, absent, http.StatusForbidden, nil)
+		ts.request("PUT", path, class.teacher, absent, http.StatusOK, nil)
+	}
+}
+
+func TestOldAttendanceNeedsCorrection(t *testing.T) {
+	ts := newTestServer(t, map[string]string{"ATTENDANCE_EDIT_WINDOW_DAYS": "0"})
+	class := ts.newClass()
+	class.date = class.date.AddDays(-7)
+	results := ts.rollCall(class, class.admin, class.students[0])
+	id := results[class.students[0]].AttendanceID
+
+	late := map[string]string{"Status": store.AttendanceLate}
+	ts.request("PUT", fmt.Sprintf("/attendance/%d", id), class.teacher, late, http.StatusForbidden, nil)
+
+	// Teachers ask to correct the records they may edit, and only those
+	correction := map[string]string{"status": store.AttendanceLate, "explanation": "Came in during the first minutes"}
+	path := fmt.Sprintf("/attendance/%d/corrections", id)
+	ts.request("POST", path, class.other, correction, http.StatusForbidden, nil)
+	var pending correctionBody
+	ts.request("POST", path, class.teacher, correction, http.StatusCreated, &pending)
+	if pending.State != store.CorrectionPending {
+		t.Errorf("got state %q, want %q", pending.State, store.CorrectionPending)
+	}
+}
+
+func TestHolidaysAndAttendanceExcludeEachOther(t *testing.T) {
+	ts := newTestServer(t, nil)
+	class := ts.newClass()
+	ts.rollCall(class, class.teacher)
+
+	holiday := map[string]string{"kind": store.EventHoliday, "name": "Founders' day", "start_date": class.date.String()}
+	ts.request("POST", "/admin/calendar-events", class.admin, holiday, http.StatusConflict, nil)
+
+	// A day closed while its attendance is being taken gets no records
+	nextWeek := class.date.AddDays(7)
+	holiday["start_date"] = nextWeek.String()
+	ts.request("POST", "/admin/calendar-events", class.admin, holiday, http.StatusCreated, nil)
+	err := ts.store.Attendance.CreateAttendance(context.Background(), &store.Attendance{
+		StudentId: class.students[0],
+		SectionID: class.section.ID,
+		Date:      nextWeek,
+		Period:    "01",
+		Status:    store.AttendancePresent,
+	}, 1)
+	if !errors.Is(err, store.ErrConflict) {
+		t.Errorf("got %v, want ErrConflict", err)
+	}
+}
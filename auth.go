@@ -3,7 +3,6 @@ package main
 import (
 	"encoding/json"
 	"errors"
-	"fmt"
 	"log"
 	"net/http"
 	"strings"
@@ -12,30 +11,39 @@ import (
 	"github.com/dgrijalva/jwt-go"
 	_ "github.com/lib/pq"
 	"golang.org/x/crypto/bcrypt"
-	"gorm.io/gorm"
+
+	"api/store"
 )
 
 type Credentials struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
-	UserType string `json:"usertype"`
 }
 
 type CustomClaims struct {
-	Username string `json:"username"`
-	UserType string `json:"usertype"`
+	Username  string `json:"username"`
+	UserType  string `json:"usertype"`
+	SessionID string `json:"sid,omitempty"` // Refresh token family the token was issued for
+
+	// Set on impersonation tokens: the admin acting as the subject
+	Actor *ActorClaim `json:"act,omitempty"`
 	jwt.StandardClaims
 }
 
-// Replace this with your secret key
-var jwtKey = []byte("your_secret_key")
+// ActorClaim identifies the admin behind an impersonation token, after the
+// "act" claim of RFC 8693.
+type ActorClaim struct {
+	Subject         string `json:"sub"`
+	Username        string `json:"username"`
+	ImpersonationID uint   `json:"imp"`
+}
 
 func hashPassword(password string) (string, error) {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
 	return string(bytes), err
 }
 
-func loginHandler(w http.ResponseWriter, r *http.Request) {
+func (s *server) loginHandler(w http.ResponseWriter, r *http.Request) {
 	var creds Credentials
 	err := json.NewDecoder(r.Body).Decode(&creds)
 	if err != nil {
@@ -43,92 +51,179 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	db, sqlDB, err := connectDB()
+	attempt := &store.LoginEvent{
+		Username:  creds.Username,
+		IP:        s.clientIP(r),
+		UserAgent: r.UserAgent(),
+	}
+
+	// Clients that keep failing are blocked for a while, whatever account
+	// they try
+	ipFailures, err := s.store.Logins.CountFailedLogins(r.Context(), attempt.IP, time.Now().Add(-s.cfg.Login.IPWindow))
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if ipFailures >= int64(s.cfg.Login.IPMaxFailures) {
+		s.recordLogin(r.Context(), attempt, "ip_blocked")
+		tooManyAttempts(w, s.cfg.Login.IPWindow)
+		return
 	}
-	defer sqlDB.Close()
 
 	// Look up the stored credentials
-	var user User
-	result := db.Where("username = ?", creds.Username).First(&user)
-	if result.Error != nil {
-		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+	user, err := s.store.Users.GetUserByUsername(r.Context(), creds.Username)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			s.loginDelay(r.Context(), int(ipFailures))
+			s.recordLogin(r.Context(), attempt, "unknown_user")
 			w.WriteHeader(http.StatusUnauthorized)
 			return
 		}
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	attempt.UserID = &user.ID
+
+	if user.LockedUntil != nil && time.Now().Before(*user.LockedUntil) {
+		s.recordLogin(r.Context(), attempt, "locked")
+		tooManyAttempts(w, time.Until(*user.LockedUntil))
+		return
+	}
+	s.loginDelay(r.Context(), max(user.FailedLogins, int(ipFailures)))
 
 	// Compare the provided password with the stored hashed password
 	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(creds.Password))
 	if err != nil {
 		// Password does not match
-		log.Println(err)
+		_, err = s.store.Users.RecordLoginFailure(r.Context(), user.ID, s.cfg.Login.MaxFailures, s.cfg.Login.Lockout)
+		if err != nil {
+			log.Printf("Failed to record login failure for %s: %v", user.Username, err)
+		}
+		s.recordLogin(r.Context(), attempt, "bad_password")
 		w.WriteHeader(http.StatusUnauthorized)
 		return
 	}
 
-	// Set up custom claims including UserType from the database
-	claims := &CustomClaims{
-		Username: creds.Username,
-		UserType: user.UserType, // Use the UserType from the User model
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(24 * time.Hour).Unix(), // Token expires in 24 hours
-			Issuer:    "attendance-api-go",                   // Replace with your app name
-		},
+	// Disabled accounts keep their password but cannot log in
+	if user.Disabled {
+		s.recordLogin(r.Context(), attempt, "disabled")
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	// Accounts with two-factor authentication finish logging in at /login/mfa
+	if user.TOTPEnabled {
+		s.mfaChallenge(w, r, user)
+		return
 	}
 
-	// Create the token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	s.completeLogin(w, r, user, attempt)
+}
+
+// completeLogin starts a session for a user who passed every login check.
+func (s *server) completeLogin(w http.ResponseWriter, r *http.Request, user *store.User, attempt *store.LoginEvent) {
+	if user.FailedLogins > 0 || user.LockedUntil != nil {
+		if err := s.store.Users.ClearLoginFailures(r.Context(), user.ID); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
 
-	// Sign the token with your secret key
-	tokenString, err := token.SignedString(jwtKey)
+	// Issue a short-lived access token and start a new refresh token session
+	tokens, err := s.issueTokens(r.Context(), user, "")
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	s.recordLogin(r.Context(), attempt, "")
 
-	// Send the token in the response
+	// Send the tokens in the response
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"token": tokenString,
-	})
+	json.NewEncoder(w).Encode(tokens)
 }
 
-func registerHandler(w http.ResponseWriter, r *http.Request) {
-	var creds Credentials
-	err := json.NewDecoder(r.Body).Decode(&creds)
-	if err != nil {
+// Registration is the body of /register. Only students can sign up
+// themselves; staff accounts are created through invitations.
+type Registration struct {
+	Username       string `json:"username"`
+	Password       string `json:"password"`
+	UserType       string `json:"usertype"`
+	Name           string `json:"name"`
+	Email          string `json:"email"`
+	RegisterNumber string `json:"register_number"`
+}
+
+func (s *server) registerHandler(w http.ResponseWriter, r *http.Request) {
+	var reg Registration
+	err := json.NewDecoder(r.Body).Decode(&reg)
+	if err != nil || reg.Username == "" || reg.Password == "" {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
-	// Hash the password before storing it
-	hashedPassword, err := hashPassword(creds.Password)
-	if err != nil {
+	// Teacher, IPM and admin accounts need an invitation
+	if reg.UserType != "" && reg.UserType != "student" {
+		http.Error(w, "Only students can register; staff accounts need an invitation", http.StatusForbidden)
+		return
+	}
+	if reg.RegisterNumber == "" {
+		http.Error(w, "register_number is required", http.StatusBadRequest)
+		return
+	}
+	if !s.allowedEmail(reg.Email) {
+		http.Error(w, "Email domain is not allowed to register", http.StatusForbidden)
+		return
+	}
+	if s.cfg.RegisterNumberAllowlist != nil && !s.cfg.RegisterNumberAllowlist[reg.RegisterNumber] {
+		http.Error(w, "Register number is not allowed to register", http.StatusForbidden)
+		return
+	}
+
+	// A register number belongs to one account
+	_, err = s.store.Students.GetStudentByRegisterNumber(r.Context(), reg.RegisterNumber)
+	if err == nil {
+		http.Error(w, "Register number is already registered", http.StatusConflict)
+		return
+	}
+	if !errors.Is(err, store.ErrNotFound) {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	// Create a new user instance
-	newUser := User{
-		Username: creds.Username,
-		Password: hashedPassword,
-		UserType: creds.UserType,
+	role, err := s.store.Roles.GetRoleByName(r.Context(), "student")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
 
-	// Connect to the database
-	db, sqlDB, err := connectDB()
+	// Hash the password before storing it
+	hashedPassword, err := hashPassword(reg.Password)
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
-	defer sqlDB.Close()
 
-	// Save the new user to the database
-	result := db.Create(&newUser)
-	if result.Error != nil {
+	// Create the user together with its student profile
+	err = s.store.Users.CreateAccount(r.Context(), &store.NewAccount{
+		User: &store.User{
+			Username: reg.Username,
+			Password: hashedPassword,
+			UserType: role.Name,
+			Email:    reg.Email,
+		},
+		RoleID: role.ID,
+		Student: &store.Student{
+			Username:       reg.Username,
+			Name:           reg.Name,
+			RegisterNumber: reg.RegisterNumber,
+			Email:          reg.Email,
+		},
+	})
+	if errors.Is(err, store.ErrDuplicate) {
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -139,55 +234,20 @@ func registerHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func authorizeRole(role string) func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Skip token verification for the login route
-			if r.URL.Path == "/login" || r.URL.Path == "/register" {
-				next.ServeHTTP(w, r)
-				return
-			}
-			// Extract JWT token from the request
-			authHeader := r.Header.Get("Authorization")
-			splitHeader := strings.Split(authHeader, "Bearer ")
-			if len(splitHeader) < 2 {
-				w.WriteHeader(http.StatusUnauthorized)
-				return
-			}
-			tokenString := splitHeader[1]
-
-			claims := &CustomClaims{}
-			token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-				return jwtKey, nil
-			})
-
-			if err != nil || !token.Valid || claims.UserType != role {
-				w.WriteHeader(http.StatusUnauthorized)
-				return
-			}
-
-			// User is authorized, proceed to the next handler
-			next.ServeHTTP(w, r)
-		})
+// allowedEmail reports whether email is in one of the configured
+// registration domains. Any email is allowed when none are configured.
+func (s *server) allowedEmail(email string) bool {
+	if len(s.cfg.RegistrationEmailDomains) == 0 {
+		return true
 	}
-}
-
-// getUsernameFromJWT extracts the username from the JWT in the request's Authorization header.
-func getUsernameFromJWT(r *http.Request) (string, error) {
-	authHeader := r.Header.Get("Authorization")
-	tokenString := strings.Split(authHeader, "Bearer ")[1]
-
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	_, domain, ok := strings.Cut(email, "@")
+	if !ok {
+		return false
+	}
+	for _, allowed := range s.cfg.RegistrationEmailDomains {
+		if strings.EqualFold(domain, allowed) {
+			return true
 		}
-		return []byte("your_secret_key"), nil
-	})
-
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		username := claims["username"].(string)
-		return username, nil
-	} else {
-		return "", err
 	}
+	return false
 }
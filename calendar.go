@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	"api/store"
+)
+
+// closedDayError is returned for days the academic calendar holds no
+// classes on.
+type closedDayError struct {
+	date   store.Date
+	reason string
+}
+
+func (e *closedDayError) Error() string {
+	return "There are no classes on " + e.date.String() + ", " + e.reason
+}
+
+// calendarWeekday returns the weekday whose timetable is followed on date:
+// its own, or another on special working days. There are no classes, and
+// it returns a *closedDayError, outside the terms once any are set up, on
+// holidays and during exams.
+func (s *server) calendarWeekday(ctx context.Context, date store.Date) (time.Weekday, error) {
+	terms, err := s.store.Calendar.ListTerms(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if len(terms) > 0 && !slices.ContainsFunc(terms, func(term store.Term) bool { return termContains(term, date) }) {
+		return 0, &closedDayError{date, "outside every term"}
+	}
+
+	events, err := s.store.Calendar.ListEvents(ctx, date, date)
+	if err != nil {
+		return 0, err
+	}
+	weekday := date.Weekday()
+	for _, event := range events {
+		switch event.Kind {
+		case store.EventHoliday:
+			return 0, &closedDayError{date, "a holiday (" + event.Name + ")"}
+		case store.EventExams:
+			return 0, &closedDayError{date, "in exams (" + event.Name + ")"}
+		case store.EventWorkingDay:
+			weekday = *event.Weekday
+		}
+	}
+	return weekday, nil
+}
+
+func termContains(term store.Term, date store.Date) bool {
+	return !date.Before(term.StartDate) && !date.After(term.EndDate)
+}
+
+// queryTerm loads the term named by ?term=, if any. If it cannot, it writes
+// the error response and returns false.
+func (s *server) queryTerm(w http.ResponseWriter, r *http.Request) (*store.Term, bool) {
+	name := r.URL.Query().Get("term")
+	if name == "" {
+		return nil, true
+	}
+	term, err := s.store.Calendar.GetTermByName(r.Context(), name)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Term not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	return term, true
+}
+
+type termBody struct {
+	ID        uint       `json:"id"`
+	Name      string     `json:"name"`
+	StartDate store.Date `json:"start_date"`
+	EndDate   store.Date `json:"end_date"`
+}
+
+func newTermBody(term store.Term) termBody {
+	return termBody{term.ID, term.Name, term.StartDate, term.EndDate}
+}
+
+func (s *server) listTermsHandler(w http.ResponseWriter, r *http.Request) {
+	terms, err := s.store.Calendar.ListTerms(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]termBody, len(terms))
+	for i, term := range terms {
+		response[i] = newTermBody(term)
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *server) createTermHandler(w http.ResponseWriter, r *http.Request) {
+	var body termBody
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if body.Name == "" || body.StartDate.IsZero() || body.EndDate.IsZero() {
+		http.Error(w, "name, start_date and end_date are required", http.StatusBadRequest)
+		return
+	}
+	if body.EndDate.Before(body.StartDate) {
+		http.Error(w, "end_date must not be before start_date", http.StatusBadRequest)
+		return
+	}
+
+	term := store.Term{Name: body.Name, StartDate: body.StartDate, EndDate: body.EndDate}
+	err = s.store.Calendar.CreateTerm(r.Context(), &term)
+	if errors.Is(err, store.ErrDuplicate) {
+		http.Error(w, "Term name is already taken", http.StatusConflict)
+		return
+	}
+	if errors.Is(err, store.ErrConflict) {
+		http.Error(w, "The term overlaps another", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newTermBody(term))
+}
+
+func (s *server) deleteTermHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "termid")
+	if err != nil {
+		http.Error(w, "Invalid term ID", http.StatusBadRequest)
+		return
+	}
+	err = s.store.Calendar.DeleteTerm(r.Context(), id)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Term not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type eventBody struct {
+	ID        uint       `json:"id"`
+	Kind      string     `json:"kind"`
+	Name      string     `json:"name"`
+	StartDate store.Date `json:"start_date"`
+	EndDate   store.Date `json:"end_date"`
+	Weekday   string     `json:"weekday,omitempty"` // Working days only
+}
+
+func newEventBody(event store.CalendarEvent) eventBody {
+	body := eventBody{
+		ID:        event.ID,
+		Kind:      event.Kind,
+		Name:      event.Name,
+		StartDate: event.StartDate,
+		EndDate:   event.EndDate,
+	}
+	if event.Weekday != nil {
+		body.Weekday = weekdayName(*event.Weekday)
+	}
+	return body
+}
+
+// listEventsHandler lists the calendar events on any day from ?from= to
+// ?to=, by default every event.
+func (s *server) listEventsHandler(w http.ResponseWriter, r *http.Request) {
+	from, to := store.Date{Year: 1, Month: time.January, Day: 1}, store.Date{Year: 9999, Month: time.December, Day: 31}
+	var err error
+	if value := r.URL.Query().Get("from"); value != "" {
+		if from, err = store.ParseDate(value); err != nil {
+			http.Error(w, "from: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if value := r.URL.Query().Get("to"); value != "" {
+		if to, err = store.ParseDate(value); err != nil {
+			http.Error(w, "to: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	events, err := s.store.Calendar.ListEvents(r.Context(), from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]eventBody, len(events))
+	for i, event := range events {
+		response[i] = newEventBody(event)
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// createEventHandler adds a holiday, exams or a special working day to the
+// calendar. One-day events may leave out end_date. Holidays and exams
+// cannot be put on days that already have attendance.
+func (s *server) createEventHandler(w http.ResponseWriter, r *http.Request) {
+	var body eventBody
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !slices.Contains(store.CalendarEventKinds, body.Kind) {
+		http.Error(w, "kind must be holiday, exams or working_day", http.StatusBadRequest)
+		return
+	}
+	if body.Name == "" || body.StartDate.IsZero() {
+		http.Error(w, "name and start_date are required", http.StatusBadRequest)
+		return
+	}
+	if body.EndDate.IsZero() {
+		body.EndDate = body.StartDate
+	}
+	if body.EndDate.Before(body.StartDate) {
+		http.Error(w, "end_date must not be before start_date", http.StatusBadRequest)
+		return
+	}
+
+	event := store.CalendarEvent{Kind: body.Kind, Name: body.Name, StartDate: body.StartDate, EndDate: body.EndDate}
+	if body.Kind == store.EventWorkingDay {
+		weekday, err := parseWeekday(body.Weekday)
+		if err != nil {
+			http.Error(w, "Working days need the weekday whose timetable they follow: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		event.Weekday = &weekday
+	} else if body.Weekday != "" {
+		http.Error(w, "Only working days have a weekday", http.StatusBadRequest)
+		return
+	}
+
+	err = s.store.Calendar.CreateEvent(r.Context(), &event)
+	if errors.Is(err, store.ErrConflict) {
+		http.Error(w, "Attendance is recorded on those days", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newEventBody(event))
+}
+
+func (s *server) deleteEventHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "eventid")
+	if err != nil {
+		http.Error(w, "Invalid event ID", http.StatusBadRequest)
+		return
+	}
+	err = s.store.Calendar.DeleteEvent(r.Context(), id)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Event not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
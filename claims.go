@@ -2,70 +2,34 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gorilla/mux"
-	"gorm.io/gorm"
-)
-
-type File struct {
-	gorm.Model
-	Name           string
-	Path           string
-	MedicalClaimID uint
-}
-type MedicalClaim struct {
-	gorm.Model
-	StudentId    uint
-	Student      Student `gorm:"foreignKey:StudentId"`
-	Reason       string
-	Description  string
-	Status       string        `gorm:"default:Pending"`
-	Message      string        `gorm:"default:''"`
-	ClaimReviews []ClaimReview `gorm:"foreignKey:ClaimId"`
-	Files        []File        `gorm:"foreignKey:MedicalClaimID"`
-}
 
-type ClaimReview struct {
-	gorm.Model
-	ClaimId      uint         // Foreign key to the MedicalClaim
-	MedicalClaim MedicalClaim `gorm:"foreignKey:ClaimId"`
-	AttendanceId uint         // Foreign key to the Attendance
-	Attendance   Attendance   `gorm:"foreignKey:AttendanceId"`
-	TeacherId    string       // Foreign key to the Teacher
-	Teacher      Teacher      `gorm:"foreignKey:TeacherId"`
-	Status       string       `gorm:"default:Pending"`
-	Message      string       // Optional message left by the teacher
-}
+	"api/store"
+)
 
 type RequestBody struct {
-	Reason      string   `json:"reason"`
-	Description string   `json:"description"`
-	Data        []string `json:"data"`
+	Reason      string       `json:"reason"`
+	Description string       `json:"description"`
+	Data        []string     `json:"data"`
+	Classes     []claimClass `json:"classes"`
 	Date        []string
 	Period      []string
 	Files       []string `json:"files"`
 	FileNames   []string `json:"filenames"`
 }
 
-func getAttendanceRecords(date string, period string, studentId uint) ([]Attendance, error) {
-	db, sqlDB, err := connectDB()
-	if err != nil {
-		return nil, err
-	}
-	defer sqlDB.Close()
-
-	var records []Attendance
-	result := db.Where("date = ? AND period = ? AND student_id = ?", date, period, studentId).Find(&records)
-	if result.Error != nil {
-		return nil, result.Error
-	}
-
-	return records, nil
+// claimClass is a class a medical claim is filed for.
+type claimClass struct {
+	Date   store.Date `json:"date"`
+	Period string     `json:"period"`
 }
 
-func createMedicalClaim(w http.ResponseWriter, r *http.Request) {
+func (s *server) createMedicalClaim(w http.ResponseWriter, r *http.Request) {
 	var requestBody RequestBody
 	err := json.NewDecoder(r.Body).Decode(&requestBody)
 	if err != nil {
@@ -74,92 +38,101 @@ func createMedicalClaim(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Set Reason and Description
-	var medicalClaim MedicalClaim
+	var medicalClaim store.MedicalClaim
 	medicalClaim.Reason = requestBody.Reason
 	medicalClaim.Description = requestBody.Description
 
-	// Extract the username from JWT claims
-	username, err := getUsernameFromJWT(r)
-	if err != nil {
-		http.Error(w, "Failed to get username from JWT", http.StatusInternalServerError)
-		return
-	}
-
-	// Connect to the database
-	db, sqlDB, err := connectDB()
-	if err != nil {
-		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
-		return
-	}
-	defer sqlDB.Close()
+	p := principalFrom(r.Context())
 
-	// Get studentid from username
-	var student Student
-	result := db.Preload("Attendance").Where("username = ?", username).First(&student)
-	if result.Error != nil {
+	// Claims are filed against the caller's own student profile
+	if p.StudentID == 0 {
 		http.Error(w, "Student not found", http.StatusNotFound)
 		return
 	}
 
-	medicalClaim.StudentId = student.ID
+	medicalClaim.StudentId = p.StudentID
 
-	// Save medicalClaim to the database
-	result = db.Create(&medicalClaim)
-	if result.Error != nil {
-		http.Error(w, "Failed to save medical claim", http.StatusInternalServerError)
+	// Attach the uploaded files to the claim
+	if len(requestBody.Files) != len(requestBody.FileNames) {
+		http.Error(w, "files and filenames must have the same length", http.StatusBadRequest)
 		return
 	}
+	for i, file := range requestBody.Files {
+		medicalClaim.Files = append(medicalClaim.Files, store.File{
+			Path: file,
+			Name: requestBody.FileNames[i],
+		})
+	}
 
-	if len(requestBody.Files) > 0 {
-		for i, file := range requestBody.Files {
-			fileRecord := File{
-				Path:           file,
-				Name:           requestBody.FileNames[i],
-				MedicalClaimID: medicalClaim.ID, // Link the file to the medical claim
-			}
-
-			result := db.Create(&fileRecord)
-			if result.Error != nil {
-				http.Error(w, "Failed to save file record", http.StatusInternalServerError)
-				return
-			}
+	// The classes the claim covers, also accepted in the older form of
+	// "date-period" entries, e.g. 2026-10-19-01
+	classes := requestBody.Classes
+	for _, dp := range requestBody.Data {
+		sep := strings.LastIndex(dp, "-")
+		if sep < 0 {
+			http.Error(w, "data entries must be date-period", http.StatusBadRequest)
+			return
 		}
+		date, err := store.ParseDate(dp[:sep])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		classes = append(classes, claimClass{Date: date, Period: dp[sep+1:]})
 	}
 
-	// Fetch all attendance using requestBody from db
+	// Fetch all attendance for the classes and ask each teacher for a review
+	for _, class := range classes {
+		date, period := class.Date, class.Period
+		if date.IsZero() {
+			http.Error(w, "date is required", http.StatusBadRequest)
+			return
+		}
 
-	for _, dp := range requestBody.Data {
-		period := dp[len(dp)-2:]
-		date := dp[:len(dp)-3]
+		// Claims can only be filed for classes the student has
+		scheduled, err := s.scheduledClasses(r.Context(), store.ClassFilter{StudentID: p.StudentID}, date, period)
+		var closed *closedDayError
+		if errors.As(err, &closed) {
+			http.Error(w, closed.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if len(scheduled) == 0 {
+			http.Error(w, "You have no class in period "+period+" on "+date.String(), http.StatusBadRequest)
+			return
+		}
 
-		attendanceRecords, err := getAttendanceRecords(date, period, student.ID)
+		attendanceRecords, err := s.store.Attendance.FindAttendance(r.Context(), p.StudentID, date, period)
 		if err != nil {
 			http.Error(w, "Failed to fetch attendance records", http.StatusInternalServerError)
 			return
 		}
 
 		for _, attendanceRecord := range attendanceRecords {
-			claimReview := ClaimReview{
-				ClaimId:      medicalClaim.ID,
+			medicalClaim.ClaimReviews = append(medicalClaim.ClaimReviews, store.ClaimReview{
 				AttendanceId: attendanceRecord.ID,
 				TeacherId:    attendanceRecord.TeacherId,
 				Status:       "pending",
-			}
-
-			result := db.Create(&claimReview)
-			if result.Error != nil {
-				http.Error(w, "Failed to create claim review", http.StatusInternalServerError)
-				return
-			}
+			})
 		}
 	}
 
+	// Save medicalClaim, its files and claim reviews to the database
+	err = s.store.Claims.CreateClaim(r.Context(), &medicalClaim, p.UserID)
+	if err != nil {
+		http.Error(w, "Failed to save medical claim", http.StatusInternalServerError)
+		return
+	}
+
 	// Respond with newly created medical claim
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(medicalClaim)
 }
 
-func getMedicalClaimByIdHandler(w http.ResponseWriter, r *http.Request) {
+func (s *server) getMedicalClaimByIdHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	claimId, err := strconv.Atoi(vars["claimid"])
 	if err != nil {
@@ -167,16 +140,14 @@ func getMedicalClaimByIdHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	db, sqlDB, err := connectDB()
+	medicalClaim, err := s.store.Claims.GetClaim(r.Context(), uint(claimId))
 	if err != nil {
-		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
+		http.Error(w, "Medical claim not found", http.StatusNotFound)
 		return
 	}
-	defer sqlDB.Close()
 
-	var medicalClaim MedicalClaim
-	result := db.Preload("Student").Preload("ClaimReviews").Preload("Files").Preload("ClaimReviews.Teacher").Preload("ClaimReviews.Attendance").Where("id = ?", claimId).First(&medicalClaim)
-	if result.Error != nil {
+	// Students only see their own claims and teachers the ones they review
+	if !canViewClaim(principalFrom(r.Context()), medicalClaim) {
 		http.Error(w, "Medical claim not found", http.StatusNotFound)
 		return
 	}
@@ -184,61 +155,41 @@ func getMedicalClaimByIdHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(medicalClaim)
 }
 
-func getClaimsByStudentHandler(w http.ResponseWriter, r *http.Request) {
-	// Extract the username from JWT claims
-	username, err := getUsernameFromJWT(r)
-	if err != nil {
-		http.Error(w, "Failed to get username from JWT", http.StatusInternalServerError)
-		return
-	}
-
-	// Connect to the database
-	db, sqlDB, err := connectDB()
-	if err != nil {
-		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
+func (s *server) getClaimsByStudentHandler(w http.ResponseWriter, r *http.Request) {
+	p := principalFrom(r.Context())
+	if p.StudentID == 0 {
+		http.Error(w, "Student not found", http.StatusNotFound)
 		return
 	}
-	defer sqlDB.Close()
 
 	// Fetch all medical claims for the student
-	var student Student
-	result := db.Preload("MedicalClaims").Where("username = ?", username).First(&student)
-	if result.Error != nil {
-		http.Error(w, "Student not found", http.StatusNotFound)
+	claims, err := s.store.Claims.ListClaimsByStudent(r.Context(), p.StudentID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	json.NewEncoder(w).Encode(student.MedicalClaims)
+	json.NewEncoder(w).Encode(claims)
 }
 
-func getClaimsByTeacherHandler(w http.ResponseWriter, r *http.Request) {
-	// Extract the username from JWT claims
-	username, err := getUsernameFromJWT(r)
-	if err != nil {
-		http.Error(w, "Failed to get username from JWT", http.StatusInternalServerError)
+func (s *server) getClaimsByTeacherHandler(w http.ResponseWriter, r *http.Request) {
+	p := principalFrom(r.Context())
+	if p.TeacherID == 0 {
+		http.Error(w, "Teacher not found", http.StatusNotFound)
 		return
 	}
 
-	// Connect to the database
-	db, sqlDB, err := connectDB()
+	// Fetch all claim reviews assigned to the teacher
+	reviews, err := s.store.Claims.ListReviewsByTeacher(r.Context(), store.TeacherKey(p.TeacherID))
 	if err != nil {
-		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
-		return
-	}
-	defer sqlDB.Close()
-
-	// Fetch all medical claims for the student
-	var teacher Teacher
-	result := db.Preload("Claim").Preload("Claim.MedicalClaim").Preload("Claim.MedicalClaim.Files").Preload("Claim.MedicalClaim.Student").Where("username = ?", username).First(&teacher)
-	if result.Error != nil {
-		http.Error(w, "Student not found", http.StatusNotFound)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	json.NewEncoder(w).Encode(teacher.Claim)
+	json.NewEncoder(w).Encode(reviews)
 }
 
-func putClaimReviewHandler(w http.ResponseWriter, r *http.Request) {
+func (s *server) putClaimReviewHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	claimId, err := strconv.Atoi(vars["claimid"])
 	if err != nil {
@@ -246,41 +197,29 @@ func putClaimReviewHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var requestBody ClaimReview
+	var requestBody store.ClaimReview
 	err = json.NewDecoder(r.Body).Decode(&requestBody)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Extract the username from JWT claims
-	username, err := getUsernameFromJWT(r)
-	if err != nil {
-		http.Error(w, "Failed to get username from JWT", http.StatusInternalServerError)
+	p := principalFrom(r.Context())
+	if p.TeacherID == 0 {
+		http.Error(w, "Teacher not found", http.StatusNotFound)
 		return
 	}
 
-	// Connect to the database
-	db, sqlDB, err := connectDB()
+	// Fetch the claim review
+	claimReview, err := s.store.Claims.GetClaimReview(r.Context(), uint(claimId))
 	if err != nil {
-		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
-		return
-	}
-	defer sqlDB.Close()
-
-	// Fetch the teacher
-	var teacher Teacher
-	result := db.Where("username = ?", username).First(&teacher)
-	if result.Error != nil {
-		http.Error(w, "Teacher not found", http.StatusNotFound)
+		http.Error(w, "Claim review not found", http.StatusNotFound)
 		return
 	}
 
-	// Fetch the claim review
-	var claimReview ClaimReview
-	result = db.Where("id = ?", claimId).First(&claimReview)
-	if result.Error != nil {
-		http.Error(w, "Claim review not found", http.StatusNotFound)
+	// Teachers can only review the claim reviews assigned to them
+	if claimReview.TeacherId != store.TeacherKey(p.TeacherID) {
+		http.Error(w, "Claim review is assigned to another teacher", http.StatusForbidden)
 		return
 	}
 
@@ -288,11 +227,33 @@ func putClaimReviewHandler(w http.ResponseWriter, r *http.Request) {
 	claimReview.Status = requestBody.Status
 	claimReview.Message = requestBody.Message
 
-	result = db.Save(&claimReview)
-	if result.Error != nil {
+	err = s.store.Claims.UpdateClaimReview(r.Context(), claimReview)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Claim review not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
 		http.Error(w, "Failed to save claim review", http.StatusInternalServerError)
 		return
 	}
 
 	json.NewEncoder(w).Encode(claimReview)
 }
+
+// canViewClaim reports whether p may read claim.
+func canViewClaim(p *Principal, claim *store.MedicalClaim) bool {
+	if p.Can(PermClaimsRead) {
+		return true
+	}
+	if p.Can(PermClaimsSubmit) && p.StudentID != 0 && claim.StudentId == p.StudentID {
+		return true
+	}
+	if p.Can(PermClaimsReview) && p.TeacherID != 0 {
+		for _, review := range claim.ClaimReviews {
+			if review.TeacherId == store.TeacherKey(p.TeacherID) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,487 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+
+	"api/store"
+)
+
+// Config is the application configuration. It is loaded once at startup and
+// handed to every subsystem that needs it.
+type Config struct {
+	ListenAddr  string
+	FrontendURL string
+
+	DatabaseURL string
+	DBPool      poolOptions
+
+	// Access tokens are signed with JWTAlgorithm (RS256 or EdDSA) by keys
+	// kept in the database. A new key is published JWTKeyPublishAhead before
+	// it replaces the current one, every JWTKeyRotation.
+	JWTAlgorithm       string
+	JWTKeyRotation     time.Duration
+	JWTKeyPublishAhead time.Duration
+	JWTIssuer          string
+	AccessTokenTTL     time.Duration
+	RefreshTokenTTL    time.Duration
+
+	// Self-registration is limited to students. When set, their email must
+	// be in one of these domains and their register number in the allowlist.
+	RegistrationEmailDomains []string
+	RegisterNumberAllowlist  map[string]bool
+	InvitationTTL            time.Duration
+
+	// Password reset links point at PasswordResetURL and are delivered by
+	// the notifier named by Notifier ("log" or "file").
+	PasswordResetTTL time.Duration
+	PasswordResetURL string
+	Notifier         string
+	NotifierFile     string
+
+	// API keys expire APIKeyTTL after creation unless the admin picks
+	// another expiry, which may be at most APIKeyMaxTTL away.
+	APIKeyTTL    time.Duration
+	APIKeyMaxTTL time.Duration
+
+	// Admins impersonating a user get a read-only token valid for
+	// ImpersonationTTL.
+	ImpersonationTTL time.Duration
+
+	// Absences covered by an approved medical claim count towards attendance
+	// percentages as ApprovedClaims says: "present" as attended, "excluded"
+	// as if the class was not held, or "absent" as any other absence.
+	ApprovedClaims string
+
+	// Each attendance status counts towards percentages with its weight,
+	// between 0 (absent) and 1 (present), e.g. 0.5 for a half day.
+	StatusWeights map[string]float64
+
+	// Teachers may edit attendance up to EditWindowDays days after the
+	// class. Later changes are correction requests, which a reviewer must
+	// approve.
+	EditWindowDays int
+
+	Login loginLimits
+
+	// Users with one of MFARequiredRoles must enroll in TOTP before they can
+	// use the API. MFAChallengeTTL bounds the second step of a login.
+	MFARequiredRoles []string
+	MFAChallengeTTL  time.Duration
+	MFAIssuer        string // Name shown in authenticator apps
+
+	OIDC oidcOptions
+
+	// Take the client IP from X-Forwarded-For; only safe behind a proxy
+	// that sets it.
+	TrustProxyHeaders bool
+}
+
+// poolOptions controls the size and recycling of the shared connection pool.
+type poolOptions struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// loginLimits slows down and locks out repeated failed logins, both for an
+// account and for a client IP.
+type loginLimits struct {
+	MaxFailures   int           // Consecutive failures before an account is locked
+	Lockout       time.Duration // How long a locked account stays locked
+	IPMaxFailures int           // Failures from one IP within IPWindow before it is blocked
+	IPWindow      time.Duration
+	Delay         time.Duration // Delay after the first failure, doubled for each further one
+	MaxDelay      time.Duration
+}
+
+// oidcOptions configures single sign-on through an OpenID Connect provider.
+// It is disabled when Issuer is empty.
+type oidcOptions struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string // Must be registered with the provider
+	Scopes       []string
+
+	UsernameClaim string // Claim that names new accounts
+	RoleClaim     string // Claim whose values are looked up in RoleMap
+	RoleMap       map[string]string
+	DefaultRole   string // Role of new accounts no RoleMap entry matched; empty to not create them
+	LinkByEmail   bool   // Link the provider account to the user with the same verified email
+	LoginTTL      time.Duration
+}
+
+// flagKeys maps command-line flags onto the config keys they override.
+var flagKeys = map[string]string{
+	"addr":         "LISTEN_ADDR",
+	"database-url": "DATABASE_URL",
+	"frontend-url": "FRONTEND_URL",
+}
+
+// loadConfig builds the configuration from, in increasing order of
+// precedence: built-in defaults, the config file (-config, or .env when
+// present), environment variables and command-line flags. It returns the
+// arguments left after the flags, which name the command to run.
+func loadConfig(args []string) (*Config, []string, error) {
+	fs := flag.NewFlagSet("api", flag.ContinueOnError)
+	configFile := fs.String("config", "", "path to a KEY=VALUE config file (default .env if present)")
+	fs.String("addr", "", "address to listen on (LISTEN_ADDR)")
+	fs.String("database-url", "", "Postgres connection string (DATABASE_URL)")
+	fs.String("frontend-url", "", "origin allowed by CORS (FRONTEND_URL)")
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	values := configValues{}
+
+	// Config file
+	path := *configFile
+	if path == "" {
+		if _, err := os.Stat(".env"); err == nil {
+			path = ".env"
+		}
+	}
+	if path != "" {
+		file, err := godotenv.Read(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading config file: %v", err)
+		}
+		for key, value := range file {
+			values[key] = value
+		}
+	}
+
+	// Environment and flags
+	for _, kv := range os.Environ() {
+		key, value, _ := strings.Cut(kv, "=")
+		values[key] = value
+	}
+	fs.Visit(func(f *flag.Flag) {
+		if key, ok := flagKeys[f.Name]; ok {
+			values[key] = f.Value.String()
+		}
+	})
+
+	cfg, err := parseConfig(values)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, nil, err
+	}
+	return cfg, fs.Args(), nil
+}
+
+func parseConfig(v configValues) (*Config, error) {
+	var err error
+	cfg := &Config{
+		ListenAddr:   v.string("LISTEN_ADDR", ":8000"),
+		FrontendURL:  v.string("FRONTEND_URL", ""),
+		DatabaseURL:  v.string("DATABASE_URL", ""),
+		JWTAlgorithm: v.string("JWT_ALGORITHM", "RS256"),
+		JWTIssuer:    v.string("JWT_ISSUER", "attendance-api-go"),
+
+		RegistrationEmailDomains: v.list("REGISTRATION_EMAIL_DOMAINS"),
+
+		MFARequiredRoles: v.list("MFA_REQUIRED_ROLES"),
+		MFAIssuer:        v.string("MFA_ISSUER", "Attendance"),
+
+		OIDC: oidcOptions{
+			Issuer:        strings.TrimSuffix(v.string("OIDC_ISSUER", ""), "/"),
+			ClientID:      v.string("OIDC_CLIENT_ID", ""),
+			ClientSecret:  v.string("OIDC_CLIENT_SECRET", ""),
+			RedirectURL:   v.string("OIDC_REDIRECT_URL", ""),
+			Scopes:        v.list("OIDC_SCOPES"),
+			UsernameClaim: v.string("OIDC_USERNAME_CLAIM", "preferred_username"),
+			RoleClaim:     v.string("OIDC_ROLE_CLAIM", ""),
+			DefaultRole:   v.string("OIDC_DEFAULT_ROLE", ""),
+		},
+
+		Notifier:     v.string("NOTIFIER", "log"),
+		NotifierFile: v.string("NOTIFIER_FILE", "notifications.log"),
+
+		ApprovedClaims: v.string("ATTENDANCE_APPROVED_CLAIMS", "present"),
+	}
+	cfg.PasswordResetURL = v.string("PASSWORD_RESET_URL", cfg.FrontendURL+"/reset-password")
+
+	if cfg.DBPool.MaxOpenConns, err = v.int("DB_MAX_OPEN_CONNS", 25); err != nil {
+		return nil, err
+	}
+	if cfg.DBPool.MaxIdleConns, err = v.int("DB_MAX_IDLE_CONNS", 10); err != nil {
+		return nil, err
+	}
+	if cfg.DBPool.ConnMaxLifetime, err = v.duration("DB_CONN_MAX_LIFETIME", 30*time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.DBPool.ConnMaxIdleTime, err = v.duration("DB_CONN_MAX_IDLE_TIME", 5*time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.JWTKeyRotation, err = v.duration("JWT_KEY_ROTATION", 30*24*time.Hour); err != nil {
+		return nil, err
+	}
+	if cfg.JWTKeyPublishAhead, err = v.duration("JWT_KEY_PUBLISH_AHEAD", 24*time.Hour); err != nil {
+		return nil, err
+	}
+	if cfg.AccessTokenTTL, err = v.duration("ACCESS_TOKEN_TTL", 15*time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.RefreshTokenTTL, err = v.duration("REFRESH_TOKEN_TTL", 30*24*time.Hour); err != nil {
+		return nil, err
+	}
+	if cfg.InvitationTTL, err = v.duration("INVITATION_TTL", 72*time.Hour); err != nil {
+		return nil, err
+	}
+	if cfg.PasswordResetTTL, err = v.duration("PASSWORD_RESET_TTL", time.Hour); err != nil {
+		return nil, err
+	}
+	if cfg.APIKeyTTL, err = v.duration("API_KEY_TTL", 90*24*time.Hour); err != nil {
+		return nil, err
+	}
+	if cfg.APIKeyMaxTTL, err = v.duration("API_KEY_MAX_TTL", 365*24*time.Hour); err != nil {
+		return nil, err
+	}
+	if cfg.ImpersonationTTL, err = v.duration("IMPERSONATION_TTL", 15*time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.StatusWeights, err = v.weights("ATTENDANCE_STATUS_WEIGHTS", defaultStatusWeights); err != nil {
+		return nil, err
+	}
+	if cfg.EditWindowDays, err = v.int("ATTENDANCE_EDIT_WINDOW_DAYS", 7); err != nil {
+		return nil, err
+	}
+	if cfg.Login.MaxFailures, err = v.int("LOGIN_MAX_FAILURES", 5); err != nil {
+		return nil, err
+	}
+	if cfg.Login.Lockout, err = v.duration("LOGIN_LOCKOUT", 15*time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.Login.IPMaxFailures, err = v.int("LOGIN_IP_MAX_FAILURES", 50); err != nil {
+		return nil, err
+	}
+	if cfg.Login.IPWindow, err = v.duration("LOGIN_IP_WINDOW", 15*time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.Login.Delay, err = v.duration("LOGIN_DELAY", 250*time.Millisecond); err != nil {
+		return nil, err
+	}
+	if cfg.Login.MaxDelay, err = v.duration("LOGIN_MAX_DELAY", 5*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.MFAChallengeTTL, err = v.duration("MFA_CHALLENGE_TTL", 5*time.Minute); err != nil {
+		return nil, err
+	}
+	if len(cfg.OIDC.Scopes) == 0 {
+		cfg.OIDC.Scopes = []string{"openid", "profile", "email"}
+	}
+	if cfg.OIDC.RoleMap, err = v.pairs("OIDC_ROLE_MAP"); err != nil {
+		return nil, err
+	}
+	if cfg.OIDC.LinkByEmail, err = v.bool("OIDC_LINK_BY_EMAIL", true); err != nil {
+		return nil, err
+	}
+	if cfg.OIDC.LoginTTL, err = v.duration("OIDC_LOGIN_TTL", 10*time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.TrustProxyHeaders, err = v.bool("TRUST_PROXY_HEADERS", false); err != nil {
+		return nil, err
+	}
+	if path := v.string("REGISTER_NUMBER_ALLOWLIST", ""); path != "" {
+		if cfg.RegisterNumberAllowlist, err = readAllowlist(path); err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
+// validate rejects configurations the server must not start with.
+func (c *Config) validate() error {
+	var errs []error
+	if c.DatabaseURL == "" {
+		errs = append(errs, errors.New("DATABASE_URL is required"))
+	}
+	if _, err := signingMethod(c.JWTAlgorithm); err != nil {
+		errs = append(errs, fmt.Errorf("JWT_ALGORITHM must be RS256 or EdDSA, not %q", c.JWTAlgorithm))
+	}
+	if c.JWTKeyPublishAhead < 0 || c.JWTKeyRotation <= c.JWTKeyPublishAhead {
+		errs = append(errs, errors.New("JWT_KEY_PUBLISH_AHEAD must be between 0 and JWT_KEY_ROTATION"))
+	}
+	if c.DBPool.MaxOpenConns < 1 {
+		errs = append(errs, errors.New("DB_MAX_OPEN_CONNS must be at least 1"))
+	}
+	if c.DBPool.MaxIdleConns < 0 || c.DBPool.MaxIdleConns > c.DBPool.MaxOpenConns {
+		errs = append(errs, errors.New("DB_MAX_IDLE_CONNS must be between 0 and DB_MAX_OPEN_CONNS"))
+	}
+	if c.AccessTokenTTL <= 0 {
+		errs = append(errs, errors.New("ACCESS_TOKEN_TTL must be positive"))
+	}
+	if c.InvitationTTL <= 0 {
+		errs = append(errs, errors.New("INVITATION_TTL must be positive"))
+	}
+	if c.PasswordResetTTL <= 0 {
+		errs = append(errs, errors.New("PASSWORD_RESET_TTL must be positive"))
+	}
+	if c.APIKeyTTL <= 0 || c.APIKeyMaxTTL < c.APIKeyTTL {
+		errs = append(errs, errors.New("API_KEY_TTL must be between 0 and API_KEY_MAX_TTL"))
+	}
+	if c.ImpersonationTTL <= 0 {
+		errs = append(errs, errors.New("IMPERSONATION_TTL must be positive"))
+	}
+	if !slices.Contains([]string{"present", "excluded", "absent"}, c.ApprovedClaims) {
+		errs = append(errs, fmt.Errorf("ATTENDANCE_APPROVED_CLAIMS must be present, excluded or absent, not %q", c.ApprovedClaims))
+	}
+	for status, weight := range c.StatusWeights {
+		if !slices.Contains(store.AttendanceStatuses, status) {
+			errs = append(errs, fmt.Errorf("ATTENDANCE_STATUS_WEIGHTS: %q is not an attendance status", status))
+		} else if weight < 0 || weight > 1 {
+			errs = append(errs, fmt.Errorf("ATTENDANCE_STATUS_WEIGHTS: the weight of %s must be between 0 and 1", status))
+		}
+	}
+	if c.EditWindowDays < 0 {
+		errs = append(errs, errors.New("ATTENDANCE_EDIT_WINDOW_DAYS must not be negative"))
+	}
+	if c.Login.MaxFailures < 1 || c.Login.IPMaxFailures < 1 {
+		errs = append(errs, errors.New("LOGIN_MAX_FAILURES and LOGIN_IP_MAX_FAILURES must be at least 1"))
+	}
+	if c.Login.Lockout <= 0 || c.Login.IPWindow <= 0 {
+		errs = append(errs, errors.New("LOGIN_LOCKOUT and LOGIN_IP_WINDOW must be positive"))
+	}
+	if c.Login.Delay < 0 || c.Login.MaxDelay < c.Login.Delay {
+		errs = append(errs, errors.New("LOGIN_DELAY must be between 0 and LOGIN_MAX_DELAY"))
+	}
+	if c.MFAChallengeTTL <= 0 {
+		errs = append(errs, errors.New("MFA_CHALLENGE_TTL must be positive"))
+	}
+	if c.OIDC.Issuer != "" && (c.OIDC.ClientID == "" || c.OIDC.RedirectURL == "") {
+		errs = append(errs, errors.New("OIDC_CLIENT_ID and OIDC_REDIRECT_URL are required with OIDC_ISSUER"))
+	}
+	if c.Notifier != "log" && c.Notifier != "file" {
+		errs = append(errs, fmt.Errorf("NOTIFIER must be log or file, not %q", c.Notifier))
+	}
+	if c.RefreshTokenTTL <= c.AccessTokenTTL {
+		errs = append(errs, errors.New("REFRESH_TOKEN_TTL must be longer than ACCESS_TOKEN_TTL"))
+	}
+	return errors.Join(errs...)
+}
+
+// defaultStatusWeights counts being late, away on duty or excused as
+// attending, and half a day as half.
+var defaultStatusWeights = map[string]float64{
+	store.AttendancePresent: 1,
+	store.AttendanceLate:    1,
+	store.AttendanceHalfDay: 0.5,
+	store.AttendanceOnDuty:  1,
+	store.AttendanceExcused: 1,
+	store.AttendanceAbsent:  0,
+}
+
+// configValues holds raw KEY=VALUE settings before they are typed.
+type configValues map[string]string
+
+func (v configValues) string(key string, fallback string) string {
+	if value, ok := v[key]; ok && value != "" {
+		return value
+	}
+	return fallback
+}
+
+// list splits a comma-separated value, dropping empty entries.
+func (v configValues) list(key string) []string {
+	var items []string
+	for _, item := range strings.Split(v[key], ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// pairs parses a comma-separated list of key=value pairs.
+func (v configValues) pairs(key string) (map[string]string, error) {
+	pairs := map[string]string{}
+	for _, item := range v.list(key) {
+		k, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid %s: %q is not key=value", key, item)
+		}
+		pairs[strings.TrimSpace(k)] = strings.TrimSpace(value)
+	}
+	return pairs, nil
+}
+
+// weights reads key=weight pairs over a copy of fallback.
+func (v configValues) weights(key string, fallback map[string]float64) (map[string]float64, error) {
+	pairs, err := v.pairs(key)
+	if err != nil {
+		return nil, err
+	}
+	weights := maps.Clone(fallback)
+	for k, value := range pairs {
+		if weights[k], err = strconv.ParseFloat(value, 64); err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", key, err)
+		}
+	}
+	return weights, nil
+}
+
+func (v configValues) int(key string, fallback int) (int, error) {
+	value, ok := v[key]
+	if !ok || value == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %v", key, err)
+	}
+	return n, nil
+}
+
+func (v configValues) bool(key string, fallback bool) (bool, error) {
+	value, ok := v[key]
+	if !ok || value == "" {
+		return fallback, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s: %v", key, err)
+	}
+	return b, nil
+}
+
+func (v configValues) duration(key string, fallback time.Duration) (time.Duration, error) {
+	value, ok := v[key]
+	if !ok || value == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %v", key, err)
+	}
+	return d, nil
+}
+
+// readAllowlist reads one entry per line, ignoring blank lines and # comments.
+func readAllowlist(path string) (map[string]bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading allowlist: %v", err)
+	}
+
+	allowlist := map[string]bool{}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			allowlist[line] = true
+		}
+	}
+	return allowlist, nil
+}
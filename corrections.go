@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"api/store"
+)
+
+// correctionBody is how attendance corrections are written to the API.
+type correctionBody struct {
+	ID            uint       `json:"id"`
+	AttendanceID  uint       `json:"attendance_id"`
+	RequestedBy   uint       `json:"requested_by"`
+	Status        string     `json:"status"`
+	Reason        string     `json:"reason"`
+	Explanation   string     `json:"explanation"`
+	State         string     `json:"state"`
+	CreatedAt     time.Time  `json:"created_at"`
+	ReviewedBy    *uint      `json:"reviewed_by"`
+	ReviewedAt    *time.Time `json:"reviewed_at"`
+	ReviewComment string     `json:"review_comment"`
+}
+
+func newCorrectionBody(correction store.AttendanceCorrection) correctionBody {
+	return correctionBody{
+		ID:            correction.ID,
+		AttendanceID:  correction.AttendanceID,
+		RequestedBy:   correction.RequestedBy,
+		Status:        correction.Status,
+		Reason:        correction.Reason,
+		Explanation:   correction.Explanation,
+		State:         correction.State,
+		CreatedAt:     correction.CreatedAt,
+		ReviewedBy:    correction.ReviewedBy,
+		ReviewedAt:    correction.ReviewedAt,
+		ReviewComment: correction.ReviewComment,
+	}
+}
+
+// pathAttendance loads the attendance record named by {attendanceid}. If
+// it cannot, it writes the error response and returns false.
+func (s *server) pathAttendance(w http.ResponseWriter, r *http.Request) (*store.Attendance, bool) {
+	id, err := pathID(r, "attendanceid")
+	if err != nil {
+		http.Error(w, "Invalid attendance ID", http.StatusBadRequest)
+		return nil, false
+	}
+	attendance, err := s.store.Attendance.GetAttendance(r.Context(), id)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Attendance not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	return attendance, true
+}
+
+// canCorrect reports whether p may correct, and see the history of, an
+// attendance record: teachers only the records they took, as for editing
+// it.
+func canCorrect(p *Principal, attendance *store.Attendance) bool {
+	if p.Can(PermAttendanceWrite) || p.Can(PermAttendanceReview) {
+		return true
+	}
+	return takenBy(p, attendance)
+}
+
+// createCorrectionHandler asks for an attendance record to be given
+// another status. Corrections of records within the edit window, or made
+// by someone who could approve them, are applied at once; the others wait
+// for a reviewer.
+func (s *server) createCorrectionHandler(w http.ResponseWriter, r *http.Request) {
+	p := principalFrom(r.Context())
+	attendance, ok := s.pathAttendance(w, r)
+	if !ok {
+		return
+	}
+	if !canCorrect(p, attendance) {
+		http.Error(w, "You did not take this attendance", http.StatusForbidden)
+		return
+	}
+
+	var body struct {
+		Status      string `json:"status"`
+		Reason      string `json:"reason"`
+		Explanation string `json:"explanation"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if body.Explanation == "" {
+		http.Error(w, "explanation is required", http.StatusBadRequest)
+		return
+	}
+	if !s.checkMark(w, r, store.Mark{Status: body.Status, Reason: body.Reason}) {
+		return
+	}
+
+	correction := store.AttendanceCorrection{
+		AttendanceID: attendance.ID,
+		RequestedBy:  p.UserID,
+		Status:       body.Status,
+		Reason:       body.Reason,
+		Explanation:  body.Explanation,
+		State:        store.CorrectionPending,
+	}
+	if p.Can(PermAttendanceWrite) || p.Can(PermAttendanceReview) || s.withinEditWindow(attendance.Date) {
+		correction.State = store.CorrectionApproved
+	}
+	err = s.store.Corrections.CreateCorrection(r.Context(), &correction)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Attendance not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, store.ErrDuplicate) {
+		http.Error(w, "The attendance already has a pending correction", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newCorrectionBody(correction))
+}
+
+// listCorrectionsHandler lists corrections, newest first, optionally only
+// those in ?state= or for ?attendance_id=. Reviewers see every correction,
+// others only the ones they asked for.
+func (s *server) listCorrectionsHandler(w http.ResponseWriter, r *http.Request) {
+	p := principalFrom(r.Context())
+	query := r.URL.Query()
+
+	filter := store.CorrectionFilter{State: query.Get("state")}
+	if value := query.Get("attendance_id"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			http.Error(w, "Invalid attendance ID", http.StatusBadRequest)
+			return
+		}
+		filter.AttendanceID = uint(id)
+	}
+	if !p.Can(PermAttendanceWrite) && !p.Can(PermAttendanceReview) {
+		filter.RequestedBy = p.UserID
+	}
+
+	corrections, err := s.store.Corrections.ListCorrections(r.Context(), filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]correctionBody, len(corrections))
+	for i, correction := range corrections {
+		response[i] = newCorrectionBody(correction)
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *server) approveCorrectionHandler(w http.ResponseWriter, r *http.Request) {
+	s.reviewCorrection(w, r, true)
+}
+
+func (s *server) rejectCorrectionHandler(w http.ResponseWriter, r *http.Request) {
+	s.reviewCorrection(w, r, false)
+}
+
+// reviewCorrection approves or rejects the pending correction in the path,
+// with an optional comment. Approving it changes the attendance record.
+func (s *server) reviewCorrection(w http.ResponseWriter, r *http.Request, approve bool) {
+	id, err := pathID(r, "correctionid")
+	if err != nil {
+		http.Error(w, "Invalid correction ID", http.StatusBadRequest)
+		return
+	}
+
+	var body struct {
+		Comment string `json:"comment"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	correction, err := s.store.Corrections.ReviewCorrection(r.Context(), id, approve, principalFrom(r.Context()).UserID, body.Comment)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Correction not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, store.ErrConflict) {
+		http.Error(w, "The correction has already been reviewed", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(newCorrectionBody(*correction))
+}
+
+// attendanceHistoryHandler returns every change made to an attendance
+// record, oldest first.
+func (s *server) attendanceHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	attendance, ok := s.pathAttendance(w, r)
+	if !ok {
+		return
+	}
+	if !canCorrect(principalFrom(r.Context()), attendance) {
+		http.Error(w, "You did not take this attendance", http.StatusForbidden)
+		return
+	}
+
+	changes, err := s.store.Attendance.ListAttendanceChanges(r.Context(), attendance.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	type changeBody struct {
+		Time         time.Time              `json:"time"`
+		ChangedBy    uint                   `json:"changed_by"`
+		CorrectionID *uint                  `json:"correction_id"`
+		Before       *store.AttendanceState `json:"before"`
+		After        store.AttendanceState  `json:"after"`
+	}
+	response := make([]changeBody, len(changes))
+	for i, change := range changes {
+		response[i] = changeBody{change.CreatedAt, change.ChangedBy, change.CorrectionID, change.Before, change.After}
+	}
+	json.NewEncoder(w).Encode(response)
+}
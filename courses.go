@@ -0,0 +1,484 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"api/store"
+)
+
+type courseBody struct {
+	ID       uint          `json:"id"`
+	Code     string        `json:"code"`
+	Name     string        `json:"name"`
+	Sections []sectionBody `json:"sections,omitempty"`
+}
+
+func newCourseBody(course store.Course) courseBody {
+	return courseBody{ID: course.ID, Code: course.Code, Name: course.Name}
+}
+
+type sectionBody struct {
+	ID        uint   `json:"id"`
+	CourseID  uint   `json:"course_id"`
+	Name      string `json:"name"`
+	Term      string `json:"term"`
+	TeacherID *uint  `json:"teacher_id"`
+}
+
+func newSectionBody(section store.Section) sectionBody {
+	return sectionBody{
+		ID:        section.ID,
+		CourseID:  section.CourseID,
+		Name:      section.Name,
+		Term:      section.Term,
+		TeacherID: section.TeacherID,
+	}
+}
+
+// enrolledStudentBody is how the students of a section are listed.
+type enrolledStudentBody struct {
+	ID             uint   `json:"id"`
+	Username       string `json:"username"`
+	Name           string `json:"name"`
+	RegisterNumber string `json:"register_number"`
+}
+
+func (s *server) listCoursesHandler(w http.ResponseWriter, r *http.Request) {
+	courses, err := s.store.Courses.ListCourses(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]courseBody, len(courses))
+	for i, course := range courses {
+		response[i] = newCourseBody(course)
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *server) createCourseHandler(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Code string `json:"code"`
+		Name string `json:"name"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if body.Code == "" {
+		http.Error(w, "code is required", http.StatusBadRequest)
+		return
+	}
+
+	course := store.Course{Code: body.Code, Name: body.Name}
+	err = s.store.Courses.CreateCourse(r.Context(), &course)
+	if errors.Is(err, store.ErrDuplicate) {
+		http.Error(w, "Course code is already taken", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newCourseBody(course))
+}
+
+// getCourseHandler returns a course with its sections.
+func (s *server) getCourseHandler(w http.ResponseWriter, r *http.Request) {
+	course, ok := s.pathCourse(w, r)
+	if !ok {
+		return
+	}
+
+	sections, err := s.store.Courses.ListSections(r.Context(), store.SectionFilter{CourseID: course.ID})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := newCourseBody(*course)
+	response.Sections = make([]sectionBody, len(sections))
+	for i, section := range sections {
+		response.Sections[i] = newSectionBody(section)
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *server) updateCourseHandler(w http.ResponseWriter, r *http.Request) {
+	course, ok := s.pathCourse(w, r)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Code *string `json:"code"`
+		Name *string `json:"name"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if body.Code != nil {
+		if *body.Code == "" {
+			http.Error(w, "code cannot be empty", http.StatusBadRequest)
+			return
+		}
+		course.Code = *body.Code
+	}
+	if body.Name != nil {
+		course.Name = *body.Name
+	}
+
+	err = s.store.Courses.UpdateCourse(r.Context(), course)
+	if errors.Is(err, store.ErrDuplicate) {
+		http.Error(w, "Course code is already taken", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(newCourseBody(*course))
+}
+
+func (s *server) deleteCourseHandler(w http.ResponseWriter, r *http.Request) {
+	courseId, err := pathID(r, "courseid")
+	if err != nil {
+		http.Error(w, "Invalid course ID", http.StatusBadRequest)
+		return
+	}
+
+	err = s.store.Courses.DeleteCourse(r.Context(), courseId)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Course not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, store.ErrConflict) {
+		http.Error(w, "The course still has sections", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listSectionsHandler lists the sections of the course in the path, or those
+// matching the ?course_id=, ?teacher_id=, ?student_id= and ?term= filters.
+func (s *server) listSectionsHandler(w http.ResponseWriter, r *http.Request) {
+	var filter store.SectionFilter
+	query := r.URL.Query()
+	for name, field := range map[string]*uint{
+		"course_id":  &filter.CourseID,
+		"teacher_id": &filter.TeacherID,
+		"student_id": &filter.StudentID,
+	} {
+		if value := query.Get(name); value != "" {
+			id, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				http.Error(w, "Invalid "+name, http.StatusBadRequest)
+				return
+			}
+			*field = uint(id)
+		}
+	}
+	filter.Term = query.Get("term")
+
+	if _, ok := mux.Vars(r)["courseid"]; ok {
+		course, ok := s.pathCourse(w, r)
+		if !ok {
+			return
+		}
+		filter.CourseID = course.ID
+	}
+
+	sections, err := s.store.Courses.ListSections(r.Context(), filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]sectionBody, len(sections))
+	for i, section := range sections {
+		response[i] = newSectionBody(section)
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *server) createSectionHandler(w http.ResponseWriter, r *http.Request) {
+	course, ok := s.pathCourse(w, r)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Name      string `json:"name"`
+		Term      string `json:"term"`
+		TeacherID *uint  `json:"teacher_id"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if body.Name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	if body.TeacherID != nil && !s.teacherExists(w, r, *body.TeacherID) {
+		return
+	}
+
+	section := store.Section{
+		CourseID:  course.ID,
+		Name:      body.Name,
+		Term:      body.Term,
+		TeacherID: body.TeacherID,
+	}
+	err = s.store.Courses.CreateSection(r.Context(), &section)
+	if errors.Is(err, store.ErrDuplicate) {
+		http.Error(w, "The course already has a section of that name in the term", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newSectionBody(section))
+}
+
+func (s *server) getSectionHandler(w http.ResponseWriter, r *http.Request) {
+	section, ok := s.pathSection(w, r)
+	if !ok {
+		return
+	}
+	json.NewEncoder(w).Encode(newSectionBody(*section))
+}
+
+// updateSectionHandler renames a section, moves it to another term or
+// assigns its teacher. A teacher_id of 0 leaves it without a teacher.
+func (s *server) updateSectionHandler(w http.ResponseWriter, r *http.Request) {
+	section, ok := s.pathSection(w, r)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Name      *string `json:"name"`
+		Term      *string `json:"term"`
+		TeacherID *uint   `json:"teacher_id"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if body.Name != nil {
+		if *body.Name == "" {
+			http.Error(w, "name cannot be empty", http.StatusBadRequest)
+			return
+		}
+		section.Name = *body.Name
+	}
+	if body.Term != nil {
+		section.Term = *body.Term
+	}
+	if body.TeacherID != nil {
+		section.TeacherID = nil
+		if *body.TeacherID != 0 {
+			if !s.teacherExists(w, r, *body.TeacherID) {
+				return
+			}
+			section.TeacherID = body.TeacherID
+		}
+	}
+
+	err = s.store.Courses.UpdateSection(r.Context(), section)
+	if errors.Is(err, store.ErrDuplicate) {
+		http.Error(w, "The course already has a section of that name in the term", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(newSectionBody(*section))
+}
+
+// deleteSectionHandler deletes a section and its enrollments. Sections with
+// attendance cannot be deleted.
+func (s *server) deleteSectionHandler(w http.ResponseWriter, r *http.Request) {
+	sectionId, err := pathID(r, "sectionid")
+	if err != nil {
+		http.Error(w, "Invalid section ID", http.StatusBadRequest)
+		return
+	}
+
+	err = s.store.Courses.DeleteSection(r.Context(), sectionId)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Section not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, store.ErrConflict) {
+		http.Error(w, "Attendance has been recorded for the section", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *server) listEnrollmentsHandler(w http.ResponseWriter, r *http.Request) {
+	section, ok := s.pathSection(w, r)
+	if !ok {
+		return
+	}
+
+	students, err := s.store.Courses.ListEnrolledStudents(r.Context(), section.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]enrolledStudentBody, len(students))
+	for i, student := range students {
+		response[i] = enrolledStudentBody{
+			ID:             student.ID,
+			Username:       student.Username,
+			Name:           student.Name,
+			RegisterNumber: student.RegisterNumber,
+		}
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// enrollStudentsHandler adds students to a section. Students already in it
+// are left as they are.
+func (s *server) enrollStudentsHandler(w http.ResponseWriter, r *http.Request) {
+	section, ok := s.pathSection(w, r)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		StudentIDs []uint `json:"student_ids"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil || len(body.StudentIDs) == 0 {
+		http.Error(w, "student_ids is required", http.StatusBadRequest)
+		return
+	}
+
+	for _, studentId := range body.StudentIDs {
+		_, err := s.store.Students.GetStudent(r.Context(), studentId)
+		if errors.Is(err, store.ErrNotFound) {
+			http.Error(w, "Student "+strconv.FormatUint(uint64(studentId), 10)+" not found", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := s.store.Courses.Enroll(r.Context(), section.ID, body.StudentIDs); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *server) unenrollStudentHandler(w http.ResponseWriter, r *http.Request) {
+	section, ok := s.pathSection(w, r)
+	if !ok {
+		return
+	}
+	studentId, err := pathID(r, "studentid")
+	if err != nil {
+		http.Error(w, "Invalid student ID", http.StatusBadRequest)
+		return
+	}
+
+	err = s.store.Courses.Unenroll(r.Context(), section.ID, studentId)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "The student is not enrolled in the section", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// pathCourse loads the course named by {courseid}, answering 400 or 404
+// itself when it cannot.
+func (s *server) pathCourse(w http.ResponseWriter, r *http.Request) (*store.Course, bool) {
+	courseId, err := pathID(r, "courseid")
+	if err != nil {
+		http.Error(w, "Invalid course ID", http.StatusBadRequest)
+		return nil, false
+	}
+	course, err := s.store.Courses.GetCourse(r.Context(), courseId)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Course not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	return course, true
+}
+
+// pathSection loads the section named by {sectionid} like pathCourse.
+func (s *server) pathSection(w http.ResponseWriter, r *http.Request) (*store.Section, bool) {
+	sectionId, err := pathID(r, "sectionid")
+	if err != nil {
+		http.Error(w, "Invalid section ID", http.StatusBadRequest)
+		return nil, false
+	}
+	section, err := s.store.Courses.GetSection(r.Context(), sectionId)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Section not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	return section, true
+}
+
+// teacherExists answers 400 itself when there is no teacher teacherId.
+func (s *server) teacherExists(w http.ResponseWriter, r *http.Request, teacherId uint) bool {
+	_, err := s.store.Teachers.GetTeacher(r.Context(), teacherId)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Teacher not found", http.StatusBadRequest)
+		return false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
@@ -1,39 +1,35 @@
 package main
 
 import (
-	"database/sql"
-	"fmt"
 	"net/http"
-	"os"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 
-	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 )
 
-func connectDB() (*gorm.DB, *sql.DB, error) {
-	err := godotenv.Load(".env")
-
-	if err != nil {
-		fmt.Println("Error loading .env file")
-	}
-
-	connStr := os.Getenv("DATABASE_URL")
-	gormDB, err := gorm.Open(postgres.Open(connStr), &gorm.Config{
+// openDB opens the application-wide database handle. It is called once at
+// startup; handlers share the returned pool and must not close it.
+func openDB(cfg *Config) (*gorm.DB, error) {
+	gormDB, err := gorm.Open(postgres.Open(cfg.DatabaseURL), &gorm.Config{
 		// Logger: logger.Default.LogMode(logger.Error),
 	})
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
 	sqlDB, err := gormDB.DB()
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	return gormDB, sqlDB, nil
+	sqlDB.SetMaxOpenConns(cfg.DBPool.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.DBPool.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.DBPool.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(cfg.DBPool.ConnMaxIdleTime)
+
+	return gormDB, nil
 }
 
 func jsonContentTypeMiddleware(next http.Handler) http.Handler {
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gorilla/mux"
+
+	"api/store"
+)
+
+// impersonationBody is how impersonations are written to the admin API.
+type impersonationBody struct {
+	ID        uint       `json:"id"`
+	AdminID   uint       `json:"admin_id"`
+	UserID    uint       `json:"user_id"`
+	Reason    string     `json:"reason"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	EndedAt   *time.Time `json:"ended_at"`
+}
+
+func newImpersonationBody(impersonation store.Impersonation) impersonationBody {
+	return impersonationBody{
+		ID:        impersonation.ID,
+		AdminID:   impersonation.AdminID,
+		UserID:    impersonation.UserID,
+		Reason:    impersonation.Reason,
+		CreatedAt: impersonation.CreatedAt,
+		ExpiresAt: impersonation.ExpiresAt,
+		EndedAt:   impersonation.EndedAt,
+	}
+}
+
+// startImpersonationHandler issues a short-lived token with which the admin
+// sees the API as the user in the path. The token names both: the user as
+// its subject and the admin as its actor.
+func (s *server) startImpersonationHandler(w http.ResponseWriter, r *http.Request) {
+	p := principalFrom(r.Context())
+	if p.APIKeyID != 0 {
+		http.Error(w, "Impersonation needs an interactive login", http.StatusForbidden)
+		return
+	}
+
+	user, ok := s.pathUser(w, r)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil || body.Reason == "" {
+		http.Error(w, "reason is required", http.StatusBadRequest)
+		return
+	}
+
+	if user.ID == p.UserID {
+		http.Error(w, "You cannot impersonate yourself", http.StatusBadRequest)
+		return
+	}
+	if user.Disabled {
+		http.Error(w, "The user is disabled", http.StatusConflict)
+		return
+	}
+
+	// Impersonating must not let an admin see more than they already can
+	permissions, err := s.store.Roles.GetUserPermissions(r.Context(), user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, permission := range permissions {
+		if !p.Can(permission) {
+			http.Error(w, "The user has permissions you do not hold", http.StatusForbidden)
+			return
+		}
+	}
+
+	jti, err := newOpaqueToken()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	now := time.Now()
+	impersonation := store.Impersonation{
+		AdminID:   p.UserID,
+		UserID:    user.ID,
+		Reason:    body.Reason,
+		TokenID:   jti,
+		ExpiresAt: now.Add(s.cfg.ImpersonationTTL),
+	}
+	if err := s.store.Impersonations.CreateImpersonation(r.Context(), &impersonation); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	token, err := s.signJWT(r.Context(), &CustomClaims{
+		Username: user.Username,
+		UserType: user.UserType,
+		Actor: &ActorClaim{
+			Subject:         strconv.FormatUint(uint64(p.UserID), 10),
+			Username:        p.Username,
+			ImpersonationID: impersonation.ID,
+		},
+		StandardClaims: jwt.StandardClaims{
+			Id:        jti,
+			Subject:   strconv.FormatUint(uint64(user.ID), 10),
+			IssuedAt:  now.Unix(),
+			ExpiresAt: impersonation.ExpiresAt.Unix(),
+			Issuer:    s.cfg.JWTIssuer,
+		},
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Admin %s started impersonating %s (impersonation %d): %s",
+		p.Username, user.Username, impersonation.ID, body.Reason)
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(struct {
+		Token         string            `json:"token"`
+		ExpiresIn     int64             `json:"expires_in"`
+		Impersonation impersonationBody `json:"impersonation"`
+	}{token, int64(s.cfg.ImpersonationTTL / time.Second), newImpersonationBody(impersonation)})
+}
+
+// verifyImpersonation checks that the impersonation an access token was
+// issued for is still going on, and returns it with its admin. Ending the
+// impersonation, or the admin losing the permission, stops the token.
+func (s *server) verifyImpersonation(ctx context.Context, claims *CustomClaims) (*store.Impersonation, *store.User, error) {
+	impersonation, err := s.store.Impersonations.GetImpersonation(ctx, claims.Actor.ImpersonationID)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, nil, errTokenRevoked
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if impersonation.EndedAt != nil || impersonation.TokenID != claims.Id {
+		return nil, nil, errTokenRevoked
+	}
+
+	admin, err := s.store.Users.GetUser(ctx, impersonation.AdminID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if admin.Disabled {
+		return nil, nil, errTokenRevoked
+	}
+	permissions, err := s.store.Roles.GetUserPermissions(ctx, admin.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !slices.Contains(permissions, PermUsersImpersonate) {
+		return nil, nil, errTokenRevoked
+	}
+	return impersonation, admin, nil
+}
+
+// serveImpersonated serves a request made with an impersonation token.
+// Impersonation is read-only, so nothing is ever done in the user's name,
+// and every request is recorded against the admin.
+func (s *server) serveImpersonated(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	p := principalFrom(r.Context())
+
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		next.ServeHTTP(rec, r)
+	} else {
+		http.Error(rec, "Impersonation is read-only", http.StatusForbidden)
+	}
+
+	log.Printf("Admin %s as %s (impersonation %d): %s %s -> %d",
+		p.ImpersonatorUsername, p.Username, p.ImpersonationID, r.Method, r.URL.Path, rec.status)
+	err := s.store.Impersonations.RecordImpersonationAction(r.Context(), &store.ImpersonationAction{
+		ImpersonationID: p.ImpersonationID,
+		AdminID:         p.ImpersonatorID,
+		UserID:          p.UserID,
+		Method:          r.Method,
+		Path:            r.URL.RequestURI(),
+		Status:          rec.status,
+		IP:              s.clientIP(r),
+	})
+	if err != nil {
+		log.Printf("Failed to record impersonation action: %v", err)
+	}
+}
+
+// statusRecorder remembers the status code a handler responded with.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// listImpersonationsHandler lists the impersonations of the user in the
+// path, or every impersonation.
+func (s *server) listImpersonationsHandler(w http.ResponseWriter, r *http.Request) {
+	var userId uint
+	var err error
+	if _, ok := mux.Vars(r)["userid"]; ok {
+		if userId, err = pathID(r, "userid"); err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	limit := 50
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > 500 {
+			http.Error(w, "limit must be between 1 and 500", http.StatusBadRequest)
+			return
+		}
+	}
+
+	impersonations, err := s.store.Impersonations.ListImpersonations(r.Context(), userId, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]impersonationBody, len(impersonations))
+	for i, impersonation := range impersonations {
+		response[i] = newImpersonationBody(impersonation)
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// listImpersonationActionsHandler returns the requests made during an
+// impersonation.
+func (s *server) listImpersonationActionsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "impersonationid")
+	if err != nil {
+		http.Error(w, "Invalid impersonation ID", http.StatusBadRequest)
+		return
+	}
+	if _, err := s.store.Impersonations.GetImpersonation(r.Context(), id); errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Impersonation not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	actions, err := s.store.Impersonations.ListImpersonationActions(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	type actionBody struct {
+		Time   time.Time `json:"time"`
+		Method string    `json:"method"`
+		Path   string    `json:"path"`
+		Status int       `json:"status"`
+		IP     string    `json:"ip"`
+	}
+	response := make([]actionBody, len(actions))
+	for i, action := range actions {
+		response[i] = actionBody{action.CreatedAt, action.Method, action.Path, action.Status, action.IP}
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// endImpersonationHandler ends an impersonation before its token expires.
+func (s *server) endImpersonationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "impersonationid")
+	if err != nil {
+		http.Error(w, "Invalid impersonation ID", http.StatusBadRequest)
+		return
+	}
+
+	impersonation, err := s.store.Impersonations.GetImpersonation(r.Context(), id)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Impersonation not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = s.store.Impersonations.EndImpersonation(r.Context(), id, time.Now())
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Impersonation already ended", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	err = s.store.Tokens.RevokeAccessToken(r.Context(), impersonation.TokenID, impersonation.ExpiresAt)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
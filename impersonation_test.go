@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestImpersonationIsReadOnly(t *testing.T) {
+	ts := newTestServer(t, nil)
+	alice := ts.createUser("alice", "student")
+	ts.createUser("root", "admin")
+	admin := ts.login("root").Token
+
+	var started struct {
+		Token         string            `json:"token"`
+		Impersonation impersonationBody `json:"impersonation"`
+	}
+	path := fmt.Sprintf("/admin/users/%d/impersonate", alice.ID)
+	ts.request("POST", path, admin, map[string]string{}, http.StatusBadRequest, nil)
+	ts.request("POST", path, admin, map[string]string{"reason": "ticket 42"}, http.StatusCreated, &started)
+	token := started.Token
+
+	ts.request("GET", "/student/info", token, nil, http.StatusOK, nil)
+	ts.request("POST", "/claims/create", token, map[string]string{"reason": "flu"}, http.StatusForbidden, nil)
+	ts.request("POST", "/password/change", token, map[string]string{}, http.StatusForbidden, nil)
+	ts.request("POST", "/logout", token, nil, http.StatusForbidden, nil)
+
+	var actions []struct {
+		Method string `json:"method"`
+		Path   string `json:"path"`
+		Status int    `json:"status"`
+	}
+	actionsPath := fmt.Sprintf("/admin/impersonations/%d/actions", started.Impersonation.ID)
+	ts.request("GET", actionsPath, admin, nil, http.StatusOK, &actions)
+	if len(actions) != 4 {
+		t.Fatalf("got %d actions, want 4: %+v", len(actions), actions)
+	}
+	if actions[0].Path != "/student/info" || actions[0].Status != http.StatusOK {
+		t.Errorf("first action: got %+v", actions[0])
+	}
+	if actions[1].Method != "POST" || actions[1].Status != http.StatusForbidden {
+		t.Errorf("second action: got %+v", actions[1])
+	}
+
+	ts.request("DELETE", fmt.Sprintf("/admin/impersonations/%d", started.Impersonation.ID), admin, nil, http.StatusNoContent, nil)
+	ts.request("GET", "/student/info", token, nil, http.StatusUnauthorized, nil)
+}
+
+func TestImpersonationNeedsPermission(t *testing.T) {
+	ts := newTestServer(t, nil)
+	alice := ts.createUser("alice", "student")
+	ts.createUser("tom", "teacher")
+	root := ts.createUser("root", "admin")
+	admin := ts.login("root").Token
+	path := fmt.Sprintf("/admin/users/%d/impersonate", alice.ID)
+
+	ts.request("POST", path, ts.login("tom").Token, map[string]string{"reason": "curious"}, http.StatusForbidden, nil)
+	ts.request("POST", fmt.Sprintf("/admin/users/%d/impersonate", root.ID), admin, map[string]string{"reason": "me"}, http.StatusBadRequest, nil)
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"api/store"
+)
+
+// invitationBody is how invitations are read from and written to the admin
+// API. The token is only returned once, when the invitation is created.
+type invitationBody struct {
+	ID        uint      `json:"id"`
+	Token     string    `json:"token,omitempty"`
+	Role      string    `json:"role"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	ProfileID uint      `json:"profile_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func newInvitationBody(invitation store.Invitation) invitationBody {
+	return invitationBody{
+		ID:        invitation.ID,
+		Role:      invitation.Role,
+		Name:      invitation.Name,
+		Email:     invitation.Email,
+		ProfileID: invitation.ProfileID,
+		ExpiresAt: invitation.ExpiresAt,
+	}
+}
+
+// hasProfile reports whether accounts with role get a Teacher or IPM profile.
+func hasProfile(role string) bool {
+	return role == "teacher" || role == "ipm"
+}
+
+func (s *server) createInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	p := principalFrom(r.Context())
+
+	var body invitationBody
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Students register themselves
+	if body.Role == "" || body.Role == "student" {
+		http.Error(w, "role must be a staff role", http.StatusBadRequest)
+		return
+	}
+	if body.ProfileID != 0 && !hasProfile(body.Role) {
+		http.Error(w, "profile_id is only allowed for teacher and ipm invitations", http.StatusBadRequest)
+		return
+	}
+	if _, err := s.store.Roles.GetRoleByName(r.Context(), body.Role); err != nil {
+		http.Error(w, "Role not found", http.StatusBadRequest)
+		return
+	}
+
+	token, err := newOpaqueToken()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	invitation := store.Invitation{
+		TokenHash:   hashToken(token),
+		Role:        body.Role,
+		Name:        body.Name,
+		Email:       body.Email,
+		ProfileID:   body.ProfileID,
+		CreatedByID: &p.UserID,
+		ExpiresAt:   time.Now().Add(s.cfg.InvitationTTL),
+	}
+	err = s.store.Invitations.CreateInvitation(r.Context(), &invitation)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := newInvitationBody(invitation)
+	response.Token = token
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *server) listInvitationsHandler(w http.ResponseWriter, r *http.Request) {
+	invitations, err := s.store.Invitations.ListPendingInvitations(r.Context(), time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]invitationBody, len(invitations))
+	for i, invitation := range invitations {
+		response[i] = newInvitationBody(invitation)
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *server) deleteInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "invitationid")
+	if err != nil {
+		http.Error(w, "Invalid invitation ID", http.StatusBadRequest)
+		return
+	}
+
+	err = s.store.Invitations.DeleteInvitation(r.Context(), id)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Invitation not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// acceptInvitationHandler creates the account an invitation was issued for.
+func (s *server) acceptInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Token    string `json:"token"`
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil || body.Token == "" || body.Username == "" || body.Password == "" {
+		http.Error(w, "token, username and password are required", http.StatusBadRequest)
+		return
+	}
+
+	invitation, err := s.store.Invitations.GetInvitationByToken(r.Context(), hashToken(body.Token))
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Invalid invitation", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if invitation.UsedAt != nil || time.Now().After(invitation.ExpiresAt) {
+		http.Error(w, "Invitation has been used or has expired", http.StatusGone)
+		return
+	}
+
+	role, err := s.store.Roles.GetRoleByName(r.Context(), invitation.Role)
+	if err != nil {
+		http.Error(w, "Invitation role no longer exists", http.StatusConflict)
+		return
+	}
+
+	hashedPassword, err := hashPassword(body.Password)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	account := &store.NewAccount{
+		User: &store.User{
+			Username: body.Username,
+			Password: hashedPassword,
+			UserType: role.Name,
+			Email:    invitation.Email,
+		},
+		RoleID: role.ID,
+	}
+
+	// Link the profile the invitation was bound to, or create a new one
+	switch role.Name {
+	case "teacher":
+		account.Teacher = &store.Teacher{Username: body.Username, Name: invitation.Name}
+		account.Teacher.ID = invitation.ProfileID
+	case "ipm":
+		account.IPM = &store.IPM{Username: body.Username, Name: invitation.Name}
+		account.IPM.ID = invitation.ProfileID
+	}
+
+	err = s.store.Invitations.RedeemInvitation(r.Context(), invitation.ID, account)
+	if errors.Is(err, store.ErrDuplicate) {
+		http.Error(w, "Username already exists", http.StatusConflict)
+		return
+	}
+	if errors.Is(err, store.ErrConflict) {
+		http.Error(w, "Invitation has been used or its profile is already linked", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "User created successfully",
+	})
+}
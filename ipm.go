@@ -2,39 +2,27 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/gorilla/mux"
-	"gorm.io/gorm"
-)
-
-type IPM struct {
-	gorm.Model
-	Username string
-	Name     string
-}
 
-func getAllClaims(w http.ResponseWriter, r *http.Request) {
-	db, sqlDB, err := connectDB()
-	if err != nil {
-		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
-		return
-	}
-	defer sqlDB.Close()
+	"api/store"
+)
 
-	var claims []MedicalClaim
+func (s *server) getAllClaims(w http.ResponseWriter, r *http.Request) {
 	// Find all Claims where none of the ClaimReview has a status of "pending"
-	result := db.Preload("Student").Preload("ClaimReviews").Preload("ClaimReviews.Teacher").Preload("Files").Find(&claims, "id NOT IN (SELECT claim_id FROM claim_reviews WHERE status = 'pending')")
-	if result.Error != nil {
-		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+	claims, err := s.store.Claims.ListReviewedClaims(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	json.NewEncoder(w).Encode(claims)
 }
 
-func updateClaimStatus(w http.ResponseWriter, r *http.Request) {
+func (s *server) updateClaimStatus(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	claimId, err := strconv.Atoi(vars["claimid"])
 	if err != nil {
@@ -43,32 +31,22 @@ func updateClaimStatus(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Parse JSON
-	var medicalclaim MedicalClaim
+	var medicalclaim store.MedicalClaim
 	err = json.NewDecoder(r.Body).Decode(&medicalclaim)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	db, sqlDB, err := connectDB()
-	if err != nil {
-		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
-		return
-	}
-	defer sqlDB.Close()
-
-	// Find the claim
-	var claim MedicalClaim
-	result := db.First(&claim, claimId)
-	if result.Error != nil {
-		http.Error(w, result.Error.Error(), http.StatusNotFound)
+	// Update the claim
+	p := principalFrom(r.Context())
+	claim, err := s.store.Claims.UpdateClaimStatus(r.Context(), uint(claimId), medicalclaim.Status, medicalclaim.Message, p.UserID)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
-
-	// Update the claim
-	result = db.Model(&claim).Updates(medicalclaim)
-	if result.Error != nil {
-		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
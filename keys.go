@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+
+	"api/store"
+)
+
+const (
+	// keyReloadInterval is how long an instance signs with its cached key set
+	// before rereading it, so that keys rotated elsewhere are picked up.
+	keyReloadInterval = time.Minute
+	// keyMissReload limits how often a token with an unknown kid can make us
+	// reread the key set.
+	keyMissReload = 10 * time.Second
+	rsaKeyBits    = 2048
+)
+
+// signingKey is a parsed store.SigningKey.
+type signingKey struct {
+	kid      string
+	method   jwt.SigningMethod
+	private  crypto.Signer
+	activeAt time.Time
+}
+
+// keySet caches the signing keys of the store.
+type keySet struct {
+	store store.SigningKeyStore
+
+	mu       sync.Mutex
+	keys     []signingKey // In the order they become active
+	loadedAt time.Time
+}
+
+func newKeySet(keys store.SigningKeyStore) *keySet {
+	return &keySet{store: keys}
+}
+
+func signingMethod(alg string) (jwt.SigningMethod, error) {
+	switch alg {
+	case jwt.SigningMethodRS256.Alg():
+		return jwt.SigningMethodRS256, nil
+	case signingMethodEd25519.Alg():
+		return signingMethodEd25519, nil
+	}
+	return nil, fmt.Errorf("unsupported signing algorithm %q", alg)
+}
+
+func parseSigningKey(key store.SigningKey) (signingKey, error) {
+	method, err := signingMethod(key.Algorithm)
+	if err != nil {
+		return signingKey{}, err
+	}
+	block, _ := pem.Decode([]byte(key.PrivateKey))
+	if block == nil {
+		return signingKey{}, fmt.Errorf("signing key %s: invalid PEM", key.KID)
+	}
+	private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return signingKey{}, fmt.Errorf("signing key %s: %v", key.KID, err)
+	}
+	signer, ok := private.(crypto.Signer)
+	if !ok {
+		return signingKey{}, fmt.Errorf("signing key %s: unsupported key type", key.KID)
+	}
+	return signingKey{kid: key.KID, method: method, private: signer, activeAt: key.ActiveAt}, nil
+}
+
+// reload rereads the key set. The caller holds k.mu.
+func (k *keySet) reload(ctx context.Context) error {
+	stored, err := k.store.ListSigningKeys(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+	keys := make([]signingKey, 0, len(stored))
+	for _, key := range stored {
+		parsed, err := parseSigningKey(key)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, parsed)
+	}
+	k.keys = keys
+	k.loadedAt = time.Now()
+	return nil
+}
+
+// all returns every published key, rereading the set when it is stale.
+func (k *keySet) all(ctx context.Context) ([]signingKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if time.Since(k.loadedAt) >= keyReloadInterval {
+		if err := k.reload(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return k.keys, nil
+}
+
+// signer returns the newest key that is already active.
+func (k *keySet) signer(ctx context.Context) (*signingKey, error) {
+	keys, err := k.all(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for i := len(keys) - 1; i >= 0; i-- {
+		if !keys[i].activeAt.After(now) {
+			return &keys[i], nil
+		}
+	}
+	return nil, errors.New("no active signing key")
+}
+
+// verifier returns the key kid. An unknown kid rereads the set, at most once
+// every keyMissReload, in case another instance just rotated.
+func (k *keySet) verifier(ctx context.Context, kid string) (*signingKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	for attempt := 0; ; attempt++ {
+		for i := range k.keys {
+			if k.keys[i].kid == kid {
+				return &k.keys[i], nil
+			}
+		}
+		if attempt > 0 || time.Since(k.loadedAt) < keyMissReload {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		if err := k.reload(ctx); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// signJWT signs claims with the current signing key.
+func (s *server) signJWT(ctx context.Context, claims jwt.Claims) (string, error) {
+	key, err := s.keys.signer(ctx)
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.kid
+	return token.SignedString(key.private)
+}
+
+// maxTokenTTL is how long a retired key stays published: long enough to
+// verify every token it signed, including those signed by instances that had
+// not yet reloaded the key set.
+func (s *server) maxTokenTTL() time.Duration {
+	ttl := s.cfg.AccessTokenTTL
+	if s.cfg.MFAChallengeTTL > ttl {
+		ttl = s.cfg.MFAChallengeTTL
+	}
+	return ttl + keyReloadInterval
+}
+
+// generateSigningKey creates a key pair for the configured algorithm.
+func generateSigningKey(alg string) (*store.SigningKey, error) {
+	var private crypto.Signer
+	var err error
+	switch alg {
+	case jwt.SigningMethodRS256.Alg():
+		private, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	case signingMethodEd25519.Alg():
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		err = fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+	kid, err := newOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	return &store.SigningKey{
+		KID:        kid[:16],
+		Algorithm:  alg,
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+	}, nil
+}
+
+// rotateSigningKey adds a new key that starts signing at activeAt and
+// schedules the current keys to expire once its tokens can no longer be valid.
+// It returns store.ErrConflict if another instance rotated concurrently.
+func (s *server) rotateSigningKey(ctx context.Context, activeAt time.Time) (*store.SigningKey, error) {
+	key, err := generateSigningKey(s.cfg.JWTAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	key.ActiveAt = activeAt
+
+	s.keys.mu.Lock()
+	defer s.keys.mu.Unlock()
+
+	if err := s.keys.reload(ctx); err != nil {
+		return nil, err
+	}
+	previous := ""
+	if len(s.keys.keys) > 0 {
+		previous = s.keys.keys[len(s.keys.keys)-1].kid
+	}
+	if err := s.store.Keys.AddSigningKey(ctx, key, previous, s.maxTokenTTL()); err != nil {
+		return nil, err
+	}
+	return key, s.keys.reload(ctx)
+}
+
+// checkSigningKeys creates the first signing key, publishes the next one
+// JWTKeyPublishAhead before the current one is due for rotation, and removes
+// expired keys.
+func (s *server) checkSigningKeys(ctx context.Context) error {
+	if err := s.store.Keys.PurgeExpiredSigningKeys(ctx, time.Now()); err != nil {
+		return err
+	}
+
+	s.keys.mu.Lock()
+	err := s.keys.reload(ctx)
+	keys := s.keys.keys
+	s.keys.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var activeAt time.Time
+	switch {
+	case len(keys) == 0:
+		activeAt = now
+	case !keys[len(keys)-1].activeAt.After(now) &&
+		now.Sub(keys[len(keys)-1].activeAt) >= s.cfg.JWTKeyRotation-s.cfg.JWTKeyPublishAhead:
+		activeAt = now.Add(s.cfg.JWTKeyPublishAhead)
+	default:
+		return nil
+	}
+
+	key, err := s.rotateSigningKey(ctx, activeAt)
+	if errors.Is(err, store.ErrConflict) {
+		// Another instance rotated first
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("Added signing key %s, active from %s", key.KID, key.ActiveAt.Format(time.RFC3339))
+	return nil
+}
+
+// rotateSigningKeys periodically rotates the signing keys.
+func (s *server) rotateSigningKeys(interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := s.checkSigningKeys(context.Background()); err != nil {
+			log.Printf("Failed to rotate signing keys: %v", err)
+		}
+	}
+}
+
+// jwk is a public key in JSON Web Key format (RFC 7517).
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`   // RSA modulus
+	E   string `json:"e,omitempty"`   // RSA exponent
+	Crv string `json:"crv,omitempty"` // OKP curve
+	X   string `json:"x,omitempty"`   // OKP public key
+}
+
+func newJWK(key signingKey) jwk {
+	k := jwk{Kid: key.kid, Use: "sig", Alg: key.method.Alg()}
+	switch public := key.private.Public().(type) {
+	case *rsa.PublicKey:
+		k.Kty = "RSA"
+		k.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+		k.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+	case ed25519.PublicKey:
+		k.Kty = "OKP"
+		k.Crv = "Ed25519"
+		k.X = base64.RawURLEncoding.EncodeToString(public)
+	}
+	return k
+}
+
+// jwksHandler publishes the public keys that verify our tokens, including the
+// next key before it starts signing.
+func (s *server) jwksHandler(w http.ResponseWriter, r *http.Request) {
+	keys, err := s.keys.all(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	body := struct {
+		Keys []jwk `json:"keys"`
+	}{Keys: []jwk{}}
+	for _, key := range keys {
+		body.Keys = append(body.Keys, newJWK(key))
+	}
+
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(keyReloadInterval/time.Second)))
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"api/store"
+)
+
+// loginEventBody is how login events are shown to admins.
+type loginEventBody struct {
+	Time      time.Time `json:"time"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Success   bool      `json:"success"`
+	Reason    string    `json:"reason,omitempty"`
+}
+
+// clientIP returns the IP address the request came from.
+func (s *server) clientIP(r *http.Request) string {
+	if s.cfg.TrustProxyHeaders {
+		// The proxy appends the address it saw; anything before it is
+		// client-supplied
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			parts := strings.Split(forwarded, ",")
+			return strings.TrimSpace(parts[len(parts)-1])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// loginDelay waits longer the more failed logins came before, so that
+// guessing passwords gets progressively slower.
+func (s *server) loginDelay(ctx context.Context, failures int) {
+	if failures <= 0 || s.cfg.Login.Delay <= 0 {
+		return
+	}
+
+	delay := time.Duration(float64(s.cfg.Login.Delay) * math.Pow(2, float64(failures-1)))
+	if delay > s.cfg.Login.MaxDelay || delay <= 0 {
+		delay = s.cfg.Login.MaxDelay
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+// recordLogin saves a login attempt; an empty reason means it succeeded.
+// Failing to record an attempt does not fail the login.
+func (s *server) recordLogin(ctx context.Context, attempt *store.LoginEvent, reason string) {
+	attempt.Success = reason == ""
+	attempt.Reason = reason
+	if err := s.store.Logins.RecordLoginEvent(ctx, attempt); err != nil {
+		log.Printf("Failed to record login event for %s: %v", attempt.Username, err)
+	}
+}
+
+// tooManyAttempts refuses a login that is locked out for retryAfter.
+func tooManyAttempts(w http.ResponseWriter, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	http.Error(w, "Too many failed login attempts, try again later", http.StatusTooManyRequests)
+}
+
+// unlockUserHandler lifts a lockout caused by failed logins.
+func (s *server) unlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	userId, err := pathID(r, "userid")
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	err = s.store.Users.ClearLoginFailures(r.Context(), userId)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listLoginEventsHandler returns a user's recent login attempts, newest
+// first. ?limit= picks how many, up to 500.
+func (s *server) listLoginEventsHandler(w http.ResponseWriter, r *http.Request) {
+	userId, err := pathID(r, "userid")
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	limit := 50
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > 500 {
+			http.Error(w, "limit must be between 1 and 500", http.StatusBadRequest)
+			return
+		}
+	}
+
+	events, err := s.store.Logins.ListLoginEvents(r.Context(), userId, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]loginEventBody, len(events))
+	for i, event := range events {
+		response[i] = loginEventBody{
+			Time:      event.CreatedAt,
+			IP:        event.IP,
+			UserAgent: event.UserAgent,
+			Success:   event.Success,
+			Reason:    event.Reason,
+		}
+	}
+	json.NewEncoder(w).Encode(response)
+}
@@ -1,96 +1,243 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"time"
 
-	"github.com/gorilla/mux"
-	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 	"github.com/rs/cors"
+
+	"api/migrate"
+	"api/store"
 )
 
-func initDB() {
-	db, sqlDB, err := connectDB()
+// server holds the dependencies shared by every handler.
+type server struct {
+	cfg      *Config
+	store    *store.Store
+	notifier Notifier
+	oidc     *oidcProvider // Nil when single sign-on is not configured
+	keys     *keySet
+}
+
+func initDB(sqlDB *sql.DB) {
+	migrator, err := migrate.New(sqlDB)
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		log.Fatalf("Error loading migrations: %v", err)
 	}
-	defer sqlDB.Close()
 
-	// Perform the migration
-	if err := db.AutoMigrate(&User{}, &Student{}, &Attendance{}, &MedicalClaim{}, &Teacher{}, &ClaimReview{}, &File{}, &IPM{}); err != nil {
-		log.Fatalf("Error auto migrating tables: %v", err)
+	// Apply any pending migrations
+	applied, err := migrator.Up(context.Background())
+	if err != nil {
+		log.Fatalf("Error migrating database: %v", err)
+	}
+	for _, m := range applied {
+		fmt.Printf("Applied migration %d_%s\n", m.Version, m.Name)
 	}
 
 	// Print Success
 	fmt.Println("Database initialization successful.")
 }
 
-func initServer() {
-	router := mux.NewRouter()
-
-	// Register unprotected routes
-	router.HandleFunc("/login", loginHandler).Methods("POST")
-	router.HandleFunc("/register", registerHandler).Methods("POST")
-
-	// /student routes
-	studentRouter := router.PathPrefix("/student").Subrouter()
-	studentRouter.Use(authorizeRole("student"))
-	studentRouter.HandleFunc("/create", createStudentInfo).Methods("POST")
-	studentRouter.HandleFunc("/info", getStudentInfo).Methods("GET")
-
-	// /attendance routes
-	attendanceRouter := router.PathPrefix("/attendance").Subrouter()
-	attendanceRouter.HandleFunc("/create", func(w http.ResponseWriter, r *http.Request) {
-		authorizeRole("admin")(http.HandlerFunc(createAttendanceHandler)).ServeHTTP(w, r)
-	}).Methods("POST")
-
-	// /claims routes
-	claimsRouter := router.PathPrefix("/claims").Subrouter()
-	claimsRouter.HandleFunc("/create", createMedicalClaim).Methods("POST")
-	claimsRouter.HandleFunc("/{claimid}", getMedicalClaimByIdHandler).Methods("GET")
-	claimsRouter.HandleFunc("/", getClaimsByStudentHandler).Methods("GET")
-
-	// /teacher routes
-	teacherRouter := router.PathPrefix("/teacher").Subrouter()
-	teacherRouter.HandleFunc("/self", getTeacherByTokenHandler).Methods("GET")
-	teacherRouter.HandleFunc("/create", createTeacherHandler).Methods("POST")
-	teacherRouter.HandleFunc("/claims", getClaimsByTeacherHandler).Methods("GET")
-	teacherRouter.HandleFunc("/claims/{claimid}", putClaimReviewHandler).Methods("PUT")
-
-	// /ipm routes
-	ipmRouter := router.PathPrefix("/ipm").Subrouter()
-	ipmRouter.HandleFunc("/claims", getAllClaims).Methods("GET")
-	ipmRouter.HandleFunc("/claims/{claimid}", updateClaimStatus).Methods("PUT")
-
-	// Apply other middleware to the router
-	router.Use(jsonContentTypeMiddleware)
-	router.Use(loggingMiddleware)
-
-	err := godotenv.Load(".env")
+// runMigrate implements the "migrate up|down|status" command.
+func runMigrate(sqlDB *sql.DB, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: migrate up|down|status")
+	}
+
+	migrator, err := migrate.New(sqlDB)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, m := range applied {
+			fmt.Printf("Applied migration %d_%s\n", m.Version, m.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("Database is up to date.")
+		}
+		return err
+	case "down":
+		reverted, err := migrator.Down(ctx)
+		if err != nil {
+			return err
+		}
+		if reverted == nil {
+			fmt.Println("No migrations to revert.")
+			return nil
+		}
+		fmt.Printf("Reverted migration %d_%s\n", reverted.Version, reverted.Name)
+		return nil
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			state := "pending"
+			if status.AppliedAt != nil {
+				state = "applied " + status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d_%-30s %s\n", status.Version, status.Name, state)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command %q", args[0])
+	}
+}
+
+// runInvite implements the "invite <role> [name]" command, which prints an
+// invitation token. It is how the first admin account gets created.
+func runInvite(s *server, args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return fmt.Errorf("usage: invite <role> [name]")
+	}
+	ctx := context.Background()
+
+	if _, err := s.store.Roles.GetRoleByName(ctx, args[0]); err != nil {
+		return fmt.Errorf("role %q: %v", args[0], err)
+	}
 
+	token, err := newOpaqueToken()
 	if err != nil {
-		fmt.Println("Error loading .env file")
+		return err
+	}
+	invitation := store.Invitation{
+		TokenHash: hashToken(token),
+		Role:      args[0],
+		ExpiresAt: time.Now().Add(s.cfg.InvitationTTL),
+	}
+	if len(args) == 2 {
+		invitation.Name = args[1]
+	}
+	if err := s.store.Invitations.CreateInvitation(ctx, &invitation); err != nil {
+		return err
 	}
 
+	fmt.Printf("Invitation token for a %s account (expires %s):\n%s\n",
+		invitation.Role, invitation.ExpiresAt.Format(time.RFC3339), token)
+	return nil
+}
+
+// runKeys implements the "keys list|rotate" command. rotate replaces the
+// signing key immediately, e.g. when the current one may have leaked.
+func runKeys(s *server, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: keys list|rotate")
+	}
+	ctx := context.Background()
+
+	switch args[0] {
+	case "list":
+		keys, err := s.store.Keys.ListSigningKeys(ctx, time.Now())
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			expires := "-"
+			if key.ExpiresAt != nil {
+				expires = key.ExpiresAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%-16s %-6s active %s expires %s\n", key.KID, key.Algorithm, key.ActiveAt.Format(time.RFC3339), expires)
+		}
+		return nil
+	case "rotate":
+		key, err := s.rotateSigningKey(ctx, time.Now())
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Signing key %s (%s) is now active.\n", key.KID, key.Algorithm)
+		return nil
+	default:
+		return fmt.Errorf("unknown keys command %q", args[0])
+	}
+}
+
+func initServer(s *server) {
+	router := s.routes()
+
 	corsWrapper := cors.New(cors.Options{
-		AllowedOrigins: []string{os.Getenv("FRONTEND_URL")},
+		AllowedOrigins: []string{s.cfg.FrontendURL},
 		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowedHeaders: []string{"Authorization", "Content-Type"},
+		// The frontend sends the single sign-on state cookie back
+		AllowCredentials: true,
 	})
 
 	handler := corsWrapper.Handler(router)
 
+	// Clean up expired refresh and revoked tokens in the background
+	go s.purgeExpiredTokens(time.Hour)
+	go s.rotateSigningKeys(time.Hour)
+
 	// Print the message
-	fmt.Println("Server starting on http://localhost:8000...")
+	fmt.Printf("Server starting on %s...\n", s.cfg.ListenAddr)
 
 	// Start the server
-	log.Fatal(http.ListenAndServe(":8000", handler))
+	log.Fatal(http.ListenAndServe(s.cfg.ListenAddr, handler))
 }
 
 func main() {
-	initDB()
-	initServer()
+	cfg, args, err := loadConfig(os.Args[1:])
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	db, err := openDB(cfg)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer sqlDB.Close()
+
+	if len(args) > 0 && args[0] == "migrate" {
+		if err := runMigrate(sqlDB, args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	notifier, err := newNotifier(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	initDB(sqlDB)
+	s := &server{cfg: cfg, store: store.NewPostgres(db), notifier: notifier}
+	s.keys = newKeySet(s.store.Keys)
+	if cfg.OIDC.Issuer != "" {
+		s.oidc = newOIDCProvider(cfg.OIDC)
+	}
+
+	if len(args) > 0 && args[0] == "invite" {
+		if err := runInvite(s, args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if len(args) > 0 && args[0] == "keys" {
+		if err := runKeys(s, args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// Make sure there is a key to sign tokens with before serving
+	if err := s.checkSigningKeys(context.Background()); err != nil {
+		log.Fatalf("Failed to load signing keys: %v", err)
+	}
+
+	initServer(s)
 }
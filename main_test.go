@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"api/migrate"
+	"api/store"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestMain(m *testing.M) {
+	// The request logging would bury the test output
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// testPassword is the password of every user made by createUser.
+const testPassword = "correct horse battery staple"
+
+// testServer runs the routes against the memory store.
+type testServer struct {
+	*server
+	t       *testing.T
+	handler http.Handler
+	sent    sentNotifications
+}
+
+// newTestServer returns a server configured from values on top of the test
+// defaults, with the roles the migrations seed.
+func newTestServer(t *testing.T, values configValues) *testServer {
+	t.Helper()
+	v := configValues{
+		"JWT_ALGORITHM": "EdDSA",
+		"LOGIN_DELAY":   "0s",
+	}
+	for key, value := range values {
+		v[key] = value
+	}
+	cfg, err := parseConfig(v)
+	if err != nil {
+		t.Fatalf("parseConfig: %v", err)
+	}
+
+	sent := make(sentNotifications, 16)
+	s := &server{cfg: cfg, store: store.NewMemory(), notifier: sent}
+	s.keys = newKeySet(s.store.Keys)
+	if err := s.checkSigningKeys(context.Background()); err != nil {
+		t.Fatalf("checkSigningKeys: %v", err)
+	}
+	for name, permissions := range seededRoles(t) {
+		role := &store.Role{Name: name}
+		for _, permission := range permissions {
+			role.Permissions = append(role.Permissions, store.RolePermission{Permission: permission})
+		}
+		if err := s.store.Roles.CreateRole(context.Background(), role); err != nil {
+			t.Fatalf("CreateRole %s: %v", name, err)
+		}
+	}
+	return &testServer{server: s, t: t, handler: s.routes(), sent: sent}
+}
+
+// seedValues matches the (role, permission) rows of the VALUES list the
+// roles are first seeded from, seedSelect the single grants added later.
+var (
+	seedValues = regexp.MustCompile(`\('([a-z]+)', '([a-z]+:[a-z]+)'\)`)
+	seedSelect = regexp.MustCompile(`SELECT id, '([a-z]+:[a-z]+)' FROM roles WHERE name = '([a-z]+)'`)
+)
+
+// seededRoles returns the permissions of each role as the up migrations
+// seed them, so the tests run with the roles a migrated database has.
+func seededRoles(t *testing.T) map[string][]string {
+	t.Helper()
+	migrations, err := migrate.Load(os.DirFS("migrate"), "migrations")
+	if err != nil {
+		t.Fatalf("loading migrations: %v", err)
+	}
+	roles := make(map[string][]string)
+	grant := func(role string, permission string) {
+		if !isKnownPermission(permission) {
+			t.Fatalf("migrations grant unknown permission %q to %s", permission, role)
+		}
+		roles[role] = append(roles[role], permission)
+	}
+	for _, m := range migrations {
+		for _, match := range seedValues.FindAllStringSubmatch(m.Up, -1) {
+			grant(match[1], match[2])
+		}
+		for _, match := range seedSelect.FindAllStringSubmatch(m.Up, -1) {
+			grant(match[2], match[1])
+		}
+	}
+	if len(roles) == 0 {
+		t.Fatal("migrations seed no roles")
+	}
+	return roles
+}
+
+// createUser adds a user with the role and a profile to match it.
+func (ts *testServer) createUser(username string, userType string) *store.User {
+	ts.t.Helper()
+	ctx := context.Background()
+	role, err := ts.store.Roles.GetRoleByName(ctx, userType)
+	if err != nil {
+		ts.t.Fatalf("GetRoleByName %s: %v", userType, err)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+
+	user := &store.User{
+		Username: username,
+		Password: string(hash),
+		Email:    username + "@example.edu",
+		UserType: userType,
+	}
+	if err := ts.store.Users.CreateUser(ctx, user); err != nil {
+		ts.t.Fatalf("CreateUser %s: %v", username, err)
+	}
+	if err := ts.store.Roles.AssignRole(ctx, user.ID, role.ID); err != nil {
+		ts.t.Fatalf("AssignRole %s: %v", username, err)
+	}
+	switch userType {
+	case "student":
+		err = ts.store.Students.CreateStudent(ctx, &store.Student{Username: username, Name: username, RegisterNumber: username})
+	case "teacher":
+		err = ts.store.Teachers.CreateTeacher(ctx, &store.Teacher{Username: username, Name: username})
+	}
+	if err != nil {
+		ts.t.Fatalf("creating profile of %s: %v", username, err)
+	}
+	return user
+}
+
+// login signs in with testPassword and returns the tokens.
+func (ts *testServer) login(username string) tokenResponse {
+	ts.t.Helper()
+	var tokens tokenResponse
+	ts.request("POST", "/login", "", map[string]string{"username": username, "password": testPassword}, http.StatusOK, &tokens)
+	if tokens.Token == "" {
+		ts.t.Fatalf("login %s: no token", username)
+	}
+	return tokens
+}
+
+// request sends body as JSON with token as the bearer credential, fails the
+// test unless the response has the status, and decodes it into out if set.
+func (ts *testServer) request(method string, path string, token string, body interface{}, status int, out interface{}) *httptest.ResponseRecorder {
+	ts.t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			ts.t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return ts.do(req, status, out)
+}
+
+// do serves req, fails the test unless the response has the status, and
+// decodes it into out if set.
+func (ts *testServer) do(req *http.Request, status int, out interface{}) *httptest.ResponseRecorder {
+	ts.t.Helper()
+	rec := httptest.NewRecorder()
+	ts.handler.ServeHTTP(rec, req)
+
+	if rec.Code != status {
+		ts.t.Fatalf("%s %s: got %d, want %d: %s", req.Method, req.URL, rec.Code, status, strings.TrimSpace(rec.Body.String()))
+	}
+	if out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			ts.t.Fatalf("%s %s: decoding %q: %v", req.Method, req.URL, rec.Body.String(), err)
+		}
+	}
+	return rec
+}
+
+// sentNotifications records notifications instead of delivering them.
+type sentNotifications chan Notification
+
+func (n sentNotifications) Notify(ctx context.Context, notification Notification) error {
+	n <- notification
+	return nil
+}
+
+// notification waits for the next notification the server sends, which
+// happens in the background.
+func (ts *testServer) notification() Notification {
+	ts.t.Helper()
+	select {
+	case n := <-ts.sent:
+		return n
+	case <-time.After(5 * time.Second):
+		ts.t.Fatal("no notification was sent")
+		return Notification{}
+	}
+}
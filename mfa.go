@@ -0,0 +1,392 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"golang.org/x/crypto/bcrypt"
+
+	"api/store"
+)
+
+// mfaAudience marks MFA challenge tokens so they cannot be used as access
+// tokens.
+const mfaAudience = "mfa"
+
+// recoveryCodeCount is how many recovery codes a user gets at a time.
+const recoveryCodeCount = 10
+
+// mfaChallengeResponse is returned by /login instead of tokens when the
+// account has two-factor authentication enabled.
+type mfaChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+	ExpiresIn   int64  `json:"expires_in"` // Challenge lifetime in seconds
+}
+
+// mfaRequired reports whether users of role must use two-factor
+// authentication.
+func (s *server) mfaRequired(role string) bool {
+	return slices.Contains(s.cfg.MFARequiredRoles, role)
+}
+
+// mfaChallenge answers a correct password with a short-lived token that
+// /login/mfa exchanges, together with a code, for the real tokens.
+func (s *server) mfaChallenge(w http.ResponseWriter, r *http.Request, user *store.User) {
+	now := time.Now()
+	claims := jwt.StandardClaims{
+		Subject:   strconv.FormatUint(uint64(user.ID), 10),
+		Audience:  mfaAudience,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(s.cfg.MFAChallengeTTL).Unix(),
+		Issuer:    s.cfg.JWTIssuer,
+	}
+	token, err := s.signJWT(r.Context(), claims)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(mfaChallengeResponse{
+		MFARequired: true,
+		MFAToken:    token,
+		ExpiresIn:   int64(s.cfg.MFAChallengeTTL / time.Second),
+	})
+}
+
+// verifyMFAChallenge returns the ID of the user a challenge token was issued to.
+func (s *server) verifyMFAChallenge(ctx context.Context, tokenString string) (uint, error) {
+	claims := &jwt.StandardClaims{}
+	if err := s.parseJWT(ctx, tokenString, claims); err != nil {
+		return 0, err
+	}
+	if claims.Audience != mfaAudience {
+		return 0, errors.New("not an MFA challenge")
+	}
+	userId, err := strconv.ParseUint(claims.Subject, 10, 64)
+	if err != nil {
+		return 0, errors.New("invalid token subject")
+	}
+	return uint(userId), nil
+}
+
+// checkSecondFactor verifies a TOTP code, or failing that a recovery code,
+// and uses it up.
+func (s *server) checkSecondFactor(ctx context.Context, user *store.User, code string, recoveryCode string) (bool, error) {
+	if code != "" {
+		step, ok := verifyTOTP(user.TOTPSecret, code, time.Now())
+		if !ok {
+			return false, nil
+		}
+		err := s.store.MFA.UseTOTPStep(ctx, user.ID, step)
+		if errors.Is(err, store.ErrConflict) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	if recoveryCode != "" {
+		err := s.store.MFA.UseRecoveryCode(ctx, user.ID, hashToken(normalizeRecoveryCode(recoveryCode)))
+		if errors.Is(err, store.ErrNotFound) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	return false, nil
+}
+
+// newRecoveryCodes returns fresh recovery codes and the hashes to store.
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 6)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(base32.StdEncoding.EncodeToString(b))[:10]
+		codes[i] = code[:5] + "-" + code[5:]
+		hashes[i] = hashToken(code)
+	}
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode ignores case and the separators users may type.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// loginMFAHandler finishes a login started at /login with a TOTP code or a
+// recovery code.
+func (s *server) loginMFAHandler(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		MFAToken     string `json:"mfa_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil || body.MFAToken == "" || (body.Code == "" && body.RecoveryCode == "") {
+		http.Error(w, "mfa_token and code or recovery_code are required", http.StatusBadRequest)
+		return
+	}
+
+	userId, err := s.verifyMFAChallenge(r.Context(), body.MFAToken)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	user, err := s.store.Users.GetUser(r.Context(), userId)
+	if err != nil || !user.TOTPEnabled {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if user.Disabled {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	attempt := &store.LoginEvent{
+		UserID:    &user.ID,
+		Username:  user.Username,
+		IP:        s.clientIP(r),
+		UserAgent: r.UserAgent(),
+	}
+
+	// Wrong codes count towards the same lockout as wrong passwords
+	if user.LockedUntil != nil && time.Now().Before(*user.LockedUntil) {
+		s.recordLogin(r.Context(), attempt, "locked")
+		tooManyAttempts(w, time.Until(*user.LockedUntil))
+		return
+	}
+	s.loginDelay(r.Context(), user.FailedLogins)
+
+	ok, err := s.checkSecondFactor(r.Context(), user, body.Code, body.RecoveryCode)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		_, err = s.store.Users.RecordLoginFailure(r.Context(), user.ID, s.cfg.Login.MaxFailures, s.cfg.Login.Lockout)
+		if err != nil {
+			log.Printf("Failed to record login failure for %s: %v", user.Username, err)
+		}
+		s.recordLogin(r.Context(), attempt, "bad_mfa_code")
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	s.completeLogin(w, r, user, attempt)
+}
+
+func (s *server) getMFAStatusHandler(w http.ResponseWriter, r *http.Request) {
+	p := principalFrom(r.Context())
+
+	remaining, err := s.store.MFA.CountRecoveryCodes(r.Context(), p.UserID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"enabled":             p.MFA,
+		"required":            s.mfaRequired(p.Role),
+		"recovery_codes_left": remaining,
+	})
+}
+
+// enrollMFAHandler starts TOTP enrollment. The returned URI is meant to be
+// shown as a QR code; enrollment finishes at /mfa/confirm.
+func (s *server) enrollMFAHandler(w http.ResponseWriter, r *http.Request) {
+	p := principalFrom(r.Context())
+
+	secret, err := newTOTPSecret()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	err = s.store.MFA.SetTOTPSecret(r.Context(), p.UserID, secret)
+	if errors.Is(err, store.ErrConflict) {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"secret": secret,
+		"uri":    totpURI(s.cfg.MFAIssuer, p.Username, secret),
+	})
+}
+
+// confirmMFAHandler enables TOTP once the user proves their authenticator
+// works, and returns their recovery codes. They are shown only this once.
+func (s *server) confirmMFAHandler(w http.ResponseWriter, r *http.Request) {
+	p := principalFrom(r.Context())
+
+	var body struct {
+		Code string `json:"code"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil || body.Code == "" {
+		http.Error(w, "code is required", http.StatusBadRequest)
+		return
+	}
+
+	user, err := s.store.Users.GetUser(r.Context(), p.UserID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if user.TOTPEnabled || user.TOTPSecret == "" {
+		http.Error(w, "Start enrollment at /mfa/enroll first", http.StatusConflict)
+		return
+	}
+	step, ok := verifyTOTP(user.TOTPSecret, body.Code, time.Now())
+	if !ok {
+		http.Error(w, "Invalid code", http.StatusBadRequest)
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	err = s.store.MFA.EnableTOTP(r.Context(), user.ID, step, hashes)
+	if errors.Is(err, store.ErrConflict) {
+		http.Error(w, "Start enrollment at /mfa/enroll first", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string][]string{"recovery_codes": codes})
+}
+
+// regenerateRecoveryCodesHandler replaces the user's recovery codes.
+func (s *server) regenerateRecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	p := principalFrom(r.Context())
+
+	var body struct {
+		Code string `json:"code"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil || body.Code == "" {
+		http.Error(w, "code is required", http.StatusBadRequest)
+		return
+	}
+
+	user, err := s.store.Users.GetUser(r.Context(), p.UserID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !user.TOTPEnabled {
+		http.Error(w, "Two-factor authentication is not enabled", http.StatusConflict)
+		return
+	}
+	ok, err := s.checkSecondFactor(r.Context(), user, body.Code, "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "Invalid code", http.StatusForbidden)
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := s.store.MFA.ReplaceRecoveryCodes(r.Context(), user.ID, hashes); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string][]string{"recovery_codes": codes})
+}
+
+// disableMFAHandler turns TOTP off after checking the password and a code.
+// Users whose role requires it cannot turn it off.
+func (s *server) disableMFAHandler(w http.ResponseWriter, r *http.Request) {
+	p := principalFrom(r.Context())
+
+	var body struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil || body.Password == "" || body.Code == "" {
+		http.Error(w, "password and code are required", http.StatusBadRequest)
+		return
+	}
+	if s.mfaRequired(p.Role) {
+		http.Error(w, "Two-factor authentication is required for your role", http.StatusForbidden)
+		return
+	}
+
+	user, err := s.store.Users.GetUser(r.Context(), p.UserID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !user.TOTPEnabled {
+		http.Error(w, "Two-factor authentication is not enabled", http.StatusConflict)
+		return
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(body.Password)) != nil {
+		http.Error(w, "Invalid password or code", http.StatusForbidden)
+		return
+	}
+	ok, err := s.checkSecondFactor(r.Context(), user, body.Code, "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "Invalid password or code", http.StatusForbidden)
+		return
+	}
+
+	if err := s.store.MFA.DisableTOTP(r.Context(), user.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// resetUserMFAHandler lets an admin turn off TOTP for a user who lost their
+// authenticator and recovery codes, so they can enroll again.
+func (s *server) resetUserMFAHandler(w http.ResponseWriter, r *http.Request) {
+	userId, err := pathID(r, "userid")
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	if _, err := s.store.Users.GetUser(r.Context(), userId); err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	if err := s.store.MFA.DisableTOTP(r.Context(), userId); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
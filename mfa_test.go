@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// enrollMFA turns on TOTP for the holder of token and returns the secret,
+// the time step of the code used to confirm it, and the recovery codes.
+func (ts *testServer) enrollMFA(token string) (string, int64, []string) {
+	ts.t.Helper()
+	var enrollment struct {
+		Secret string `json:"secret"`
+	}
+	ts.request("POST", "/mfa/enroll", token, nil, http.StatusOK, &enrollment)
+
+	step := totpStep(time.Now())
+	code, err := totpCode(enrollment.Secret, step)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	var confirmed struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	ts.request("POST", "/mfa/confirm", token, map[string]string{"code": code}, http.StatusOK, &confirmed)
+	if len(confirmed.RecoveryCodes) == 0 {
+		ts.t.Fatal("no recovery codes")
+	}
+	return enrollment.Secret, step, confirmed.RecoveryCodes
+}
+
+// mfaChallenge signs in with the password and returns the challenge token.
+func (ts *testServer) mfaChallenge(username string) string {
+	ts.t.Helper()
+	var challenge mfaChallengeResponse
+	ts.request("POST", "/login", "", map[string]string{"username": username, "password": testPassword}, http.StatusOK, &challenge)
+	if !challenge.MFARequired || challenge.MFAToken == "" {
+		ts.t.Fatalf("login %s: no MFA challenge", username)
+	}
+	return challenge.MFAToken
+}
+
+func TestMFALogin(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ts.createUser("alice", "student")
+	secret, step, _ := ts.enrollMFA(ts.login("alice").Token)
+
+	challenge := ts.mfaChallenge("alice")
+	ts.request("POST", "/login/mfa", "", map[string]string{"mfa_token": challenge, "code": "000000x"}, http.StatusUnauthorized, nil)
+
+	// The code used to confirm enrollment cannot be replayed
+	used, _ := totpCode(secret, step)
+	ts.request("POST", "/login/mfa", "", map[string]string{"mfa_token": challenge, "code": used}, http.StatusUnauthorized, nil)
+
+	code, _ := totpCode(secret, step+1)
+	var tokens tokenResponse
+	ts.request("POST", "/login/mfa", "", map[string]string{"mfa_token": challenge, "code": code}, http.StatusOK, &tokens)
+	ts.request("GET", "/student/info", tokens.Token, nil, http.StatusOK, nil)
+
+	ts.request("POST", "/login/mfa", "", map[string]string{"mfa_token": ts.mfaChallenge("alice"), "code": code}, http.StatusUnauthorized, nil)
+}
+
+func TestMFARecoveryCodeUsedOnce(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ts.createUser("alice", "student")
+	_, _, recoveryCodes := ts.enrollMFA(ts.login("alice").Token)
+
+	body := map[string]string{"mfa_token": ts.mfaChallenge("alice"), "recovery_code": recoveryCodes[0]}
+	ts.request("POST", "/login/mfa", "", body, http.StatusOK, nil)
+	body = map[string]string{"mfa_token": ts.mfaChallenge("alice"), "recovery_code": recoveryCodes[0]}
+	ts.request("POST", "/login/mfa", "", body, http.StatusUnauthorized, nil)
+	body = map[string]string{"mfa_token": ts.mfaChallenge("alice"), "recovery_code": recoveryCodes[1]}
+	ts.request("POST", "/login/mfa", "", body, http.StatusOK, nil)
+}
+
+func TestMFAChallengeIsNotAnAccessToken(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ts.createUser("alice", "student")
+	ts.enrollMFA(ts.login("alice").Token)
+
+	ts.request("GET", "/student/info", ts.mfaChallenge("alice"), nil, http.StatusUnauthorized, nil)
+}
+
+func TestMFARequiredRoles(t *testing.T) {
+	ts := newTestServer(t, configValues{"MFA_REQUIRED_ROLES": "admin"})
+	ts.createUser("root", "admin")
+	token := ts.login("root").Token
+
+	// Only the setup endpoints are reachable until enrollment
+	ts.request("GET", "/admin/roles", token, nil, http.StatusForbidden, nil)
+	ts.request("GET", "/mfa", token, nil, http.StatusOK, nil)
+	secret, step, _ := ts.enrollMFA(token)
+
+	code, _ := totpCode(secret, step+1)
+	var tokens tokenResponse
+	ts.request("POST", "/login/mfa", "", map[string]string{"mfa_token": ts.mfaChallenge("root"), "code": code}, http.StatusOK, &tokens)
+	ts.request("GET", "/admin/roles", tokens.Token, nil, http.StatusOK, nil)
+}
@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS claim_reviews;
+DROP TABLE IF EXISTS files;
+DROP TABLE IF EXISTS medical_claims;
+DROP TABLE IF EXISTS attendances;
+DROP TABLE IF EXISTS ip_ms;
+DROP TABLE IF EXISTS teachers;
+DROP TABLE IF EXISTS students;
+DROP TABLE IF EXISTS users;
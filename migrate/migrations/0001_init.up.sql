@@ -0,0 +1,108 @@
+-- Baseline schema. Mirrors what AutoMigrate used to create so that existing
+-- databases can adopt versioned migrations without changes.
+
+CREATE TABLE IF NOT EXISTS users (
+    id         bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    username   text,
+    password   varchar(60),
+    user_type  text
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username ON users (username);
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at);
+
+CREATE TABLE IF NOT EXISTS students (
+    id                    bigserial PRIMARY KEY,
+    created_at            timestamptz,
+    updated_at            timestamptz,
+    deleted_at            timestamptz,
+    username              text,
+    name                  text,
+    class                 text,
+    register_number       text,
+    email                 text,
+    phone                 text,
+    attendance_percentage decimal
+);
+CREATE INDEX IF NOT EXISTS idx_students_deleted_at ON students (deleted_at);
+
+CREATE TABLE IF NOT EXISTS teachers (
+    id         bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    username   text,
+    name       text
+);
+CREATE INDEX IF NOT EXISTS idx_teachers_deleted_at ON teachers (deleted_at);
+
+CREATE TABLE IF NOT EXISTS ip_ms (
+    id         bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    username   text,
+    name       text
+);
+CREATE INDEX IF NOT EXISTS idx_ip_ms_deleted_at ON ip_ms (deleted_at);
+
+CREATE TABLE IF NOT EXISTS attendances (
+    id         bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    student_id bigint,
+    course     text,
+    period     text,
+    date       text,
+    teacher_id text,
+    is_present boolean,
+    is_applied boolean,
+    is_claimed boolean,
+    CONSTRAINT fk_students_attendance FOREIGN KEY (student_id) REFERENCES students (id)
+);
+CREATE INDEX IF NOT EXISTS idx_attendances_deleted_at ON attendances (deleted_at);
+
+CREATE TABLE IF NOT EXISTS medical_claims (
+    id          bigserial PRIMARY KEY,
+    created_at  timestamptz,
+    updated_at  timestamptz,
+    deleted_at  timestamptz,
+    student_id  bigint,
+    reason      text,
+    description text,
+    status      text DEFAULT 'Pending',
+    message     text DEFAULT '',
+    CONSTRAINT fk_students_medical_claims FOREIGN KEY (student_id) REFERENCES students (id)
+);
+CREATE INDEX IF NOT EXISTS idx_medical_claims_deleted_at ON medical_claims (deleted_at);
+
+CREATE TABLE IF NOT EXISTS files (
+    id               bigserial PRIMARY KEY,
+    created_at       timestamptz,
+    updated_at       timestamptz,
+    deleted_at       timestamptz,
+    name             text,
+    path             text,
+    medical_claim_id bigint,
+    CONSTRAINT fk_medical_claims_files FOREIGN KEY (medical_claim_id) REFERENCES medical_claims (id)
+);
+CREATE INDEX IF NOT EXISTS idx_files_deleted_at ON files (deleted_at);
+
+CREATE TABLE IF NOT EXISTS claim_reviews (
+    id            bigserial PRIMARY KEY,
+    created_at    timestamptz,
+    updated_at    timestamptz,
+    deleted_at    timestamptz,
+    claim_id      bigint,
+    attendance_id bigint,
+    teacher_id    bigint,
+    status        text DEFAULT 'Pending',
+    message       text,
+    CONSTRAINT fk_medical_claims_claim_reviews FOREIGN KEY (claim_id) REFERENCES medical_claims (id),
+    CONSTRAINT fk_claim_reviews_attendance FOREIGN KEY (attendance_id) REFERENCES attendances (id),
+    CONSTRAINT fk_teachers_claim FOREIGN KEY (teacher_id) REFERENCES teachers (id)
+);
+CREATE INDEX IF NOT EXISTS idx_claim_reviews_deleted_at ON claim_reviews (deleted_at);
@@ -0,0 +1,21 @@
+ALTER TABLE users ADD COLUMN disabled boolean NOT NULL DEFAULT false;
+
+CREATE TABLE refresh_tokens (
+    id          bigserial PRIMARY KEY,
+    created_at  timestamptz NOT NULL,
+    user_id     bigint NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    family_id   text NOT NULL,
+    token_hash  text NOT NULL,
+    expires_at  timestamptz NOT NULL,
+    revoked_at  timestamptz,
+    replaced_by bigint REFERENCES refresh_tokens (id) ON DELETE SET NULL
+);
+CREATE UNIQUE INDEX idx_refresh_tokens_token_hash ON refresh_tokens (token_hash);
+CREATE INDEX idx_refresh_tokens_family_id ON refresh_tokens (family_id);
+CREATE INDEX idx_refresh_tokens_user_id ON refresh_tokens (user_id);
+
+CREATE TABLE revoked_tokens (
+    jti        text PRIMARY KEY,
+    expires_at timestamptz NOT NULL
+);
+CREATE INDEX idx_revoked_tokens_expires_at ON revoked_tokens (expires_at);
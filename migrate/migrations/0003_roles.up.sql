@@ -0,0 +1,55 @@
+CREATE TABLE roles (
+    id          bigserial PRIMARY KEY,
+    created_at  timestamptz,
+    updated_at  timestamptz,
+    name        text NOT NULL,
+    description text NOT NULL DEFAULT ''
+);
+CREATE UNIQUE INDEX idx_roles_name ON roles (name);
+
+CREATE TABLE role_permissions (
+    role_id    bigint NOT NULL REFERENCES roles (id) ON DELETE CASCADE,
+    permission text NOT NULL,
+    PRIMARY KEY (role_id, permission)
+);
+
+CREATE TABLE user_roles (
+    user_id    bigint NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    role_id    bigint NOT NULL REFERENCES roles (id) ON DELETE CASCADE,
+    created_at timestamptz,
+    PRIMARY KEY (user_id, role_id)
+);
+
+-- Built-in roles, matching the user types the API has always used
+INSERT INTO roles (created_at, updated_at, name, description) VALUES
+    (now(), now(), 'student', 'Students filing medical claims'),
+    (now(), now(), 'teacher', 'Teachers reviewing claims for their classes'),
+    (now(), now(), 'ipm', 'IPM staff finalising reviewed claims'),
+    (now(), now(), 'admin', 'Administrators');
+
+INSERT INTO role_permissions (role_id, permission)
+SELECT roles.id, p.permission
+FROM roles
+JOIN (VALUES
+    ('student', 'student:self'),
+    ('student', 'claims:submit'),
+    ('teacher', 'teacher:self'),
+    ('teacher', 'claims:review'),
+    ('ipm', 'claims:read'),
+    ('ipm', 'claims:finalize'),
+    ('admin', 'student:self'),
+    ('admin', 'teacher:self'),
+    ('admin', 'claims:submit'),
+    ('admin', 'claims:read'),
+    ('admin', 'claims:review'),
+    ('admin', 'claims:finalize'),
+    ('admin', 'attendance:write'),
+    ('admin', 'teachers:write'),
+    ('admin', 'roles:manage')
+) AS p (role, permission) ON p.role = roles.name;
+
+-- Existing users keep the access their user_type gave them
+INSERT INTO user_roles (user_id, role_id, created_at)
+SELECT users.id, roles.id, now()
+FROM users
+JOIN roles ON roles.name = users.user_type;
@@ -0,0 +1,2 @@
+DELETE FROM role_permissions WHERE permission = 'users:invite';
+DROP TABLE IF EXISTS invitations;
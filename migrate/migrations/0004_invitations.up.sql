@@ -0,0 +1,17 @@
+CREATE TABLE invitations (
+    id            bigserial PRIMARY KEY,
+    created_at    timestamptz NOT NULL,
+    token_hash    text NOT NULL,
+    role          text NOT NULL,
+    name          text NOT NULL DEFAULT '',
+    email         text NOT NULL DEFAULT '',
+    profile_id    bigint NOT NULL DEFAULT 0,
+    created_by_id bigint REFERENCES users (id) ON DELETE SET NULL,
+    expires_at    timestamptz NOT NULL,
+    used_at       timestamptz,
+    used_by_id    bigint REFERENCES users (id) ON DELETE SET NULL
+);
+CREATE UNIQUE INDEX idx_invitations_token_hash ON invitations (token_hash);
+
+INSERT INTO role_permissions (role_id, permission)
+SELECT id, 'users:invite' FROM roles WHERE name = 'admin';
@@ -0,0 +1,5 @@
+DROP TABLE password_resets;
+
+DROP INDEX idx_users_email;
+ALTER TABLE users DROP COLUMN email;
+ALTER TABLE users DROP COLUMN tokens_not_before;
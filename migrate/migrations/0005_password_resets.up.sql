@@ -0,0 +1,19 @@
+ALTER TABLE users ADD COLUMN email text NOT NULL DEFAULT '';
+CREATE INDEX idx_users_email ON users (lower(email));
+ALTER TABLE users ADD COLUMN tokens_not_before timestamptz;
+
+-- Students already gave an email address on their profile
+UPDATE users SET email = students.email
+FROM students
+WHERE students.username = users.username AND students.deleted_at IS NULL AND students.email IS NOT NULL;
+
+CREATE TABLE password_resets (
+    id         bigserial PRIMARY KEY,
+    created_at timestamptz NOT NULL,
+    user_id    bigint NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    token_hash text NOT NULL,
+    expires_at timestamptz NOT NULL,
+    used_at    timestamptz
+);
+CREATE UNIQUE INDEX idx_password_resets_token_hash ON password_resets (token_hash);
+CREATE INDEX idx_password_resets_user_id ON password_resets (user_id);
@@ -0,0 +1,7 @@
+DELETE FROM role_permissions WHERE permission = 'users:manage';
+
+DROP TABLE login_events;
+
+ALTER TABLE users
+    DROP COLUMN failed_logins,
+    DROP COLUMN locked_until;
@@ -0,0 +1,19 @@
+ALTER TABLE users
+    ADD COLUMN failed_logins integer NOT NULL DEFAULT 0,
+    ADD COLUMN locked_until timestamptz;
+
+CREATE TABLE login_events (
+    id         bigserial PRIMARY KEY,
+    created_at timestamptz NOT NULL,
+    user_id    bigint REFERENCES users (id) ON DELETE CASCADE,
+    username   text NOT NULL,
+    ip         text NOT NULL,
+    user_agent text NOT NULL DEFAULT '',
+    success    boolean NOT NULL,
+    reason     text NOT NULL DEFAULT ''
+);
+CREATE INDEX idx_login_events_ip_created_at ON login_events (ip, created_at);
+CREATE INDEX idx_login_events_user_id_created_at ON login_events (user_id, created_at);
+
+INSERT INTO role_permissions (role_id, permission)
+SELECT id, 'users:manage' FROM roles WHERE name = 'admin';
@@ -0,0 +1,12 @@
+ALTER TABLE users
+    ADD COLUMN totp_secret text NOT NULL DEFAULT '',
+    ADD COLUMN totp_enabled boolean NOT NULL DEFAULT false,
+    ADD COLUMN totp_last_step bigint NOT NULL DEFAULT 0;
+
+CREATE TABLE recovery_codes (
+    id        bigserial PRIMARY KEY,
+    user_id   bigint NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    code_hash text NOT NULL,
+    used_at   timestamptz
+);
+CREATE INDEX idx_recovery_codes_user_id ON recovery_codes (user_id);
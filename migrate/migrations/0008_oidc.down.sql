@@ -0,0 +1,5 @@
+ALTER TABLE password_resets DROP COLUMN email;
+ALTER TABLE users DROP COLUMN email_verified;
+
+DROP TABLE oidc_logins;
+DROP TABLE user_identities;
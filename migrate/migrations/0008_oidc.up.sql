@@ -0,0 +1,25 @@
+CREATE TABLE user_identities (
+    id         bigserial PRIMARY KEY,
+    created_at timestamptz NOT NULL,
+    user_id    bigint NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    issuer     text NOT NULL,
+    subject    text NOT NULL,
+    email      text NOT NULL DEFAULT ''
+);
+CREATE UNIQUE INDEX idx_user_identities_issuer_subject ON user_identities (issuer, subject);
+CREATE INDEX idx_user_identities_user_id ON user_identities (user_id);
+
+CREATE TABLE oidc_logins (
+    state_hash    text PRIMARY KEY,
+    created_at    timestamptz NOT NULL,
+    code_verifier text NOT NULL,
+    nonce         text NOT NULL,
+    expires_at    timestamptz NOT NULL,
+    -- Set for identities being linked by a logged-in user
+    user_id       bigint REFERENCES users (id) ON DELETE CASCADE
+);
+
+-- Single sign-on only links identities by email to users who verified it,
+-- by using a password reset link sent to it
+ALTER TABLE users ADD COLUMN email_verified boolean NOT NULL DEFAULT false;
+ALTER TABLE password_resets ADD COLUMN email text NOT NULL DEFAULT '';
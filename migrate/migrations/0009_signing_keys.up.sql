@@ -0,0 +1,9 @@
+CREATE TABLE signing_keys (
+    kid         text PRIMARY KEY,
+    created_at  timestamptz NOT NULL,
+    algorithm   text NOT NULL,
+    private_key text NOT NULL,
+    active_at   timestamptz NOT NULL,
+    expires_at  timestamptz
+);
+CREATE INDEX idx_signing_keys_active_at ON signing_keys (active_at);
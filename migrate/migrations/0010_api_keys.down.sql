@@ -0,0 +1,3 @@
+DELETE FROM role_permissions WHERE permission = 'apikeys:manage';
+
+DROP TABLE api_keys;
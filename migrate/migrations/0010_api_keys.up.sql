@@ -0,0 +1,19 @@
+CREATE TABLE api_keys (
+    id            bigserial PRIMARY KEY,
+    created_at    timestamptz NOT NULL,
+    user_id       bigint NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name          text NOT NULL,
+    prefix        text NOT NULL,
+    key_hash      text NOT NULL,
+    scopes        text[] NOT NULL DEFAULT '{}',
+    created_by_id bigint REFERENCES users (id) ON DELETE SET NULL,
+    expires_at    timestamptz NOT NULL,
+    last_used_at  timestamptz,
+    last_used_ip  text NOT NULL DEFAULT '',
+    revoked_at    timestamptz
+);
+CREATE UNIQUE INDEX idx_api_keys_key_hash ON api_keys (key_hash);
+CREATE INDEX idx_api_keys_user_id ON api_keys (user_id);
+
+INSERT INTO role_permissions (role_id, permission)
+SELECT id, 'apikeys:manage' FROM roles WHERE name = 'admin';
@@ -0,0 +1 @@
+CREATE INDEX idx_users_user_type ON users (user_type);
@@ -0,0 +1,4 @@
+DELETE FROM role_permissions WHERE permission = 'users:impersonate';
+
+DROP TABLE impersonation_actions;
+DROP TABLE impersonations;
@@ -0,0 +1,27 @@
+CREATE TABLE impersonations (
+    id         bigserial PRIMARY KEY,
+    created_at timestamptz NOT NULL,
+    admin_id   bigint NOT NULL REFERENCES users (id),
+    user_id    bigint NOT NULL REFERENCES users (id),
+    reason     text NOT NULL,
+    token_id   text NOT NULL,
+    expires_at timestamptz NOT NULL,
+    ended_at   timestamptz
+);
+CREATE INDEX idx_impersonations_user_id ON impersonations (user_id);
+
+CREATE TABLE impersonation_actions (
+    id               bigserial PRIMARY KEY,
+    created_at       timestamptz NOT NULL,
+    impersonation_id bigint NOT NULL REFERENCES impersonations (id),
+    admin_id         bigint NOT NULL REFERENCES users (id),
+    user_id          bigint NOT NULL REFERENCES users (id),
+    method           text NOT NULL,
+    path             text NOT NULL,
+    status           integer NOT NULL,
+    ip               text NOT NULL DEFAULT ''
+);
+CREATE INDEX idx_impersonation_actions_impersonation_id ON impersonation_actions (impersonation_id);
+
+INSERT INTO role_permissions (role_id, permission)
+SELECT id, 'users:impersonate' FROM roles WHERE name = 'admin';
@@ -0,0 +1,12 @@
+DELETE FROM role_permissions WHERE permission = 'courses:manage';
+
+ALTER TABLE attendances ADD COLUMN course text;
+UPDATE attendances
+SET course = courses.code
+FROM sections JOIN courses ON courses.id = sections.course_id
+WHERE sections.id = attendances.section_id;
+ALTER TABLE attendances DROP COLUMN section_id;
+
+DROP TABLE enrollments;
+DROP TABLE sections;
+DROP TABLE courses;
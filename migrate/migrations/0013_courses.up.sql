@@ -0,0 +1,62 @@
+CREATE TABLE courses (
+    id         bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    code       text NOT NULL,
+    name       text NOT NULL DEFAULT ''
+);
+CREATE UNIQUE INDEX idx_courses_code ON courses (code) WHERE deleted_at IS NULL;
+CREATE INDEX idx_courses_deleted_at ON courses (deleted_at);
+
+CREATE TABLE sections (
+    id         bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    course_id  bigint NOT NULL REFERENCES courses (id),
+    name       text NOT NULL,
+    term       text NOT NULL DEFAULT '',
+    teacher_id bigint REFERENCES teachers (id)
+);
+CREATE UNIQUE INDEX idx_sections_course_id_term_name ON sections (course_id, term, name) WHERE deleted_at IS NULL;
+CREATE INDEX idx_sections_teacher_id ON sections (teacher_id);
+CREATE INDEX idx_sections_deleted_at ON sections (deleted_at);
+
+CREATE TABLE enrollments (
+    id         bigserial PRIMARY KEY,
+    created_at timestamptz NOT NULL,
+    section_id bigint NOT NULL REFERENCES sections (id) ON DELETE CASCADE,
+    student_id bigint NOT NULL REFERENCES students (id)
+);
+CREATE UNIQUE INDEX idx_enrollments_section_id_student_id ON enrollments (section_id, student_id);
+CREATE INDEX idx_enrollments_student_id ON enrollments (student_id);
+
+-- Attendance named its course in free text. Each distinct name becomes a
+-- course with one section, which its rows move to and whose students are
+-- enrolled in it.
+INSERT INTO courses (created_at, updated_at, code, name)
+SELECT now(), now(), code, code
+FROM (SELECT DISTINCT COALESCE(NULLIF(course, ''), 'UNKNOWN') AS code FROM attendances) legacy;
+
+INSERT INTO sections (created_at, updated_at, course_id, name)
+SELECT now(), now(), id, 'default' FROM courses;
+
+ALTER TABLE attendances ADD COLUMN section_id bigint REFERENCES sections (id);
+UPDATE attendances
+SET section_id = sections.id
+FROM sections JOIN courses ON courses.id = sections.course_id
+WHERE courses.code = COALESCE(NULLIF(attendances.course, ''), 'UNKNOWN');
+ALTER TABLE attendances
+    ALTER COLUMN section_id SET NOT NULL,
+    DROP COLUMN course;
+CREATE INDEX idx_attendances_section_id ON attendances (section_id);
+
+INSERT INTO enrollments (created_at, section_id, student_id)
+SELECT now(), section_id, student_id
+FROM attendances
+WHERE student_id IS NOT NULL
+GROUP BY section_id, student_id;
+
+INSERT INTO role_permissions (role_id, permission)
+SELECT id, 'courses:manage' FROM roles WHERE name = 'admin';
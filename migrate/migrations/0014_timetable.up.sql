@@ -0,0 +1,19 @@
+CREATE TABLE periods (
+    id         bigserial PRIMARY KEY,
+    created_at timestamptz NOT NULL,
+    weekday    smallint NOT NULL CHECK (weekday BETWEEN 0 AND 6),
+    name       text NOT NULL,
+    start_time text NOT NULL,
+    end_time   text NOT NULL
+);
+CREATE UNIQUE INDEX idx_periods_weekday_name ON periods (weekday, name);
+
+CREATE TABLE timetable_slots (
+    id         bigserial PRIMARY KEY,
+    created_at timestamptz NOT NULL,
+    section_id bigint NOT NULL REFERENCES sections (id) ON DELETE CASCADE,
+    period_id  bigint NOT NULL REFERENCES periods (id),
+    teacher_id bigint REFERENCES teachers (id)
+);
+CREATE UNIQUE INDEX idx_timetable_slots_section_id_period_id ON timetable_slots (section_id, period_id);
+CREATE INDEX idx_timetable_slots_period_id ON timetable_slots (period_id);
@@ -0,0 +1,4 @@
+DROP INDEX idx_attendances_student_id_section_id_date_period;
+
+CREATE INDEX idx_attendances_section_id ON attendances (section_id);
+DROP INDEX idx_attendances_section_id_date_period;
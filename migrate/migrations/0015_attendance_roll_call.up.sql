@@ -0,0 +1,19 @@
+-- Roll calls look up the records of one class of a section. The new index
+-- also serves lookups by section alone.
+CREATE INDEX idx_attendances_section_id_date_period ON attendances (section_id, date, period);
+DROP INDEX idx_attendances_section_id;
+
+-- A student has one record per class. Records duplicating an earlier one
+-- are deleted, as roll calls already ignore them.
+UPDATE attendances SET deleted_at = now()
+WHERE deleted_at IS NULL AND EXISTS (
+    SELECT 1 FROM attendances AS earlier
+    WHERE earlier.deleted_at IS NULL
+        AND earlier.student_id = attendances.student_id
+        AND earlier.section_id = attendances.section_id
+        AND earlier.date = attendances.date
+        AND earlier.period = attendances.period
+        AND earlier.id < attendances.id
+);
+CREATE UNIQUE INDEX idx_attendances_student_id_section_id_date_period
+    ON attendances (student_id, section_id, date, period) WHERE deleted_at IS NULL;
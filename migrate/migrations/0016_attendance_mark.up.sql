@@ -0,0 +1,2 @@
+INSERT INTO role_permissions (role_id, permission)
+SELECT id, 'attendance:mark' FROM roles WHERE name = 'teacher';
@@ -0,0 +1,3 @@
+ALTER TABLE students ADD COLUMN attendance_percentage decimal;
+
+DROP TABLE attendance_summaries;
@@ -0,0 +1,24 @@
+CREATE TABLE attendance_summaries (
+    student_id bigint NOT NULL REFERENCES students (id) ON DELETE CASCADE,
+    course_id  bigint NOT NULL REFERENCES courses (id) ON DELETE CASCADE,
+    updated_at timestamptz NOT NULL,
+    classes    bigint NOT NULL DEFAULT 0,
+    present    bigint NOT NULL DEFAULT 0,
+    claimed    bigint NOT NULL DEFAULT 0,
+    PRIMARY KEY (student_id, course_id)
+);
+CREATE INDEX idx_attendance_summaries_course_id ON attendance_summaries (course_id);
+
+INSERT INTO attendance_summaries (student_id, course_id, updated_at, classes, present, claimed)
+SELECT attendances.student_id, sections.course_id, now(),
+    count(*),
+    count(*) FILTER (WHERE attendances.is_present),
+    count(*) FILTER (WHERE NOT attendances.is_present AND attendances.is_applied)
+FROM attendances
+JOIN sections ON sections.id = attendances.section_id
+JOIN students ON students.id = attendances.student_id
+WHERE attendances.deleted_at IS NULL
+GROUP BY attendances.student_id, sections.course_id;
+
+-- Percentages are computed from attendance now, not sent by clients
+ALTER TABLE students DROP COLUMN attendance_percentage;
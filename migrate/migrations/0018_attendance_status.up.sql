@@ -0,0 +1,38 @@
+CREATE TABLE attendance_reasons (
+    code        text PRIMARY KEY,
+    created_at  timestamptz NOT NULL,
+    description text NOT NULL DEFAULT ''
+);
+
+ALTER TABLE attendances ADD COLUMN status text;
+UPDATE attendances SET status = CASE WHEN is_present THEN 'present' ELSE 'absent' END;
+ALTER TABLE attendances
+    ALTER COLUMN status SET NOT NULL,
+    ADD CONSTRAINT attendances_status_check
+        CHECK (status IN ('present', 'late', 'half_day', 'on_duty', 'excused', 'absent')),
+    ADD COLUMN reason text NOT NULL DEFAULT '',
+    DROP COLUMN is_present;
+CREATE INDEX idx_attendances_reason ON attendances (reason) WHERE reason <> '';
+
+-- Summaries are now kept per status
+DROP TABLE attendance_summaries;
+CREATE TABLE attendance_summaries (
+    student_id bigint NOT NULL REFERENCES students (id) ON DELETE CASCADE,
+    course_id  bigint NOT NULL REFERENCES courses (id) ON DELETE CASCADE,
+    status     text NOT NULL,
+    updated_at timestamptz NOT NULL,
+    classes    bigint NOT NULL DEFAULT 0,
+    claimed    bigint NOT NULL DEFAULT 0,
+    PRIMARY KEY (student_id, course_id, status)
+);
+CREATE INDEX idx_attendance_summaries_course_id ON attendance_summaries (course_id);
+
+INSERT INTO attendance_summaries (student_id, course_id, status, updated_at, classes, claimed)
+SELECT attendances.student_id, sections.course_id, attendances.status, now(),
+    count(*),
+    count(*) FILTER (WHERE attendances.status = 'absent' AND attendances.is_applied)
+FROM attendances
+JOIN sections ON sections.id = attendances.section_id
+JOIN students ON students.id = attendances.student_id
+WHERE attendances.deleted_at IS NULL
+GROUP BY attendances.student_id, sections.course_id, attendances.status;
@@ -0,0 +1,5 @@
+DELETE FROM role_permissions WHERE permission = 'attendance:review';
+
+DROP TABLE attendance_changes;
+DROP FUNCTION attendance_changes_immutable();
+DROP TABLE attendance_corrections;
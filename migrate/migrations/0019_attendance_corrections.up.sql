@@ -0,0 +1,51 @@
+CREATE TABLE attendance_corrections (
+    id             bigserial PRIMARY KEY,
+    created_at     timestamptz NOT NULL,
+    attendance_id  bigint NOT NULL REFERENCES attendances (id),
+    requested_by   bigint NOT NULL,
+    status         text NOT NULL,
+    reason         text NOT NULL DEFAULT '',
+    explanation    text NOT NULL,
+    state          text NOT NULL DEFAULT 'pending'
+        CHECK (state IN ('pending', 'approved', 'rejected')),
+    reviewed_by    bigint,
+    reviewed_at    timestamptz,
+    review_comment text NOT NULL DEFAULT ''
+);
+CREATE INDEX idx_attendance_corrections_attendance_id ON attendance_corrections (attendance_id);
+CREATE INDEX idx_attendance_corrections_requested_by ON attendance_corrections (requested_by);
+CREATE INDEX idx_attendance_corrections_state ON attendance_corrections (state);
+-- A record has at most one correction waiting for review
+CREATE UNIQUE INDEX idx_attendance_corrections_pending
+    ON attendance_corrections (attendance_id) WHERE state = 'pending';
+
+CREATE TABLE attendance_changes (
+    id            bigserial PRIMARY KEY,
+    created_at    timestamptz NOT NULL,
+    attendance_id bigint NOT NULL REFERENCES attendances (id),
+    changed_by    bigint NOT NULL,
+    correction_id bigint REFERENCES attendance_corrections (id),
+    before        jsonb,
+    after         jsonb NOT NULL
+);
+CREATE INDEX idx_attendance_changes_attendance_id ON attendance_changes (attendance_id);
+
+-- The history is append-only
+CREATE FUNCTION attendance_changes_immutable() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'attendance_changes is append-only';
+END;
+$$ LANGUAGE plpgsql;
+CREATE TRIGGER attendance_changes_immutable
+    BEFORE UPDATE OR DELETE ON attendance_changes
+    FOR EACH ROW EXECUTE FUNCTION attendance_changes_immutable();
+
+-- Existing records start their history as they are now, changed by nobody
+INSERT INTO attendance_changes (created_at, attendance_id, changed_by, after)
+SELECT created_at, id, 0,
+    jsonb_build_object('status', status, 'reason', reason, 'is_applied', is_applied, 'is_claimed', is_claimed)
+FROM attendances
+ORDER BY id;
+
+INSERT INTO role_permissions (role_id, permission)
+SELECT id, 'attendance:review' FROM roles WHERE name = 'admin';
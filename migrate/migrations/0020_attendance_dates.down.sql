@@ -0,0 +1,3 @@
+DROP INDEX idx_attendances_student_id_date;
+
+ALTER TABLE attendances ALTER COLUMN date TYPE text USING to_char(date, 'YYYY-MM-DD');
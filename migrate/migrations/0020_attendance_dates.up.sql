@@ -0,0 +1,14 @@
+-- Dates were free text. The migration fails, changing nothing, if one is not
+-- a valid YYYY-MM-DD date; fix those records and run it again.
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM attendances WHERE date !~ '^\d{4}-\d{2}-\d{2}$') THEN
+        RAISE EXCEPTION 'attendances has dates not written as YYYY-MM-DD';
+    END IF;
+END
+$$;
+ALTER TABLE attendances ALTER COLUMN date TYPE date USING date::date;
+
+-- Date range queries by student; those by section use
+-- idx_attendances_section_id_date_period
+CREATE INDEX idx_attendances_student_id_date ON attendances (student_id, date);
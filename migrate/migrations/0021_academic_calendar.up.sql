@@ -0,0 +1,23 @@
+CREATE TABLE terms (
+    id         bigserial PRIMARY KEY,
+    created_at timestamptz NOT NULL,
+    name       text NOT NULL UNIQUE,
+    start_date date NOT NULL,
+    end_date   date NOT NULL,
+    CHECK (start_date <= end_date),
+    CONSTRAINT terms_no_overlap EXCLUDE USING gist (daterange(start_date, end_date, '[]') WITH &&)
+);
+
+CREATE TABLE calendar_events (
+    id         bigserial PRIMARY KEY,
+    created_at timestamptz NOT NULL,
+    kind       text NOT NULL CHECK (kind IN ('holiday', 'exams', 'working_day')),
+    name       text NOT NULL,
+    start_date date NOT NULL,
+    end_date   date NOT NULL,
+    -- The weekday whose timetable a working day follows
+    weekday    smallint CHECK (weekday BETWEEN 0 AND 6),
+    CHECK (start_date <= end_date),
+    CHECK ((kind = 'working_day') = (weekday IS NOT NULL))
+);
+CREATE INDEX idx_calendar_events_dates ON calendar_events (start_date, end_date);
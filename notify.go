@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Notification is a message for a user, such as a password reset link.
+type Notification struct {
+	To      string // Email address of the recipient
+	Subject string
+	Body    string
+}
+
+// Notifier delivers notifications to users. Implementations for real email
+// or SMS delivery plug in here; the ones below are for local development.
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// newNotifier returns the notifier selected by cfg.Notifier.
+func newNotifier(cfg *Config) (Notifier, error) {
+	switch cfg.Notifier {
+	case "log":
+		return logNotifier{}, nil
+	case "file":
+		return &fileNotifier{path: cfg.NotifierFile}, nil
+	default:
+		return nil, fmt.Errorf("unknown notifier %q", cfg.Notifier)
+	}
+}
+
+// logNotifier writes notifications to the server log.
+type logNotifier struct{}
+
+func (logNotifier) Notify(ctx context.Context, n Notification) error {
+	log.Printf("Notification to %s: %s\n%s", n.To, n.Subject, n.Body)
+	return nil
+}
+
+// fileNotifier appends notifications to a file.
+type fileNotifier struct {
+	mu   sync.Mutex
+	path string
+}
+
+func (f *fileNotifier) Notify(ctx context.Context, n Notification) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(file, "Date: %s\nTo: %s\nSubject: %s\n\n%s\n\n",
+		time.Now().Format(time.RFC1123Z), n.To, n.Subject, n.Body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// notify sends n in the background so that slow delivery does not hold up
+// the request, or reveal through its timing whether an account exists.
+func (s *server) notify(n Notification) {
+	go func() {
+		if err := s.notifier.Notify(context.Background(), n); err != nil {
+			log.Printf("Failed to send notification to %s: %v", n.To, err)
+		}
+	}()
+}
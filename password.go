@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"api/store"
+)
+
+// changePasswordHandler sets a new password for the caller after checking the
+// current one. Every session is logged out and the caller gets new tokens.
+func (s *server) changePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	p := principalFrom(r.Context())
+
+	var body struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil || body.CurrentPassword == "" || body.NewPassword == "" {
+		http.Error(w, "current_password and new_password are required", http.StatusBadRequest)
+		return
+	}
+
+	user, err := s.store.Users.GetUser(r.Context(), p.UserID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(body.CurrentPassword))
+	if err != nil {
+		http.Error(w, "Current password is incorrect", http.StatusForbidden)
+		return
+	}
+
+	hashedPassword, err := hashPassword(body.NewPassword)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	err = s.store.Users.SetPassword(r.Context(), user.ID, hashedPassword)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Sessions started with the old password end here
+	if err := s.revokeSessions(r.Context(), p); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	tokens, err := s.issueTokens(r.Context(), user, "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if user.Email != "" {
+		s.notify(Notification{
+			To:      user.Email,
+			Subject: "Your password was changed",
+			Body:    "The password of your account " + user.Username + " was just changed. If this was not you, reset your password right away.",
+		})
+	}
+
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// revokeSessions logs the principal's user out everywhere, including the
+// access token of the current request.
+func (s *server) revokeSessions(ctx context.Context, p *Principal) error {
+	if err := s.store.Tokens.RevokeUserRefreshTokens(ctx, p.UserID); err != nil {
+		return err
+	}
+	return s.store.Tokens.RevokeAccessToken(ctx, p.TokenID, p.ExpiresAt)
+}
+
+// forgotPasswordHandler sends a password reset link to the email of the
+// account named by username or email. It answers the same way whether or not
+// the account exists.
+func (s *server) forgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Username string `json:"username"`
+		Email    string `json:"email"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil || (body.Username == "" && body.Email == "") {
+		http.Error(w, "username or email is required", http.StatusBadRequest)
+		return
+	}
+
+	var user *store.User
+	if body.Username != "" {
+		user, err = s.store.Users.GetUserByUsername(r.Context(), body.Username)
+	} else {
+		user, err = s.store.Users.GetUserByEmail(r.Context(), body.Email)
+	}
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err == nil && !user.Disabled && user.Email != "" {
+		_, err := s.sendPasswordReset(r.Context(), user,
+			"Someone asked to reset the password of your account "+user.Username+".",
+			"If this was not you, you can ignore this message.")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	} else if err == nil {
+		log.Printf("Password reset requested for %s, which has no usable email", user.Username)
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "If the account exists, a reset link has been sent to its email address",
+	})
+}
+
+// sendPasswordReset creates a password reset for user and, when the user has
+// an email, sends them the link between intro and outro. It returns the reset
+// token for callers that have to pass it on themselves.
+func (s *server) sendPasswordReset(ctx context.Context, user *store.User, intro string, outro string) (string, error) {
+	token, err := newOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	err = s.store.Tokens.CreatePasswordReset(ctx, &store.PasswordReset{
+		UserID:    user.ID,
+		Email:     user.Email,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(s.cfg.PasswordResetTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if user.Email != "" {
+		s.notify(Notification{
+			To:      user.Email,
+			Subject: "Reset your password",
+			Body: intro + " Open this link within " + s.cfg.PasswordResetTTL.String() + " to choose a new one:\n\n" +
+				s.cfg.PasswordResetURL + "?token=" + url.QueryEscape(token) + "\n\n" + outro,
+		})
+	}
+	return token, nil
+}
+
+// resetPasswordHandler sets a new password using a token from
+// forgotPasswordHandler and logs the user out everywhere.
+func (s *server) resetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil || body.Token == "" || body.Password == "" {
+		http.Error(w, "token and password are required", http.StatusBadRequest)
+		return
+	}
+
+	reset, err := s.store.Tokens.GetPasswordReset(r.Context(), hashToken(body.Token))
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Invalid or expired reset token", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if reset.UsedAt != nil || time.Now().After(reset.ExpiresAt) {
+		http.Error(w, "Invalid or expired reset token", http.StatusBadRequest)
+		return
+	}
+
+	hashedPassword, err := hashPassword(body.Password)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	err = s.store.Tokens.ResetPassword(r.Context(), reset, hashedPassword)
+	if errors.Is(err, store.ErrConflict) {
+		http.Error(w, "Invalid or expired reset token", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
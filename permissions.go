@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+)
+
+// Permissions checked by the API. Roles are sets of these; the built-in roles
+// are seeded by migration 0003_roles and later migrations that add permissions.
+const (
+	PermStudentSelf      = "student:self"      // Read and create one's own student profile
+	PermTeacherSelf      = "teacher:self"      // Read one's own teacher profile
+	PermClaimsSubmit     = "claims:submit"     // File medical claims and view one's own
+	PermClaimsRead       = "claims:read"       // View any medical claim
+	PermClaimsReview     = "claims:review"     // Review the claim reviews assigned to oneself
+	PermClaimsFinalize   = "claims:finalize"   // Approve or reject reviewed claims
+	PermAttendanceWrite  = "attendance:write"  // Record and edit attendance for any class
+	PermAttendanceMark   = "attendance:mark"   // Record and edit attendance for the classes one teaches
+	PermAttendanceReview = "attendance:review" // Approve or reject corrections to old attendance records
+	PermTeachersWrite    = "teachers:write"    // Create teacher profiles
+	PermRolesManage      = "roles:manage"      // Manage roles and assign them to users
+	PermUsersInvite      = "users:invite"      // Invite staff to create accounts
+	PermUsersManage      = "users:manage"      // Manage user accounts, e.g. unlock them
+	PermAPIKeysManage    = "apikeys:manage"    // Create and revoke API keys for any user
+	PermUsersImpersonate = "users:impersonate" // View the API as another user, read-only
+	PermCoursesManage    = "courses:manage"    // Manage courses, sections, enrollments, the timetable and the calendar
+)
+
+// allPermissions lists every known permission, for validating role edits.
+var allPermissions = []string{
+	PermStudentSelf,
+	PermTeacherSelf,
+	PermClaimsSubmit,
+	PermClaimsRead,
+	PermClaimsReview,
+	PermClaimsFinalize,
+	PermAttendanceWrite,
+	PermAttendanceMark,
+	PermAttendanceReview,
+	PermTeachersWrite,
+	PermRolesManage,
+	PermUsersInvite,
+	PermUsersManage,
+	PermAPIKeysManage,
+	PermUsersImpersonate,
+	PermCoursesManage,
+}
+
+// builtinRoles cannot be deleted because registration and the user types
+// stored on existing accounts refer to them.
+var builtinRoles = []string{"student", "teacher", "ipm", "admin"}
+
+func isKnownPermission(permission string) bool {
+	return slices.Contains(allPermissions, permission)
+}
+
+// Can reports whether the principal holds permission.
+func (p *Principal) Can(permission string) bool {
+	return p.Permissions[permission]
+}
+
+// requirePermission only lets principals holding at least one of permissions
+// through. With no permissions any authenticated principal is allowed, except
+// one using an API key, whose access is limited to its scopes.
+func requirePermission(permissions ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p := principalFrom(r.Context())
+			if p == nil {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if len(permissions) == 0 && p.APIKeyID != 0 {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			if len(permissions) > 0 && !slices.ContainsFunc(permissions, p.Can) {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestProtectRequiresToken(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ts.request("GET", "/student/info", "", nil, http.StatusUnauthorized, nil)
+	ts.request("GET", "/student/info", "not-a-token", nil, http.StatusUnauthorized, nil)
+	ts.request("POST", "/logout", "", nil, http.StatusUnauthorized, nil)
+}
+
+func TestProtectChecksPermissions(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ts.createUser("alice", "student")
+	ts.createUser("tom", "teacher")
+	ts.createUser("root", "admin")
+	student := ts.login("alice").Token
+	teacher := ts.login("tom").Token
+	admin := ts.login("root").Token
+
+	tests := []struct {
+		method string
+		path   string
+		token  string
+		status int
+	}{
+		{"GET", "/student/info", student, http.StatusOK},
+		{"GET", "/student/info", teacher, http.StatusForbidden},
+		{"GET", "/teacher/self", teacher, http.StatusOK},
+		{"GET", "/teacher/self", student, http.StatusForbidden},
+		{"GET", "/admin/users", admin, http.StatusOK},
+		{"GET", "/admin/users", teacher, http.StatusForbidden},
+		{"GET", "/admin/roles", admin, http.StatusOK},
+		{"GET", "/admin/roles", student, http.StatusForbidden},
+		{"GET", "/ipm/claims", teacher, http.StatusForbidden},
+	}
+	for _, test := range tests {
+		ts.request(test.method, test.path, test.token, nil, test.status, nil)
+	}
+}
+
+func TestRoleChangesApplyToExistingTokens(t *testing.T) {
+	ts := newTestServer(t, nil)
+	tom := ts.createUser("tom", "teacher")
+	ts.createUser("root", "admin")
+	teacher := ts.login("tom").Token
+	admin := ts.login("root").Token
+
+	ts.request("GET", "/admin/roles", teacher, nil, http.StatusForbidden, nil)
+
+	roles := fmt.Sprintf("/admin/users/%d/roles/", tom.ID)
+	ts.request("PUT", roles+"admin", admin, nil, http.StatusNoContent, nil)
+	ts.request("GET", "/admin/roles", teacher, nil, http.StatusOK, nil)
+
+	ts.request("DELETE", roles+"admin", admin, nil, http.StatusNoContent, nil)
+	ts.request("GET", "/admin/roles", teacher, nil, http.StatusForbidden, nil)
+}
+
+func TestDisabledUserIsLockedOut(t *testing.T) {
+	ts := newTestServer(t, nil)
+	alice := ts.createUser("alice", "student")
+	ts.createUser("root", "admin")
+	student := ts.login("alice")
+	admin := ts.login("root").Token
+
+	ts.request("POST", fmt.Sprintf("/admin/users/%d/disable", alice.ID), admin, nil, http.StatusOK, nil)
+	ts.request("GET", "/student/info", student.Token, nil, http.StatusUnauthorized, nil)
+	ts.request("POST", "/token/refresh", "", map[string]string{"refresh_token": student.RefreshToken}, http.StatusUnauthorized, nil)
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"api/store"
+)
+
+// Principal is the authenticated caller of a request. It is resolved once by
+// authenticate and read by handlers through principalFrom.
+type Principal struct {
+	UserID   uint
+	Username string
+	Role     string // The account's user type; access is decided by Permissions
+
+	// Union of the permissions of every role assigned to the user
+	Permissions map[string]bool
+
+	// IDs of the profiles linked to the user, zero when there is none
+	StudentID uint
+	TeacherID uint
+	IPMID     uint
+
+	// Whether the account has two-factor authentication enabled
+	MFA bool
+
+	// The access token the request was made with
+	TokenID   string
+	SessionID string
+	ExpiresAt time.Time
+
+	// The API key the request was made with instead of an access token
+	APIKeyID uint
+
+	// Set when an admin is viewing the API as this user through an
+	// impersonation token
+	ImpersonationID      uint
+	ImpersonatorID       uint
+	ImpersonatorUsername string
+}
+
+type principalKey struct{}
+
+func withPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// principalFrom returns the principal stored by authenticate. Handlers behind
+// protect can rely on it being present.
+func principalFrom(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
+
+// authenticate validates the bearer token or API key once and stores the
+// caller's Principal in the request context. Requests without valid
+// credentials are rejected with 401.
+func (s *server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rawKey, ok := apiKeyFrom(r); ok {
+			key, user, err := s.verifyAPIKey(r.Context(), r, rawKey)
+			if errors.Is(err, errAPIKeyInvalid) || errors.Is(err, store.ErrNotFound) {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			p, err := s.newPrincipal(r.Context(), user)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			p.APIKeyID = key.ID
+			p.ExpiresAt = key.ExpiresAt
+
+			// The key only gets the scopes its user still holds
+			scoped := map[string]bool{}
+			for _, scope := range key.Scopes {
+				if p.Permissions[scope] {
+					scoped[scope] = true
+				}
+			}
+			p.Permissions = scoped
+			next.ServeHTTP(w, r.WithContext(withPrincipal(r.Context(), p)))
+			return
+		}
+
+		tokenString, ok := bearerToken(r)
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		// Verify it, including revocation and disabled accounts
+		claims, user, err := s.verifyAccessToken(r.Context(), tokenString)
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		p, err := s.newPrincipal(r.Context(), user)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		p.TokenID = claims.Id
+		p.SessionID = claims.SessionID
+		p.ExpiresAt = time.Unix(claims.ExpiresAt, 0)
+
+		if claims.Actor != nil {
+			impersonation, admin, err := s.verifyImpersonation(r.Context(), claims)
+			if err != nil {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			p.ImpersonationID = impersonation.ID
+			p.ImpersonatorID = admin.ID
+			p.ImpersonatorUsername = admin.Username
+			s.serveImpersonated(w, r.WithContext(withPrincipal(r.Context(), p)), next)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(withPrincipal(r.Context(), p)))
+	})
+}
+
+// newPrincipal loads the profiles and permissions of user.
+func (s *server) newPrincipal(ctx context.Context, user *store.User) (*Principal, error) {
+	profiles, err := s.store.Users.GetProfileIDs(ctx, user.Username)
+	if err != nil {
+		return nil, err
+	}
+
+	permissions, err := s.store.Roles.GetUserPermissions(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Principal{
+		UserID:    user.ID,
+		Username:  user.Username,
+		Role:      user.UserType,
+		StudentID: profiles.StudentID,
+		TeacherID: profiles.TeacherID,
+		IPMID:     profiles.IPMID,
+		MFA:       user.TOTPEnabled,
+
+		Permissions: map[string]bool{},
+	}
+	for _, permission := range permissions {
+		p.Permissions[permission] = true
+	}
+	return p, nil
+}
+
+// protect wraps a handler so that it needs a valid token from a principal
+// holding one of permissions.
+func (s *server) protect(h http.HandlerFunc, permissions ...string) http.Handler {
+	return s.authenticate(s.requireMFA(requirePermission(permissions...)(h)))
+}
+
+// protectMFASetup is protect for the few endpoints a principal must reach
+// before enrolling in a required two-factor authentication. They manage the
+// user's own session and credentials, so API keys cannot call them.
+func (s *server) protectMFASetup(h http.HandlerFunc) http.Handler {
+	return s.authenticate(requirePermission()(h))
+}
+
+// requireMFA refuses principals whose role must use two-factor
+// authentication until they have enrolled. API keys are minted by admins and
+// are exempt, as are impersonating admins, who got past it themselves.
+func (s *server) requireMFA(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := principalFrom(r.Context())
+		if p != nil && p.APIKeyID == 0 && p.ImpersonatorID == 0 && !p.MFA && s.mfaRequired(p.Role) {
+			http.Error(w, "Two-factor authentication must be set up first", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
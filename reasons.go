@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"api/store"
+)
+
+// reasonBody is how attendance reason codes are written to the API.
+type reasonBody struct {
+	Code        string `json:"code"`
+	Description string `json:"description"`
+}
+
+// listReasonsHandler lists the reason codes attendance can be marked with.
+func (s *server) listReasonsHandler(w http.ResponseWriter, r *http.Request) {
+	reasons, err := s.store.Attendance.ListReasons(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]reasonBody, len(reasons))
+	for i, reason := range reasons {
+		response[i] = reasonBody{reason.Code, reason.Description}
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *server) createReasonHandler(w http.ResponseWriter, r *http.Request) {
+	var body reasonBody
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if body.Code == "" {
+		http.Error(w, "code is required", http.StatusBadRequest)
+		return
+	}
+
+	reason := store.AttendanceReason{Code: body.Code, Description: body.Description}
+	err = s.store.Attendance.CreateReason(r.Context(), &reason)
+	if errors.Is(err, store.ErrDuplicate) {
+		http.Error(w, "Reason code is already taken", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(body)
+}
+
+// deleteReasonHandler deletes a reason code no attendance is marked with.
+func (s *server) deleteReasonHandler(w http.ResponseWriter, r *http.Request) {
+	err := s.store.Attendance.DeleteReason(r.Context(), mux.Vars(r)["code"])
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Reason code not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, store.ErrConflict) {
+		http.Error(w, "Attendance is marked with the reason code", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/gorilla/mux"
+
+	"api/store"
+)
+
+// roleBody is how roles are read from and written to the admin API.
+type roleBody struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+func newRoleBody(role store.Role) roleBody {
+	return roleBody{
+		Name:        role.Name,
+		Description: role.Description,
+		Permissions: role.PermissionNames(),
+	}
+}
+
+func validatePermissions(permissions []string) error {
+	for _, permission := range permissions {
+		if !isKnownPermission(permission) {
+			return fmt.Errorf("unknown permission %q", permission)
+		}
+	}
+	return nil
+}
+
+func (s *server) listRolesHandler(w http.ResponseWriter, r *http.Request) {
+	roles, err := s.store.Roles.ListRoles(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]roleBody, len(roles))
+	for i, role := range roles {
+		response[i] = newRoleBody(role)
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *server) createRoleHandler(w http.ResponseWriter, r *http.Request) {
+	var body roleBody
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if body.Name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	if err := validatePermissions(body.Permissions); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	role := store.Role{Name: body.Name, Description: body.Description}
+	for _, permission := range body.Permissions {
+		role.Permissions = append(role.Permissions, store.RolePermission{Permission: permission})
+	}
+
+	err = s.store.Roles.CreateRole(r.Context(), &role)
+	if errors.Is(err, store.ErrDuplicate) {
+		http.Error(w, "Role already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newRoleBody(role))
+}
+
+// updateRoleHandler replaces the permissions of a role.
+func (s *server) updateRoleHandler(w http.ResponseWriter, r *http.Request) {
+	var body roleBody
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validatePermissions(body.Permissions); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	role, err := s.store.Roles.GetRoleByName(r.Context(), mux.Vars(r)["name"])
+	if err != nil {
+		http.Error(w, "Role not found", http.StatusNotFound)
+		return
+	}
+
+	err = s.store.Roles.SetRolePermissions(r.Context(), role.ID, body.Permissions)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	role.Permissions = nil
+	for _, permission := range body.Permissions {
+		role.Permissions = append(role.Permissions, store.RolePermission{RoleID: role.ID, Permission: permission})
+	}
+	json.NewEncoder(w).Encode(newRoleBody(*role))
+}
+
+func (s *server) deleteRoleHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	if slices.Contains(builtinRoles, name) {
+		http.Error(w, "Built-in roles cannot be deleted", http.StatusBadRequest)
+		return
+	}
+
+	role, err := s.store.Roles.GetRoleByName(r.Context(), name)
+	if err != nil {
+		http.Error(w, "Role not found", http.StatusNotFound)
+		return
+	}
+
+	err = s.store.Roles.DeleteRole(r.Context(), role.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *server) listUserRolesHandler(w http.ResponseWriter, r *http.Request) {
+	userId, err := pathID(r, "userid")
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := s.store.Users.GetUser(r.Context(), userId); err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	roles, err := s.store.Roles.ListUserRoles(r.Context(), userId)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]roleBody, len(roles))
+	for i, role := range roles {
+		response[i] = newRoleBody(role)
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *server) assignRoleHandler(w http.ResponseWriter, r *http.Request) {
+	userId, role, ok := s.userAndRole(w, r)
+	if !ok {
+		return
+	}
+
+	err := s.store.Roles.AssignRole(r.Context(), userId, role.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *server) revokeRoleHandler(w http.ResponseWriter, r *http.Request) {
+	userId, role, ok := s.userAndRole(w, r)
+	if !ok {
+		return
+	}
+
+	// Stop admins from locking everyone out of role management
+	p := principalFrom(r.Context())
+	if userId == p.UserID && slices.Contains(role.PermissionNames(), PermRolesManage) {
+		http.Error(w, "You cannot revoke your own role management access", http.StatusBadRequest)
+		return
+	}
+
+	err := s.store.Roles.RevokeRole(r.Context(), userId, role.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// userAndRole resolves the {userid} and {name} route variables, writing an
+// error response and returning false if either does not exist.
+func (s *server) userAndRole(w http.ResponseWriter, r *http.Request) (uint, *store.Role, bool) {
+	userId, err := pathID(r, "userid")
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return 0, nil, false
+	}
+
+	if _, err := s.store.Users.GetUser(r.Context(), userId); err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return 0, nil, false
+	}
+
+	role, err := s.store.Roles.GetRoleByName(r.Context(), mux.Vars(r)["name"])
+	if err != nil {
+		http.Error(w, "Role not found", http.StatusNotFound)
+		return 0, nil, false
+	}
+
+	return userId, role, true
+}
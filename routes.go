@@ -0,0 +1,150 @@
+package main
+
+import (
+	"github.com/gorilla/mux"
+)
+
+// routes registers every endpoint. Apart from the login and token endpoints,
+// each route is wrapped in protect with the permissions allowed to call it.
+// Protected routes accept an access token or an API key.
+func (s *server) routes() *mux.Router {
+	router := mux.NewRouter()
+
+	// Register unprotected routes
+	router.HandleFunc("/login", s.loginHandler).Methods("POST")
+	router.HandleFunc("/login/mfa", s.loginMFAHandler).Methods("POST")
+	router.HandleFunc("/register", s.registerHandler).Methods("POST")
+	router.HandleFunc("/register/invitation", s.acceptInvitationHandler).Methods("POST")
+	router.HandleFunc("/token/refresh", s.refreshTokenHandler).Methods("POST")
+	router.HandleFunc("/.well-known/jwks.json", s.jwksHandler).Methods("GET")
+	router.HandleFunc("/oidc/login", s.oidcLoginHandler).Methods("GET")
+	router.HandleFunc("/oidc/callback", s.oidcCallbackHandler).Methods("GET")
+	router.HandleFunc("/password/forgot", s.forgotPasswordHandler).Methods("POST")
+	router.HandleFunc("/password/reset", s.resetPasswordHandler).Methods("POST")
+
+	// Every other route declares the permissions allowed to call it
+	router.Handle("/logout", s.protectMFASetup(s.logoutHandler)).Methods("POST")
+	router.Handle("/password/change", s.protect(s.changePasswordHandler)).Methods("POST")
+	router.Handle("/oidc/link", s.protect(s.oidcLinkHandler)).Methods("POST")
+
+	// /mfa routes stay reachable for users who still have to enroll
+	mfaRouter := router.PathPrefix("/mfa").Subrouter()
+	mfaRouter.Handle("", s.protectMFASetup(s.getMFAStatusHandler)).Methods("GET")
+	mfaRouter.Handle("", s.protectMFASetup(s.disableMFAHandler)).Methods("DELETE")
+	mfaRouter.Handle("/enroll", s.protectMFASetup(s.enrollMFAHandler)).Methods("POST")
+	mfaRouter.Handle("/confirm", s.protectMFASetup(s.confirmMFAHandler)).Methods("POST")
+	mfaRouter.Handle("/recovery-codes", s.protectMFASetup(s.regenerateRecoveryCodesHandler)).Methods("POST")
+
+	// /student routes
+	studentRouter := router.PathPrefix("/student").Subrouter()
+	studentRouter.Handle("/create", s.protect(s.createStudentInfo, PermStudentSelf)).Methods("POST")
+	studentRouter.Handle("/info", s.protect(s.getStudentInfo, PermStudentSelf)).Methods("GET")
+	studentRouter.Handle("/timetable", s.protect(s.getStudentTimetable, PermStudentSelf)).Methods("GET")
+
+	// /attendance routes
+	attendanceRouter := router.PathPrefix("/attendance").Subrouter()
+	attendanceRouter.Handle("", s.protect(s.listAttendanceHandler, PermAttendanceWrite, PermAttendanceReview, PermAttendanceMark, PermStudentSelf)).Methods("GET")
+	attendanceRouter.Handle("/create", s.protect(s.createAttendanceHandler, PermAttendanceWrite, PermAttendanceMark)).Methods("POST")
+	attendanceRouter.Handle("/roll-call", s.protect(s.rollCallHandler, PermAttendanceWrite, PermAttendanceMark)).Methods("POST")
+	attendanceRouter.Handle("/reasons", s.protect(s.listReasonsHandler, PermAttendanceWrite, PermAttendanceMark)).Methods("GET")
+	attendanceRouter.Handle("/corrections", s.protect(s.listCorrectionsHandler, PermAttendanceWrite, PermAttendanceMark, PermAttendanceReview)).Methods("GET")
+	attendanceRouter.Handle("/corrections/{correctionid}/approve", s.protect(s.approveCorrectionHandler, PermAttendanceReview)).Methods("POST")
+	attendanceRouter.Handle("/corrections/{correctionid}/reject", s.protect(s.rejectCorrectionHandler, PermAttendanceReview)).Methods("POST")
+	attendanceRouter.Handle("/{attendanceid}/corrections", s.protect(s.createCorrectionHandler, PermAttendanceWrite, PermAttendanceMark)).Methods("POST")
+	attendanceRouter.Handle("/{attendanceid}/history", s.protect(s.attendanceHistoryHandler, PermAttendanceWrite, PermAttendanceMark, PermAttendanceReview)).Methods("GET")
+	attendanceRouter.Handle("/{attendanceid}", s.protect(s.updateAttendanceHandler, PermAttendanceWrite, PermAttendanceMark)).Methods("PUT")
+
+	// /calendar routes
+	calendarRouter := router.PathPrefix("/calendar").Subrouter()
+	calendarRouter.Handle("/terms", s.protect(s.listTermsHandler)).Methods("GET")
+	calendarRouter.Handle("/events", s.protect(s.listEventsHandler)).Methods("GET")
+
+	// /claims routes
+	claimsRouter := router.PathPrefix("/claims").Subrouter()
+	claimsRouter.Handle("/create", s.protect(s.createMedicalClaim, PermClaimsSubmit)).Methods("POST")
+	claimsRouter.Handle("/{claimid}", s.protect(s.getMedicalClaimByIdHandler, PermClaimsSubmit, PermClaimsReview, PermClaimsRead)).Methods("GET")
+	claimsRouter.Handle("/", s.protect(s.getClaimsByStudentHandler, PermClaimsSubmit)).Methods("GET")
+
+	// /teacher routes
+	teacherRouter := router.PathPrefix("/teacher").Subrouter()
+	teacherRouter.Handle("/self", s.protect(s.getTeacherByTokenHandler, PermTeacherSelf)).Methods("GET")
+	teacherRouter.Handle("/timetable", s.protect(s.getTeacherTimetable, PermTeacherSelf)).Methods("GET")
+	teacherRouter.Handle("/create", s.protect(s.createTeacherHandler, PermTeachersWrite)).Methods("POST")
+	teacherRouter.Handle("/claims", s.protect(s.getClaimsByTeacherHandler, PermClaimsReview)).Methods("GET")
+	teacherRouter.Handle("/claims/{claimid}", s.protect(s.putClaimReviewHandler, PermClaimsReview)).Methods("PUT")
+
+	// /ipm routes
+	ipmRouter := router.PathPrefix("/ipm").Subrouter()
+	ipmRouter.Handle("/claims", s.protect(s.getAllClaims, PermClaimsFinalize)).Methods("GET")
+	ipmRouter.Handle("/claims/{claimid}", s.protect(s.updateClaimStatus, PermClaimsFinalize)).Methods("PUT")
+
+	// /admin routes
+	adminRouter := router.PathPrefix("/admin").Subrouter()
+	adminRouter.Handle("/roles", s.protect(s.listRolesHandler, PermRolesManage)).Methods("GET")
+	adminRouter.Handle("/roles", s.protect(s.createRoleHandler, PermRolesManage)).Methods("POST")
+	adminRouter.Handle("/roles/{name}", s.protect(s.updateRoleHandler, PermRolesManage)).Methods("PUT")
+	adminRouter.Handle("/roles/{name}", s.protect(s.deleteRoleHandler, PermRolesManage)).Methods("DELETE")
+	adminRouter.Handle("/users/{userid}/roles", s.protect(s.listUserRolesHandler, PermRolesManage)).Methods("GET")
+	adminRouter.Handle("/users/{userid}/roles/{name}", s.protect(s.assignRoleHandler, PermRolesManage)).Methods("PUT")
+	adminRouter.Handle("/users/{userid}/roles/{name}", s.protect(s.revokeRoleHandler, PermRolesManage)).Methods("DELETE")
+
+	adminRouter.Handle("/users", s.protect(s.listUsersHandler, PermUsersManage)).Methods("GET")
+	adminRouter.Handle("/users", s.protect(s.createUserHandler, PermUsersManage)).Methods("POST")
+	adminRouter.Handle("/users/{userid}", s.protect(s.getUserHandler, PermUsersManage)).Methods("GET")
+	adminRouter.Handle("/users/{userid}", s.protect(s.updateUserHandler, PermUsersManage)).Methods("PUT")
+	adminRouter.Handle("/users/{userid}", s.protect(s.deleteUserHandler, PermUsersManage)).Methods("DELETE")
+	adminRouter.Handle("/users/{userid}/disable", s.protect(s.disableUserHandler, PermUsersManage)).Methods("POST")
+	adminRouter.Handle("/users/{userid}/enable", s.protect(s.enableUserHandler, PermUsersManage)).Methods("POST")
+	adminRouter.Handle("/users/{userid}/password-reset", s.protect(s.forcePasswordResetHandler, PermUsersManage)).Methods("POST")
+	adminRouter.Handle("/users/{userid}/profiles/{kind}", s.protect(s.linkProfileHandler, PermUsersManage)).Methods("PUT")
+	adminRouter.Handle("/users/{userid}/profiles/{kind}", s.protect(s.unlinkProfileHandler, PermUsersManage)).Methods("DELETE")
+	adminRouter.Handle("/users/{userid}/impersonate", s.protect(s.startImpersonationHandler, PermUsersImpersonate)).Methods("POST")
+	adminRouter.Handle("/users/{userid}/impersonations", s.protect(s.listImpersonationsHandler, PermUsersImpersonate, PermUsersManage)).Methods("GET")
+	adminRouter.Handle("/impersonations", s.protect(s.listImpersonationsHandler, PermUsersImpersonate, PermUsersManage)).Methods("GET")
+	adminRouter.Handle("/impersonations/{impersonationid}/actions", s.protect(s.listImpersonationActionsHandler, PermUsersImpersonate, PermUsersManage)).Methods("GET")
+	adminRouter.Handle("/impersonations/{impersonationid}", s.protect(s.endImpersonationHandler, PermUsersImpersonate, PermUsersManage)).Methods("DELETE")
+	adminRouter.Handle("/users/{userid}/unlock", s.protect(s.unlockUserHandler, PermUsersManage)).Methods("POST")
+	adminRouter.Handle("/users/{userid}/mfa/reset", s.protect(s.resetUserMFAHandler, PermUsersManage)).Methods("POST")
+	adminRouter.Handle("/users/{userid}/login-events", s.protect(s.listLoginEventsHandler, PermUsersManage)).Methods("GET")
+	adminRouter.Handle("/users/{userid}/api-keys", s.protect(s.listAPIKeysHandler, PermAPIKeysManage)).Methods("GET")
+	adminRouter.Handle("/users/{userid}/api-keys", s.protect(s.createAPIKeyHandler, PermAPIKeysManage)).Methods("POST")
+	adminRouter.Handle("/api-keys", s.protect(s.listAPIKeysHandler, PermAPIKeysManage)).Methods("GET")
+	adminRouter.Handle("/api-keys/{keyid}", s.protect(s.revokeAPIKeyHandler, PermAPIKeysManage)).Methods("DELETE")
+	adminRouter.Handle("/courses", s.protect(s.listCoursesHandler, PermCoursesManage)).Methods("GET")
+	adminRouter.Handle("/courses", s.protect(s.createCourseHandler, PermCoursesManage)).Methods("POST")
+	adminRouter.Handle("/courses/{courseid}", s.protect(s.getCourseHandler, PermCoursesManage)).Methods("GET")
+	adminRouter.Handle("/courses/{courseid}", s.protect(s.updateCourseHandler, PermCoursesManage)).Methods("PUT")
+	adminRouter.Handle("/courses/{courseid}", s.protect(s.deleteCourseHandler, PermCoursesManage)).Methods("DELETE")
+	adminRouter.Handle("/courses/{courseid}/sections", s.protect(s.listSectionsHandler, PermCoursesManage)).Methods("GET")
+	adminRouter.Handle("/courses/{courseid}/sections", s.protect(s.createSectionHandler, PermCoursesManage)).Methods("POST")
+	adminRouter.Handle("/sections", s.protect(s.listSectionsHandler, PermCoursesManage)).Methods("GET")
+	adminRouter.Handle("/sections/{sectionid}", s.protect(s.getSectionHandler, PermCoursesManage)).Methods("GET")
+	adminRouter.Handle("/sections/{sectionid}", s.protect(s.updateSectionHandler, PermCoursesManage)).Methods("PUT")
+	adminRouter.Handle("/sections/{sectionid}", s.protect(s.deleteSectionHandler, PermCoursesManage)).Methods("DELETE")
+	adminRouter.Handle("/sections/{sectionid}/students", s.protect(s.listEnrollmentsHandler, PermCoursesManage)).Methods("GET")
+	adminRouter.Handle("/sections/{sectionid}/students", s.protect(s.enrollStudentsHandler, PermCoursesManage)).Methods("POST")
+	adminRouter.Handle("/sections/{sectionid}/students/{studentid}", s.protect(s.unenrollStudentHandler, PermCoursesManage)).Methods("DELETE")
+	adminRouter.Handle("/sections/{sectionid}/timetable", s.protect(s.sectionTimetableHandler, PermCoursesManage)).Methods("GET")
+	adminRouter.Handle("/sections/{sectionid}/timetable", s.protect(s.createSlotHandler, PermCoursesManage)).Methods("POST")
+	adminRouter.Handle("/sections/{sectionid}/timetable/{slotid}", s.protect(s.deleteSlotHandler, PermCoursesManage)).Methods("DELETE")
+	adminRouter.Handle("/attendance-reasons", s.protect(s.createReasonHandler, PermAttendanceWrite)).Methods("POST")
+	adminRouter.Handle("/attendance-reasons/{code}", s.protect(s.deleteReasonHandler, PermAttendanceWrite)).Methods("DELETE")
+	adminRouter.Handle("/periods", s.protect(s.listPeriodsHandler, PermCoursesManage)).Methods("GET")
+	adminRouter.Handle("/periods", s.protect(s.createPeriodHandler, PermCoursesManage)).Methods("POST")
+	adminRouter.Handle("/periods/{periodid}", s.protect(s.updatePeriodHandler, PermCoursesManage)).Methods("PUT")
+	adminRouter.Handle("/periods/{periodid}", s.protect(s.deletePeriodHandler, PermCoursesManage)).Methods("DELETE")
+	adminRouter.Handle("/terms", s.protect(s.createTermHandler, PermCoursesManage)).Methods("POST")
+	adminRouter.Handle("/terms/{termid}", s.protect(s.deleteTermHandler, PermCoursesManage)).Methods("DELETE")
+	adminRouter.Handle("/calendar-events", s.protect(s.createEventHandler, PermCoursesManage)).Methods("POST")
+	adminRouter.Handle("/calendar-events/{eventid}", s.protect(s.deleteEventHandler, PermCoursesManage)).Methods("DELETE")
+	adminRouter.Handle("/students/{studentid}/timetable", s.protect(s.studentTimetableHandler, PermCoursesManage)).Methods("GET")
+	adminRouter.Handle("/invitations", s.protect(s.listInvitationsHandler, PermUsersInvite)).Methods("GET")
+	adminRouter.Handle("/invitations", s.protect(s.createInvitationHandler, PermUsersInvite)).Methods("POST")
+	adminRouter.Handle("/invitations/{invitationid}", s.protect(s.deleteInvitationHandler, PermUsersInvite)).Methods("DELETE")
+
+	// Apply other middleware to the router
+	router.Use(jsonContentTypeMiddleware)
+	router.Use(loggingMiddleware)
+
+	return router
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+
+	"api/store"
+)
+
+// errNoAccount is returned when a provider identity matches no user and no
+// role is configured for creating one.
+var errNoAccount = errors.New("no account for this identity")
+
+// errLinkRequired is returned when a provider identity has the email of a
+// user who has not verified it, so it is not linked to them automatically.
+var errLinkRequired = errors.New("the account with this email has to link the identity")
+
+// oidcStateCookie binds a single sign-on to the browser that started it. It
+// holds the hash of the state, so a callback URL made for someone else's
+// login or link fails in any other browser.
+const oidcStateCookie = "oidc_state"
+
+// setOIDCStateCookie sets the state cookie to value, or clears it for a
+// negative maxAge.
+func setOIDCStateCookie(w http.ResponseWriter, r *http.Request, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     "/oidc",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// oidcLoginHandler starts a single sign-on login. It redirects to the
+// provider, or with ?redirect=false returns the provider URL as JSON for
+// clients that navigate there themselves.
+func (s *server) oidcLoginHandler(w http.ResponseWriter, r *http.Request) {
+	s.startOIDC(w, r, nil, r.URL.Query().Get("redirect") != "false")
+}
+
+// oidcLinkHandler starts linking an identity at the provider to the
+// caller's account, for accounts single sign-on will not link by email.
+// It returns the provider URL as JSON; the provider then sends the user to
+// the callback as for a login.
+func (s *server) oidcLinkHandler(w http.ResponseWriter, r *http.Request) {
+	s.startOIDC(w, r, &principalFrom(r.Context()).UserID, false)
+}
+
+// startOIDC sends the user to the provider, to log in or, when userId is
+// set, to link their identity to that user.
+func (s *server) startOIDC(w http.ResponseWriter, r *http.Request, userId *uint, redirect bool) {
+	if s.oidc == nil {
+		http.Error(w, "Single sign-on is not configured", http.StatusNotFound)
+		return
+	}
+
+	var secrets [3]string
+	for i := range secrets {
+		var err error
+		if secrets[i], err = newOpaqueToken(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	state, nonce, verifier := secrets[0], secrets[1], secrets[2]
+
+	err := s.store.Tokens.CreateOIDCLogin(r.Context(), &store.OIDCLogin{
+		StateHash:    hashToken(state),
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		ExpiresAt:    time.Now().Add(s.cfg.OIDC.LoginTTL),
+		UserID:       userId,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	setOIDCStateCookie(w, r, hashToken(state), int(s.cfg.OIDC.LoginTTL/time.Second))
+
+	authURL, err := s.oidc.authCodeURL(r.Context(), state, nonce, verifier)
+	if err != nil {
+		log.Printf("Single sign-on unavailable: %v", err)
+		http.Error(w, "Identity provider is unavailable", http.StatusBadGateway)
+		return
+	}
+
+	if !redirect {
+		json.NewEncoder(w).Encode(map[string]string{"authorization_url": authURL})
+		return
+	}
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// oidcCallbackHandler finishes a single sign-on login. The provider sends
+// the user's browser here, or to a frontend page that passes on the code and
+// state, and the response is the same as that of /login. Links started from
+// /oidc/link finish here too. Either only completes with the state cookie of
+// the browser that started it.
+func (s *server) oidcCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	if s.oidc == nil {
+		http.Error(w, "Single sign-on is not configured", http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	if providerError := query.Get("error"); providerError != "" {
+		http.Error(w, "Single sign-on failed: "+providerError, http.StatusUnauthorized)
+		return
+	}
+	state, code := query.Get("state"), query.Get("code")
+	if state == "" || code == "" {
+		http.Error(w, "state and code are required", http.StatusBadRequest)
+		return
+	}
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(hashToken(state))) != 1 {
+		http.Error(w, "Single sign-on was not started in this browser, start again", http.StatusBadRequest)
+		return
+	}
+	setOIDCStateCookie(w, r, "", -1)
+
+	login, err := s.store.Tokens.TakeOIDCLogin(r.Context(), hashToken(state))
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Unknown or expired login, start again", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if time.Now().After(login.ExpiresAt) {
+		http.Error(w, "Unknown or expired login, start again", http.StatusBadRequest)
+		return
+	}
+
+	rawIDToken, err := s.oidc.exchange(r.Context(), code, login.CodeVerifier)
+	if err != nil {
+		log.Printf("Single sign-on code exchange failed: %v", err)
+		http.Error(w, "Single sign-on failed", http.StatusUnauthorized)
+		return
+	}
+	claims, err := s.oidc.verifyIDToken(r.Context(), rawIDToken, login.Nonce)
+	if err != nil {
+		log.Printf("Single sign-on ID token rejected: %v", err)
+		http.Error(w, "Single sign-on failed", http.StatusUnauthorized)
+		return
+	}
+
+	if login.UserID != nil {
+		s.linkOIDCIdentity(w, r, *login.UserID, claims)
+		return
+	}
+
+	user, err := s.oidcUser(r.Context(), claims)
+	if errors.Is(err, errNoAccount) {
+		http.Error(w, "There is no account for this identity", http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, errLinkRequired) {
+		http.Error(w, "An account with this email exists; log in to it and link the identity from /oidc/link", http.StatusConflict)
+		return
+	}
+	if errors.Is(err, store.ErrDuplicate) {
+		http.Error(w, "An account with this username already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	attempt := &store.LoginEvent{
+		UserID:    &user.ID,
+		Username:  user.Username,
+		IP:        s.clientIP(r),
+		UserAgent: r.UserAgent(),
+	}
+	if user.Disabled {
+		s.recordLogin(r.Context(), attempt, "disabled")
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	// Two-factor authentication applies to single sign-on logins too
+	if user.TOTPEnabled {
+		s.mfaChallenge(w, r, user)
+		return
+	}
+
+	s.completeLogin(w, r, user, attempt)
+}
+
+// linkOIDCIdentity links the identity in a verified ID token to the user
+// who started the link.
+func (s *server) linkOIDCIdentity(w http.ResponseWriter, r *http.Request, userId uint, claims jwt.MapClaims) {
+	// The account may have been disabled or deleted while at the provider
+	user, err := s.store.Users.GetUser(r.Context(), userId)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "The account no longer exists", http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if user.Disabled {
+		http.Error(w, "The account is disabled", http.StatusForbidden)
+		return
+	}
+
+	identity := oidcIdentity(claims)
+	identity.UserID = user.ID
+	err = s.store.Users.LinkIdentity(r.Context(), identity)
+	if errors.Is(err, store.ErrDuplicate) {
+		http.Error(w, "This identity is already linked to an account", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Identity linked",
+	})
+}
+
+// oidcIdentity returns the identity a verified ID token is for. Its email
+// is only kept if the provider verified it.
+func oidcIdentity(claims jwt.MapClaims) *store.UserIdentity {
+	issuer, _ := claims["iss"].(string)
+	subject, _ := claims["sub"].(string)
+	email, _ := claims["email"].(string)
+	if verified, _ := claims["email_verified"].(bool); !verified {
+		email = ""
+	}
+	return &store.UserIdentity{Issuer: issuer, Subject: subject, Email: email}
+}
+
+// oidcUser returns the user a verified ID token belongs to. Unknown
+// identities are linked to the user with the same email if both the
+// provider and the user verified it, or get a new account when a role can
+// be determined for them. Anyone can register with someone else's email,
+// so users who have not verified theirs get errLinkRequired and have to
+// link the identity themselves.
+func (s *server) oidcUser(ctx context.Context, claims jwt.MapClaims) (*store.User, error) {
+	identity := oidcIdentity(claims)
+	user, err := s.store.Users.GetUserByIdentity(ctx, identity.Issuer, identity.Subject)
+	if err == nil || !errors.Is(err, store.ErrNotFound) {
+		return user, err
+	}
+	email := identity.Email
+
+	if s.cfg.OIDC.LinkByEmail && email != "" {
+		user, err := s.store.Users.GetUserByEmail(ctx, email)
+		if err == nil {
+			if !user.EmailVerified {
+				return nil, errLinkRequired
+			}
+			identity.UserID = user.ID
+			return user, s.store.Users.LinkIdentity(ctx, identity)
+		}
+		if !errors.Is(err, store.ErrNotFound) {
+			return nil, err
+		}
+	}
+
+	roleName := s.oidcRole(claims)
+	if roleName == "" {
+		return nil, errNoAccount
+	}
+	role, err := s.store.Roles.GetRoleByName(ctx, roleName)
+	if err != nil {
+		return nil, err
+	}
+
+	username, _ := claims[s.cfg.OIDC.UsernameClaim].(string)
+	if username == "" {
+		username = email
+	}
+	if username == "" {
+		return nil, errNoAccount
+	}
+	name, _ := claims["name"].(string)
+
+	// Accounts from single sign-on have no password until the user sets
+	// one through a password reset
+	account := &store.NewAccount{
+		User: &store.User{
+			Username: username,
+			UserType: role.Name,
+			Email:    email,
+			// The provider verified it
+			EmailVerified: email != "",
+		},
+		RoleID:   role.ID,
+		Identity: identity,
+	}
+	switch role.Name {
+	case "student":
+		account.Student = &store.Student{Name: name, Email: email}
+	case "teacher":
+		account.Teacher = &store.Teacher{Name: name}
+	case "ipm":
+		account.IPM = &store.IPM{Name: name}
+	}
+	if err := s.store.Users.CreateAccount(ctx, account); err != nil {
+		return nil, err
+	}
+	return account.User, nil
+}
+
+// oidcRole picks the role of a new account from the provider's role claim,
+// falling back to the default role.
+func (s *server) oidcRole(claims jwt.MapClaims) string {
+	if s.cfg.OIDC.RoleClaim != "" {
+		for _, value := range claimStrings(claims, s.cfg.OIDC.RoleClaim) {
+			if role, ok := s.cfg.OIDC.RoleMap[value]; ok {
+				return role
+			}
+		}
+	}
+	return s.cfg.OIDC.DefaultRole
+}
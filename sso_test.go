@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// fakeProvider is an OpenID provider that signs in whoever claims says,
+// for the nonce of the last authorization URL it was given.
+type fakeProvider struct {
+	*httptest.Server
+	key    *rsa.PrivateKey
+	claims jwt.MapClaims
+	nonce  string
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &fakeProvider{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidcDiscovery{
+			Issuer:                p.URL,
+			AuthorizationEndpoint: p.URL + "/authorize",
+			TokenEndpoint:         p.URL + "/token",
+			JWKSURI:               p.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		claims := jwt.MapClaims{
+			"iss":   p.URL,
+			"aud":   "attendance",
+			"exp":   time.Now().Add(time.Minute).Unix(),
+			"nonce": p.nonce,
+		}
+		for name, value := range p.claims {
+			claims[name] = value
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "test"
+		idToken, err := token.SignedString(p.key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": idToken})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+			}},
+		})
+	})
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+// newSSOTestServer returns a test server using a fake provider.
+func newSSOTestServer(t *testing.T, values configValues) (*testServer, *fakeProvider) {
+	t.Helper()
+	provider := newFakeProvider(t)
+	v := configValues{
+		"OIDC_ISSUER":       provider.URL,
+		"OIDC_CLIENT_ID":    "attendance",
+		"OIDC_REDIRECT_URL": "http://localhost/oidc/callback",
+	}
+	for key, value := range values {
+		v[key] = value
+	}
+	ts := newTestServer(t, v)
+	ts.oidc = newOIDCProvider(ts.cfg.OIDC)
+	return ts, provider
+}
+
+// startSignIn starts a sign-in at start with token and returns the callback
+// URL the provider sends the holder of claims to, with the state cookie of
+// the browser that started it.
+func (ts *testServer) startSignIn(provider *fakeProvider, method string, start string, token string, claims jwt.MapClaims) (string, *http.Cookie) {
+	ts.t.Helper()
+	var started struct {
+		AuthorizationURL string `json:"authorization_url"`
+	}
+	rec := ts.request(method, start, token, nil, http.StatusOK, &started)
+	authURL, err := url.Parse(started.AuthorizationURL)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	provider.nonce = authURL.Query().Get("nonce")
+	provider.claims = claims
+
+	var cookie *http.Cookie
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == oidcStateCookie {
+			cookie = c
+		}
+	}
+	if cookie == nil || !cookie.HttpOnly {
+		ts.t.Fatalf("%s %s: no HttpOnly state cookie", method, start)
+	}
+	return "/oidc/callback?" + url.Values{"state": {authURL.Query().Get("state")}, "code": {"code"}}.Encode(), cookie
+}
+
+// signIn goes through the provider as the holder of claims, starting at
+// start with token, and returns the callback's response.
+func (ts *testServer) signIn(provider *fakeProvider, method string, start string, token string, claims jwt.MapClaims, status int, out interface{}) {
+	ts.t.Helper()
+	callback, cookie := ts.startSignIn(provider, method, start, token, claims)
+	req := httptest.NewRequest("GET", callback, nil)
+	req.AddCookie(cookie)
+	ts.do(req, status, out)
+}
+
+// verifyEmail has the user prove they receive their email by resetting
+// their password with the link sent to it.
+func (ts *testServer) verifyEmail(username string) {
+	ts.t.Helper()
+	ts.request("POST", "/password/forgot", "", map[string]string{"username": username}, http.StatusAccepted, nil)
+	sent := ts.notification()
+	match := regexp.MustCompile(`token=(\S+)`).FindStringSubmatch(sent.Body)
+	if match == nil {
+		ts.t.Fatalf("no reset link in %q", sent.Body)
+	}
+	token, err := url.QueryUnescape(match[1])
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	ts.request("POST", "/password/reset", "", map[string]string{"token": token, "password": testPassword}, http.StatusNoContent, nil)
+}
+
+// tokenUsername returns the username of the user an access token is for.
+func (ts *testServer) tokenUsername(token string) string {
+	ts.t.Helper()
+	_, user, err := ts.verifyAccessToken(context.Background(), token)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	return user.Username
+}
+
+func TestSSODoesNotLinkUnverifiedEmail(t *testing.T) {
+	ts, provider := newSSOTestServer(t, nil)
+	ts.createUser("alice", "student")
+	claims := jwt.MapClaims{"sub": "attacker", "email": "alice@example.edu", "email_verified": true}
+
+	// Anyone could have registered with the email
+	ts.signIn(provider, "GET", "/oidc/login?redirect=false", "", claims, http.StatusConflict, nil)
+
+	ts.verifyEmail("alice")
+	var tokens tokenResponse
+	ts.signIn(provider, "GET", "/oidc/login?redirect=false", "", claims, http.StatusOK, &tokens)
+	if username := ts.tokenUsername(tokens.Token); username != "alice" {
+		t.Errorf("signed in as %q, want alice", username)
+	}
+}
+
+func TestSSODoesNotLinkEmailTheProviderDidNotVerify(t *testing.T) {
+	ts, provider := newSSOTestServer(t, nil)
+	ts.createUser("alice", "student")
+	ts.verifyEmail("alice")
+
+	claims := jwt.MapClaims{"sub": "attacker", "email": "alice@example.edu"}
+	ts.signIn(provider, "GET", "/oidc/login?redirect=false", "", claims, http.StatusForbidden, nil)
+	claims["email_verified"] = false
+	ts.signIn(provider, "GET", "/oidc/login?redirect=false", "", claims, http.StatusForbidden, nil)
+}
+
+func TestSSOLinkIdentity(t *testing.T) {
+	ts, provider := newSSOTestServer(t, nil)
+	ts.createUser("alice", "student")
+	ts.createUser("bob", "student")
+	claims := jwt.MapClaims{"sub": "alice-at-idp"}
+
+	ts.signIn(provider, "POST", "/oidc/link", ts.login("alice").Token, claims, http.StatusOK, nil)
+
+	var tokens tokenResponse
+	ts.signIn(provider, "GET", "/oidc/login?redirect=false", "", claims, http.StatusOK, &tokens)
+	if username := ts.tokenUsername(tokens.Token); username != "alice" {
+		t.Errorf("signed in as %q, want alice", username)
+	}
+
+	// An identity belongs to one account
+	ts.signIn(provider, "POST", "/oidc/link", ts.login("bob").Token, claims, http.StatusConflict, nil)
+	ts.request("POST", "/oidc/link", "", nil, http.StatusUnauthorized, nil)
+}
+
+func TestSSOCallbackNeedsStateCookie(t *testing.T) {
+	ts, provider := newSSOTestServer(t, nil)
+	ts.createUser("alice", "student")
+	ts.createUser("mallory", "student")
+
+	// A link callback for mallory's account opened in alice's browser
+	callback, _ := ts.startSignIn(provider, "POST", "/oidc/link", ts.login("mallory").Token, jwt.MapClaims{"sub": "alice-at-idp"})
+	ts.request("GET", callback, "", nil, http.StatusBadRequest, nil)
+
+	_, other := ts.startSignIn(provider, "GET", "/oidc/login?redirect=false", "", jwt.MapClaims{"sub": "alice-at-idp"})
+	req := httptest.NewRequest("GET", callback, nil)
+	req.AddCookie(other)
+	ts.do(req, http.StatusBadRequest, nil)
+}
+
+func TestSSOLinkRefusesDisabledOrDeletedUser(t *testing.T) {
+	ts, provider := newSSOTestServer(t, nil)
+	alice := ts.createUser("alice", "student")
+	bob := ts.createUser("bob", "student")
+	ts.createUser("root", "admin")
+	admin := ts.login("root").Token
+
+	// The accounts change while their users are at the provider
+	link := func(user string, change string, method string, path string, status int) {
+		t.Helper()
+		callback, cookie := ts.startSignIn(provider, "POST", "/oidc/link", ts.login(user).Token, jwt.MapClaims{"sub": user + "-at-idp"})
+		ts.request(method, path, admin, nil, status, nil)
+		req := httptest.NewRequest("GET", callback, nil)
+		req.AddCookie(cookie)
+		ts.do(req, http.StatusForbidden, nil)
+
+		if _, err := ts.store.Users.GetUserByIdentity(context.Background(), provider.URL, user+"-at-idp"); err == nil {
+			t.Errorf("identity was linked to the %s user", change)
+		}
+	}
+	link("alice", "disabled", "POST", fmt.Sprintf("/admin/users/%d/disable", alice.ID), http.StatusOK)
+	link("bob", "deleted", "DELETE", fmt.Sprintf("/admin/users/%d", bob.ID), http.StatusNoContent)
+}
@@ -0,0 +1,138 @@
+package store
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// dateLayout is how dates are written, in the API and to the database.
+const dateLayout = "2006-01-02"
+
+// ErrInvalidDate is returned for dates not written as YYYY-MM-DD.
+var ErrInvalidDate = errors.New("date must be YYYY-MM-DD")
+
+// Date is a calendar day, without a time or time zone. It is stored in date
+// columns and written to JSON as YYYY-MM-DD. Dates compare with == and sort
+// with Before.
+type Date struct {
+	Year  int
+	Month time.Month
+	Day   int
+}
+
+// ParseDate parses a date written as YYYY-MM-DD.
+func ParseDate(value string) (Date, error) {
+	t, err := time.Parse(dateLayout, value)
+	if err != nil {
+		return Date{}, ErrInvalidDate
+	}
+	return DateOf(t), nil
+}
+
+// DateOf returns the day t falls on in its location.
+func DateOf(t time.Time) Date {
+	year, month, day := t.Date()
+	return Date{year, month, day}
+}
+
+// Today returns the current day in the local time zone.
+func Today() Date {
+	return DateOf(time.Now())
+}
+
+func (d Date) String() string {
+	return fmt.Sprintf("%04d-%02d-%02d", d.Year, d.Month, d.Day)
+}
+
+func (d Date) IsZero() bool {
+	return d == Date{}
+}
+
+// Time returns midnight UTC at the start of the day.
+func (d Date) Time() time.Time {
+	return time.Date(d.Year, d.Month, d.Day, 0, 0, 0, 0, time.UTC)
+}
+
+func (d Date) Weekday() time.Weekday {
+	return d.Time().Weekday()
+}
+
+// AddDays returns the date n days after d, or before it if n is negative.
+func (d Date) AddDays(n int) Date {
+	return DateOf(d.Time().AddDate(0, 0, n))
+}
+
+func (d Date) Before(other Date) bool {
+	return d.Time().Before(other.Time())
+}
+
+func (d Date) After(other Date) bool {
+	return d.Time().After(other.Time())
+}
+
+func (d Date) MarshalJSON() ([]byte, error) {
+	if d.IsZero() {
+		return []byte(`""`), nil
+	}
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON reads a date written as YYYY-MM-DD. An empty string is the
+// zero Date.
+func (d *Date) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return ErrInvalidDate
+	}
+	if value == "" {
+		*d = Date{}
+		return nil
+	}
+	date, err := ParseDate(value)
+	if err != nil {
+		return err
+	}
+	*d = date
+	return nil
+}
+
+// GormDataType makes gorm treat Date as a single date column.
+func (Date) GormDataType() string {
+	return "date"
+}
+
+// Value stores the zero Date as NULL.
+func (d Date) Value() (driver.Value, error) {
+	if d.IsZero() {
+		return nil, nil
+	}
+	return d.String(), nil
+}
+
+func (d *Date) Scan(src interface{}) error {
+	switch value := src.(type) {
+	case nil:
+		*d = Date{}
+	case time.Time:
+		*d = DateOf(value)
+	case string:
+		return d.scanString(value)
+	case []byte:
+		return d.scanString(string(value))
+	default:
+		return fmt.Errorf("cannot scan %T into a Date", src)
+	}
+	return nil
+}
+
+func (d *Date) scanString(value string) error {
+	date, err := ParseDate(value)
+	if err != nil {
+		return err
+	}
+	*d = date
+	return nil
+}
@@ -0,0 +1,1181 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// memoryDB is the shared state behind the in-memory stores. Records are kept
+// by value and copied on the way in and out so callers cannot mutate them.
+type memoryDB struct {
+	mu     sync.RWMutex
+	nextID uint
+
+	users       map[uint]User
+	students    map[uint]Student
+	teachers    map[uint]Teacher
+	attendance  map[uint]Attendance
+	summaries   map[summaryKey]AttendanceSummary
+	reasons     map[string]AttendanceReason
+	changes     []AttendanceChange // In the order they were made
+	corrections map[uint]AttendanceCorrection
+	claims      map[uint]MedicalClaim
+	reviews     map[uint]ClaimReview
+	files       map[uint]File
+	ipms        map[uint]IPM
+
+	courses     map[uint]Course
+	sections    map[uint]Section
+	enrollments map[uint]Enrollment
+
+	periods        map[uint]Period
+	timetableSlots map[uint]TimetableSlot
+	terms          map[uint]Term
+	calendarEvents map[uint]CalendarEvent
+
+	refreshTokens  map[uint]RefreshToken
+	revokedTokens  map[string]RevokedToken
+	passwordResets map[uint]PasswordReset
+
+	loginEvents   []LoginEvent // In the order they were recorded
+	recoveryCodes map[uint]RecoveryCode
+	identities    map[uint]UserIdentity
+	oidcLogins    map[string]OIDCLogin
+
+	roles     map[uint]Role
+	userRoles map[userRoleKey]time.Time
+
+	invitations map[uint]Invitation
+
+	apiKeys     map[uint]APIKey
+	signingKeys map[string]SigningKey
+
+	impersonations       map[uint]Impersonation
+	impersonationActions []ImpersonationAction // In the order they were recorded
+}
+
+type summaryKey struct {
+	studentId uint
+	courseId  uint
+	status    string
+}
+
+type userRoleKey struct {
+	userId uint
+	roleId uint
+}
+
+// NewMemory returns a Store that keeps everything in process memory.
+func NewMemory() *Store {
+	m := &memoryDB{
+		users:       map[uint]User{},
+		students:    map[uint]Student{},
+		teachers:    map[uint]Teacher{},
+		attendance:  map[uint]Attendance{},
+		summaries:   map[summaryKey]AttendanceSummary{},
+		reasons:     map[string]AttendanceReason{},
+		corrections: map[uint]AttendanceCorrection{},
+		claims:      map[uint]MedicalClaim{},
+		reviews:     map[uint]ClaimReview{},
+		files:       map[uint]File{},
+		ipms:        map[uint]IPM{},
+
+		courses:     map[uint]Course{},
+		sections:    map[uint]Section{},
+		enrollments: map[uint]Enrollment{},
+
+		periods:        map[uint]Period{},
+		timetableSlots: map[uint]TimetableSlot{},
+		terms:          map[uint]Term{},
+		calendarEvents: map[uint]CalendarEvent{},
+
+		refreshTokens:  map[uint]RefreshToken{},
+		revokedTokens:  map[string]RevokedToken{},
+		passwordResets: map[uint]PasswordReset{},
+		recoveryCodes:  map[uint]RecoveryCode{},
+		identities:     map[uint]UserIdentity{},
+		oidcLogins:     map[string]OIDCLogin{},
+
+		roles:     map[uint]Role{},
+		userRoles: map[userRoleKey]time.Time{},
+
+		invitations: map[uint]Invitation{},
+
+		apiKeys:     map[uint]APIKey{},
+		signingKeys: map[string]SigningKey{},
+
+		impersonations: map[uint]Impersonation{},
+	}
+	return &Store{
+		Users:          &memUsers{m},
+		Students:       &memStudents{m},
+		Teachers:       &memTeachers{m},
+		Attendance:     &memAttendance{m},
+		Corrections:    &memCorrections{m},
+		Courses:        &memCourses{m},
+		Timetable:      &memTimetable{m},
+		Calendar:       &memCalendar{m},
+		Claims:         &memClaims{m},
+		Tokens:         &memTokens{m},
+		Logins:         &memLogins{m},
+		MFA:            &memMFA{m},
+		Roles:          &memRoles{m},
+		Invitations:    &memInvitations{m},
+		APIKeys:        &memAPIKeys{m},
+		Keys:           &memKeys{m},
+		Impersonations: &memImpersonations{m},
+	}
+}
+
+// stamp assigns a new ID and timestamps, mirroring what GORM does on create.
+func (m *memoryDB) stamp(model *gorm.Model) {
+	m.nextID++
+	now := time.Now()
+	model.ID = m.nextID
+	model.CreatedAt = now
+	model.UpdatedAt = now
+}
+
+// sortedKeys returns map keys in insertion (ID) order.
+func sortedKeys[T any](records map[uint]T) []uint {
+	keys := make([]uint, 0, len(records))
+	for id := range records {
+		keys = append(keys, id)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
+
+type memUsers struct {
+	*memoryDB
+}
+
+func (s *memUsers) CreateUser(ctx context.Context, user *User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.createUser(user)
+}
+
+func (m *memoryDB) createUser(user *User) error {
+	for _, existing := range m.users {
+		if existing.Username == user.Username {
+			return ErrDuplicate
+		}
+	}
+	m.stamp(&user.Model)
+	m.users[user.ID] = *user
+	return nil
+}
+
+func (s *memUsers) CreateAccount(ctx context.Context, account *NewAccount) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.createAccount(account)
+}
+
+// createAccount does the work of CreateAccount; the caller holds the lock.
+// Everything is checked before anything is written, like a transaction.
+func (m *memoryDB) createAccount(account *NewAccount) error {
+	user := account.User
+	for _, existing := range m.users {
+		if existing.Username == user.Username {
+			return ErrDuplicate
+		}
+	}
+	if _, ok := m.roles[account.RoleID]; !ok {
+		return ErrNotFound
+	}
+	if account.Teacher != nil && account.Teacher.ID != 0 {
+		if existing, ok := m.teachers[account.Teacher.ID]; !ok || existing.Username != "" {
+			return ErrConflict
+		}
+	}
+	if account.IPM != nil && account.IPM.ID != 0 {
+		if existing, ok := m.ipms[account.IPM.ID]; !ok || existing.Username != "" {
+			return ErrConflict
+		}
+	}
+
+	if account.Identity != nil && m.identityOwner(account.Identity.Issuer, account.Identity.Subject) != 0 {
+		return ErrDuplicate
+	}
+
+	if err := m.createUser(user); err != nil {
+		return err
+	}
+	m.userRoles[userRoleKey{userId: user.ID, roleId: account.RoleID}] = time.Now()
+	if account.Identity != nil {
+		account.Identity.UserID = user.ID
+		m.createIdentity(account.Identity)
+	}
+
+	switch {
+	case account.Student != nil:
+		account.Student.Username = user.Username
+		m.stamp(&account.Student.Model)
+		m.students[account.Student.ID] = *account.Student
+	case account.Teacher != nil:
+		if account.Teacher.ID == 0 {
+			m.stamp(&account.Teacher.Model)
+		} else {
+			*account.Teacher = m.teachers[account.Teacher.ID]
+		}
+		account.Teacher.Username = user.Username
+		m.teachers[account.Teacher.ID] = *account.Teacher
+	case account.IPM != nil:
+		if account.IPM.ID == 0 {
+			m.stamp(&account.IPM.Model)
+		} else {
+			*account.IPM = m.ipms[account.IPM.ID]
+		}
+		account.IPM.Username = user.Username
+		m.ipms[account.IPM.ID] = *account.IPM
+	}
+	return nil
+}
+
+func (s *memUsers) GetUser(ctx context.Context, id uint) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &user, nil
+}
+
+func (s *memUsers) GetUserByUsername(ctx context.Context, username string) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, id := range sortedKeys(s.users) {
+		if user := s.users[id]; user.Username == username {
+			return &user, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memUsers) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, id := range sortedKeys(s.users) {
+		if user := s.users[id]; strings.EqualFold(user.Email, email) {
+			return &user, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memUsers) SetPassword(ctx context.Context, userId uint, passwordHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userId]
+	if !ok {
+		return ErrNotFound
+	}
+	now := time.Now()
+	user.Password = passwordHash
+	user.TokensNotBefore = &now
+	user.UpdatedAt = now
+	s.users[userId] = user
+	return nil
+}
+
+func (s *memUsers) GetUserByIdentity(ctx context.Context, issuer string, subject string) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[s.identityOwner(issuer, subject)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &user, nil
+}
+
+func (s *memUsers) LinkIdentity(ctx context.Context, identity *UserIdentity) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[identity.UserID]; !ok {
+		return ErrNotFound
+	}
+	if s.identityOwner(identity.Issuer, identity.Subject) != 0 {
+		return ErrDuplicate
+	}
+	s.createIdentity(identity)
+	return nil
+}
+
+// identityOwner returns the ID of the user linked to an identity, or 0.
+func (m *memoryDB) identityOwner(issuer string, subject string) uint {
+	for _, identity := range m.identities {
+		if identity.Issuer == issuer && identity.Subject == subject {
+			return identity.UserID
+		}
+	}
+	return 0
+}
+
+func (m *memoryDB) createIdentity(identity *UserIdentity) {
+	m.nextID++
+	identity.ID = m.nextID
+	identity.CreatedAt = time.Now()
+	m.identities[identity.ID] = *identity
+}
+
+func (s *memUsers) RecordLoginFailure(ctx context.Context, userId uint, maxFailures int, lockout time.Duration) (*User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userId]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	user.FailedLogins++
+	if user.FailedLogins >= maxFailures {
+		until := time.Now().Add(lockout)
+		user.LockedUntil = &until
+	}
+	s.users[userId] = user
+	return &user, nil
+}
+
+func (s *memUsers) ClearLoginFailures(ctx context.Context, userId uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userId]
+	if !ok {
+		return ErrNotFound
+	}
+	user.FailedLogins = 0
+	user.LockedUntil = nil
+	s.users[userId] = user
+	return nil
+}
+
+func (s *memUsers) GetProfileIDs(ctx context.Context, username string) (*ProfileIDs, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var ids ProfileIDs
+	for _, id := range sortedKeys(s.students) {
+		if s.students[id].Username == username {
+			ids.StudentID = id
+			break
+		}
+	}
+	for _, id := range sortedKeys(s.teachers) {
+		if s.teachers[id].Username == username {
+			ids.TeacherID = id
+			break
+		}
+	}
+	for _, id := range sortedKeys(s.ipms) {
+		if s.ipms[id].Username == username {
+			ids.IPMID = id
+			break
+		}
+	}
+	return &ids, nil
+}
+
+func (s *memUsers) ListUsers(ctx context.Context, filter UserFilter) ([]User, int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	search := strings.ToLower(filter.Search)
+	var matched []User
+	for _, id := range sortedKeys(s.users) {
+		user := s.users[id]
+		if search != "" && !strings.Contains(strings.ToLower(user.Username), search) &&
+			!strings.Contains(strings.ToLower(user.Email), search) {
+			continue
+		}
+		if filter.UserType != "" && user.UserType != filter.UserType {
+			continue
+		}
+		if filter.Disabled != nil && user.Disabled != *filter.Disabled {
+			continue
+		}
+		matched = append(matched, user)
+	}
+
+	total := int64(len(matched))
+	if filter.Offset >= len(matched) {
+		return nil, total, nil
+	}
+	matched = matched[filter.Offset:]
+	if filter.Limit > 0 && filter.Limit < len(matched) {
+		matched = matched[:filter.Limit]
+	}
+	return matched, total, nil
+}
+
+// updateUser applies update to the user; the caller holds the lock.
+func (m *memoryDB) updateUser(userId uint, update func(user *User)) error {
+	user, ok := m.users[userId]
+	if !ok {
+		return ErrNotFound
+	}
+	update(&user)
+	user.UpdatedAt = time.Now()
+	m.users[userId] = user
+	return nil
+}
+
+func (s *memUsers) SetEmail(ctx context.Context, userId uint, email string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.updateUser(userId, func(user *User) { user.Email, user.EmailVerified = email, false })
+}
+
+func (s *memUsers) ChangeUserType(ctx context.Context, userId uint, userType string, oldRoleId uint, newRoleId uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.roles[newRoleId]; !ok {
+		return ErrNotFound
+	}
+	err := s.updateUser(userId, func(user *User) { user.UserType = userType })
+	if err != nil {
+		return err
+	}
+	delete(s.userRoles, userRoleKey{userId: userId, roleId: oldRoleId})
+	if _, ok := s.userRoles[userRoleKey{userId: userId, roleId: newRoleId}]; !ok {
+		s.userRoles[userRoleKey{userId: userId, roleId: newRoleId}] = time.Now()
+	}
+	return nil
+}
+
+func (s *memUsers) SetDisabled(ctx context.Context, userId uint, disabled bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.updateUser(userId, func(user *User) { user.Disabled = disabled })
+	if err != nil {
+		return err
+	}
+	if disabled {
+		s.revokeRefreshTokensLocked(func(token RefreshToken) bool { return token.UserID == userId })
+	}
+	return nil
+}
+
+func (s *memUsers) DeleteUser(ctx context.Context, userId uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userId]
+	if !ok {
+		return ErrNotFound
+	}
+	delete(s.users, userId)
+	for key := range s.userRoles {
+		if key.userId == userId {
+			delete(s.userRoles, key)
+		}
+	}
+	s.unlinkProfiles(ProfileStudent, user.Username)
+	s.unlinkProfiles(ProfileTeacher, user.Username)
+	s.unlinkProfiles(ProfileIPM, user.Username)
+	s.revokeRefreshTokensLocked(func(token RefreshToken) bool { return token.UserID == userId })
+	return nil
+}
+
+func (s *memUsers) ForcePasswordReset(ctx context.Context, userId uint, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.updateUser(userId, func(user *User) {
+		user.Password = ""
+		user.TokensNotBefore = &now
+	})
+	if err != nil {
+		return err
+	}
+	s.revokeRefreshTokensLocked(func(token RefreshToken) bool { return token.UserID == userId })
+	return nil
+}
+
+func (s *memUsers) LinkProfile(ctx context.Context, kind ProfileKind, profileId uint, username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var linked string
+	switch kind {
+	case ProfileStudent:
+		student, ok := s.students[profileId]
+		if !ok {
+			return ErrNotFound
+		}
+		if linked = student.Username; linked == "" {
+			student.Username = username
+			s.students[profileId] = student
+		}
+	case ProfileTeacher:
+		teacher, ok := s.teachers[profileId]
+		if !ok {
+			return ErrNotFound
+		}
+		if linked = teacher.Username; linked == "" {
+			teacher.Username = username
+			s.teachers[profileId] = teacher
+		}
+	case ProfileIPM:
+		ipm, ok := s.ipms[profileId]
+		if !ok {
+			return ErrNotFound
+		}
+		if linked = ipm.Username; linked == "" {
+			ipm.Username = username
+			s.ipms[profileId] = ipm
+		}
+	default:
+		return fmt.Errorf("unknown profile kind %q", kind)
+	}
+	if linked != "" {
+		return ErrConflict
+	}
+	return nil
+}
+
+func (s *memUsers) UnlinkProfile(ctx context.Context, kind ProfileKind, username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.unlinkProfiles(kind, username) == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// unlinkProfiles unlinks username's profiles of kind and returns how many
+// there were. The caller holds the lock.
+func (m *memoryDB) unlinkProfiles(kind ProfileKind, username string) int {
+	unlinked := 0
+	switch kind {
+	case ProfileStudent:
+		for id, student := range m.students {
+			if student.Username == username {
+				student.Username = ""
+				m.students[id] = student
+				unlinked++
+			}
+		}
+	case ProfileTeacher:
+		for id, teacher := range m.teachers {
+			if teacher.Username == username {
+				teacher.Username = ""
+				m.teachers[id] = teacher
+				unlinked++
+			}
+		}
+	case ProfileIPM:
+		for id, ipm := range m.ipms {
+			if ipm.Username == username {
+				ipm.Username = ""
+				m.ipms[id] = ipm
+				unlinked++
+			}
+		}
+	}
+	return unlinked
+}
+
+type memStudents struct {
+	*memoryDB
+}
+
+func (s *memStudents) CreateStudent(ctx context.Context, student *Student) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stamp(&student.Model)
+	stored := *student
+	stored.Attendance = nil
+	stored.MedicalClaims = nil
+	s.students[student.ID] = stored
+	return nil
+}
+
+func (s *memStudents) GetStudentByUsername(ctx context.Context, username string) (*Student, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, id := range sortedKeys(s.students) {
+		if student := s.students[id]; student.Username == username {
+			student.Attendance = s.attendanceOf(student.ID)
+			return &student, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memStudents) GetStudentByRegisterNumber(ctx context.Context, registerNumber string) (*Student, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, id := range sortedKeys(s.students) {
+		if student := s.students[id]; student.RegisterNumber == registerNumber {
+			return &student, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memStudents) GetStudent(ctx context.Context, id uint) (*Student, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	student, ok := s.students[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &student, nil
+}
+
+func (m *memoryDB) attendanceOf(studentId uint) []Attendance {
+	var records []Attendance
+	for _, id := range sortedKeys(m.attendance) {
+		if record := m.attendance[id]; record.StudentId == studentId {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+type memTeachers struct {
+	*memoryDB
+}
+
+func (s *memTeachers) CreateTeacher(ctx context.Context, teacher *Teacher) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stamp(&teacher.Model)
+	stored := *teacher
+	stored.Claim = nil
+	s.teachers[teacher.ID] = stored
+	return nil
+}
+
+func (s *memTeachers) GetTeacher(ctx context.Context, id uint) (*Teacher, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	teacher, ok := s.teachers[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	teacher.Claim = s.reviewsOf(TeacherKey(teacher.ID))
+	return &teacher, nil
+}
+
+func (s *memTeachers) GetTeacherByUsername(ctx context.Context, username string) (*Teacher, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, id := range sortedKeys(s.teachers) {
+		if teacher := s.teachers[id]; teacher.Username == username {
+			return &teacher, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+type memAttendance struct {
+	*memoryDB
+}
+
+func (s *memAttendance) CreateAttendance(ctx context.Context, attendance *Attendance, changedBy uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closedOn(attendance.Date) {
+		return ErrConflict
+	}
+	for _, record := range s.attendance {
+		if record.StudentId == attendance.StudentId && record.SectionID == attendance.SectionID &&
+			record.Date == attendance.Date && record.Period == attendance.Period {
+			return ErrDuplicate
+		}
+	}
+	s.createAttendance(attendance, changedBy)
+	return nil
+}
+
+func (s *memAttendance) GetAttendance(ctx context.Context, id uint) (*Attendance, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	record, ok := s.attendance[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &record, nil
+}
+
+func (s *memAttendance) SetAttendanceStatus(ctx context.Context, id uint, mark Mark, changedBy uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.attendance[id]
+	if !ok {
+		return ErrNotFound
+	}
+	state := record.State()
+	state.Status, state.Reason = mark.Status, mark.Reason
+	s.updateAttendance(record, state, changedBy, nil)
+	return nil
+}
+
+func (s *memAttendance) RecordRollCall(ctx context.Context, rollCall RollCall) ([]RollCallResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.sections[rollCall.SectionID]; !ok {
+		return nil, ErrNotFound
+	}
+	if s.closedOn(rollCall.Date) {
+		return nil, ErrConflict
+	}
+
+	recorded := map[uint]Attendance{}
+	for _, id := range sortedKeys(s.attendance) {
+		record := s.attendance[id]
+		if record.SectionID != rollCall.SectionID || record.Date != rollCall.Date || record.Period != rollCall.Period {
+			continue
+		}
+		if _, ok := recorded[record.StudentId]; !ok {
+			recorded[record.StudentId] = record
+		}
+	}
+
+	var results []RollCallResult
+	for _, studentId := range sortedKeys(rollCall.Marks) {
+		mark := rollCall.Marks[studentId]
+		result := RollCallResult{StudentID: studentId, Mark: mark, Outcome: RollCallUnchanged}
+		if record, ok := recorded[studentId]; ok {
+			result.AttendanceID = record.ID
+			if record.Status != mark.Status || record.Reason != mark.Reason {
+				state := record.State()
+				state.Status, state.Reason = mark.Status, mark.Reason
+				s.updateAttendance(record, state, rollCall.ChangedBy, nil)
+				result.Outcome = RollCallUpdated
+			}
+		} else {
+			record := Attendance{
+				StudentId: studentId,
+				SectionID: rollCall.SectionID,
+				Date:      rollCall.Date,
+				Period:    rollCall.Period,
+				TeacherId: rollCall.TeacherID,
+				Status:    mark.Status,
+				Reason:    mark.Reason,
+			}
+			s.createAttendance(&record, rollCall.ChangedBy)
+			result.AttendanceID = record.ID
+			result.Outcome = RollCallCreated
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func (s *memAttendance) ListAttendanceSummaries(ctx context.Context, studentId uint) ([]AttendanceSummary, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var summaries []AttendanceSummary
+	for key, summary := range s.summaries {
+		if key.studentId == studentId {
+			summary.Course = s.courses[key.courseId]
+			summaries = append(summaries, summary)
+		}
+	}
+	sortSummaries(summaries)
+	return summaries, nil
+}
+
+func (s *memAttendance) ListAttendanceChanges(ctx context.Context, attendanceId uint) ([]AttendanceChange, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var changes []AttendanceChange
+	for _, change := range s.changes {
+		if change.AttendanceID == attendanceId {
+			changes = append(changes, change)
+		}
+	}
+	return changes, nil
+}
+
+// createAttendance stores a record with the first entry of its history.
+func (m *memoryDB) createAttendance(record *Attendance, changedBy uint) {
+	m.stamp(&record.Model)
+	m.attendance[record.ID] = *record
+	m.nextID++
+	m.changes = append(m.changes, AttendanceChange{
+		ID:           m.nextID,
+		CreatedAt:    record.CreatedAt,
+		AttendanceID: record.ID,
+		ChangedBy:    changedBy,
+		After:        record.State(),
+	})
+	m.refreshSummary(record.StudentId, record.SectionID)
+}
+
+// updateAttendance gives a record the new state and writes the change to
+// its history.
+func (m *memoryDB) updateAttendance(record Attendance, state AttendanceState, changedBy uint, correctionId *uint) {
+	before := record.State()
+	if state == before {
+		return
+	}
+	record.Status, record.Reason, record.IsApplied, record.IsClaimed = state.Status, state.Reason, state.IsApplied, state.IsClaimed
+	record.UpdatedAt = time.Now()
+	m.attendance[record.ID] = record
+	m.nextID++
+	m.changes = append(m.changes, AttendanceChange{
+		ID:           m.nextID,
+		CreatedAt:    record.UpdatedAt,
+		AttendanceID: record.ID,
+		ChangedBy:    changedBy,
+		CorrectionID: correctionId,
+		Before:       &before,
+		After:        state,
+	})
+	m.refreshSummary(record.StudentId, record.SectionID)
+}
+
+// refreshSummary recounts the student's attendance in the course of the
+// section, as the Postgres store does after every change.
+func (m *memoryDB) refreshSummary(studentId, sectionId uint) {
+	courseId := m.sections[sectionId].CourseID
+	for key := range m.summaries {
+		if key.studentId == studentId && key.courseId == courseId {
+			delete(m.summaries, key)
+		}
+	}
+	now := time.Now()
+	for _, record := range m.attendance {
+		if record.StudentId != studentId || m.sections[record.SectionID].CourseID != courseId {
+			continue
+		}
+		key := summaryKey{studentId, courseId, record.Status}
+		summary, ok := m.summaries[key]
+		if !ok {
+			summary = AttendanceSummary{StudentID: studentId, CourseID: courseId, Status: record.Status, UpdatedAt: now}
+		}
+		summary.Classes++
+		if record.Status == AttendanceAbsent && record.IsApplied {
+			summary.Claimed++
+		}
+		m.summaries[key] = summary
+	}
+}
+
+func (s *memAttendance) FindAttendance(ctx context.Context, studentId uint, date Date, period string) ([]Attendance, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var records []Attendance
+	for _, record := range s.attendanceOf(studentId) {
+		if record.Date == date && record.Period == period {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+func (s *memAttendance) ListAttendance(ctx context.Context, filter AttendanceFilter) ([]Attendance, int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	matched := s.filterAttendance(filter)
+	sort.SliceStable(matched, func(i, j int) bool {
+		if matched[i].Date != matched[j].Date {
+			return matched[i].Date.Before(matched[j].Date)
+		}
+		return matched[i].Period < matched[j].Period
+	})
+
+	total := int64(len(matched))
+	if filter.Offset >= len(matched) {
+		return nil, total, nil
+	}
+	matched = matched[filter.Offset:]
+	if filter.Limit > 0 && filter.Limit < len(matched) {
+		matched = matched[:filter.Limit]
+	}
+	return matched, total, nil
+}
+
+func (s *memAttendance) SummarizeAttendance(ctx context.Context, filter AttendanceFilter) ([]AttendanceSummary, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counted := map[summaryKey]AttendanceSummary{}
+	for _, record := range s.filterAttendance(filter) {
+		courseId := s.sections[record.SectionID].CourseID
+		key := summaryKey{record.StudentId, courseId, record.Status}
+		summary := counted[key]
+		summary.StudentID, summary.CourseID, summary.Status = record.StudentId, courseId, record.Status
+		summary.Course = s.courses[courseId]
+		summary.Classes++
+		if record.Status == AttendanceAbsent && record.IsApplied {
+			summary.Claimed++
+		}
+		counted[key] = summary
+	}
+
+	var summaries []AttendanceSummary
+	for _, summary := range counted {
+		summaries = append(summaries, summary)
+	}
+	sortSummaries(summaries)
+	return summaries, nil
+}
+
+// filterAttendance returns the records matching filter in ID order; the
+// caller holds the lock.
+func (m *memoryDB) filterAttendance(filter AttendanceFilter) []Attendance {
+	var matched []Attendance
+	for _, id := range sortedKeys(m.attendance) {
+		record := m.attendance[id]
+		if filter.StudentID != 0 && record.StudentId != filter.StudentID {
+			continue
+		}
+		if filter.SectionID != 0 && record.SectionID != filter.SectionID {
+			continue
+		}
+		if filter.CourseID != 0 && m.sections[record.SectionID].CourseID != filter.CourseID {
+			continue
+		}
+		if filter.TeacherID != "" && record.TeacherId != filter.TeacherID {
+			continue
+		}
+		if filter.Status != "" && record.Status != filter.Status {
+			continue
+		}
+		if !filter.From.IsZero() && record.Date.Before(filter.From) {
+			continue
+		}
+		if !filter.To.IsZero() && record.Date.After(filter.To) {
+			continue
+		}
+		matched = append(matched, record)
+	}
+	return matched
+}
+
+type memClaims struct {
+	*memoryDB
+}
+
+func (s *memClaims) CreateClaim(ctx context.Context, claim *MedicalClaim, changedBy uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if claim.Status == "" {
+		claim.Status = "Pending"
+	}
+	s.stamp(&claim.Model)
+	for i := range claim.Files {
+		claim.Files[i].MedicalClaimID = claim.ID
+		s.stamp(&claim.Files[i].Model)
+		s.files[claim.Files[i].ID] = claim.Files[i]
+	}
+	for i := range claim.ClaimReviews {
+		claim.ClaimReviews[i].ClaimId = claim.ID
+		if claim.ClaimReviews[i].Status == "" {
+			claim.ClaimReviews[i].Status = "Pending"
+		}
+		s.stamp(&claim.ClaimReviews[i].Model)
+		s.reviews[claim.ClaimReviews[i].ID] = claim.ClaimReviews[i]
+		if record, ok := s.attendance[claim.ClaimReviews[i].AttendanceId]; ok {
+			state := record.State()
+			state.IsClaimed = true
+			s.updateAttendance(record, state, changedBy, nil)
+		}
+	}
+
+	stored := *claim
+	stored.Files = nil
+	stored.ClaimReviews = nil
+	s.claims[claim.ID] = stored
+	return nil
+}
+
+func (s *memClaims) GetClaim(ctx context.Context, id uint) (*MedicalClaim, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	claim, ok := s.claims[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	s.preloadClaim(&claim, true)
+	return &claim, nil
+}
+
+// preloadClaim fills in the associations the Postgres store preloads.
+func (m *memoryDB) preloadClaim(claim *MedicalClaim, withReviews bool) {
+	claim.Student = m.students[claim.StudentId]
+	claim.Files = nil
+	for _, id := range sortedKeys(m.files) {
+		if file := m.files[id]; file.MedicalClaimID == claim.ID {
+			claim.Files = append(claim.Files, file)
+		}
+	}
+	if !withReviews {
+		return
+	}
+	claim.ClaimReviews = nil
+	for _, id := range sortedKeys(m.reviews) {
+		review := m.reviews[id]
+		if review.ClaimId != claim.ID {
+			continue
+		}
+		review.Attendance = m.attendance[review.AttendanceId]
+		for _, teacher := range m.teachers {
+			if TeacherKey(teacher.ID) == review.TeacherId {
+				review.Teacher = teacher
+			}
+		}
+		claim.ClaimReviews = append(claim.ClaimReviews, review)
+	}
+}
+
+func (s *memClaims) ListClaimsByStudent(ctx context.Context, studentId uint) ([]MedicalClaim, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var claims []MedicalClaim
+	for _, id := range sortedKeys(s.claims) {
+		if claim := s.claims[id]; claim.StudentId == studentId {
+			claims = append(claims, claim)
+		}
+	}
+	return claims, nil
+}
+
+func (s *memClaims) ListReviewedClaims(ctx context.Context) ([]MedicalClaim, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	pending := map[uint]bool{}
+	for _, review := range s.reviews {
+		if review.Status == "pending" {
+			pending[review.ClaimId] = true
+		}
+	}
+
+	var claims []MedicalClaim
+	for _, id := range sortedKeys(s.claims) {
+		if pending[id] {
+			continue
+		}
+		claim := s.claims[id]
+		s.preloadClaim(&claim, true)
+		claims = append(claims, claim)
+	}
+	return claims, nil
+}
+
+func (s *memClaims) UpdateClaimStatus(ctx context.Context, id uint, status string, message string, changedBy uint) (*MedicalClaim, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	claim, ok := s.claims[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if status != "" {
+		claim.Status = status
+	}
+	if message != "" {
+		claim.Message = message
+	}
+	claim.UpdatedAt = time.Now()
+	s.claims[id] = claim
+
+	if status != "" {
+		approved := strings.EqualFold(status, ClaimApproved)
+		for _, reviewId := range sortedKeys(s.reviews) {
+			review := s.reviews[reviewId]
+			record, ok := s.attendance[review.AttendanceId]
+			if review.ClaimId != id || !ok {
+				continue
+			}
+			state := record.State()
+			state.IsApplied = approved
+			s.updateAttendance(record, state, changedBy, nil)
+		}
+	}
+	return &claim, nil
+}
+
+func (s *memClaims) ListReviewsByTeacher(ctx context.Context, teacherId string) ([]ClaimReview, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	reviews := s.reviewsOf(teacherId)
+	for i := range reviews {
+		claim := s.claims[reviews[i].ClaimId]
+		s.preloadClaim(&claim, false)
+		reviews[i].MedicalClaim = claim
+	}
+	return reviews, nil
+}
+
+func (m *memoryDB) reviewsOf(teacherId string) []ClaimReview {
+	var reviews []ClaimReview
+	for _, id := range sortedKeys(m.reviews) {
+		if review := m.reviews[id]; review.TeacherId == teacherId {
+			reviews = append(reviews, review)
+		}
+	}
+	return reviews
+}
+
+func (s *memClaims) GetClaimReview(ctx context.Context, id uint) (*ClaimReview, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	review, ok := s.reviews[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &review, nil
+}
+
+func (s *memClaims) UpdateClaimReview(ctx context.Context, review *ClaimReview) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.reviews[review.ID]; !ok {
+		return ErrNotFound
+	}
+	review.UpdatedAt = time.Now()
+	stored := *review
+	stored.MedicalClaim = MedicalClaim{}
+	stored.Attendance = Attendance{}
+	stored.Teacher = Teacher{}
+	s.reviews[review.ID] = stored
+	return nil
+}
@@ -0,0 +1,81 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+type memAPIKeys struct {
+	*memoryDB
+}
+
+func (s *memAPIKeys) CreateAPIKey(ctx context.Context, key *APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.apiKeys {
+		if existing.KeyHash == key.KeyHash {
+			return ErrDuplicate
+		}
+	}
+	s.nextID++
+	key.ID = s.nextID
+	key.CreatedAt = time.Now()
+	s.apiKeys[key.ID] = *key
+	return nil
+}
+
+func (s *memAPIKeys) GetAPIKeyByHash(ctx context.Context, keyHash string) (*APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, key := range s.apiKeys {
+		if key.KeyHash == keyHash {
+			return &key, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memAPIKeys) ListAPIKeys(ctx context.Context, userId uint) ([]APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var keys []APIKey
+	for _, key := range s.apiKeys {
+		if userId == 0 || key.UserID == userId {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID > keys[j].ID })
+	return keys, nil
+}
+
+func (s *memAPIKeys) RevokeAPIKey(ctx context.Context, id uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.apiKeys[id]
+	if !ok || key.RevokedAt != nil {
+		return ErrNotFound
+	}
+	now := time.Now()
+	key.RevokedAt = &now
+	s.apiKeys[id] = key
+	return nil
+}
+
+func (s *memAPIKeys) TouchAPIKey(ctx context.Context, id uint, ip string, now time.Time, notBefore time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.apiKeys[id]
+	if !ok || (key.LastUsedAt != nil && !key.LastUsedAt.Before(notBefore)) {
+		return nil
+	}
+	key.LastUsedAt = &now
+	key.LastUsedIP = ip
+	s.apiKeys[id] = key
+	return nil
+}
@@ -0,0 +1,125 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+type memCalendar struct {
+	*memoryDB
+}
+
+func (s *memCalendar) CreateTerm(ctx context.Context, term *Term) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, other := range s.terms {
+		if other.Name == term.Name {
+			return ErrDuplicate
+		}
+		if !other.EndDate.Before(term.StartDate) && !term.EndDate.Before(other.StartDate) {
+			return ErrConflict
+		}
+	}
+	s.nextID++
+	term.ID = s.nextID
+	term.CreatedAt = time.Now()
+	s.terms[term.ID] = *term
+	return nil
+}
+
+func (s *memCalendar) GetTermByName(ctx context.Context, name string) (*Term, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, term := range s.terms {
+		if term.Name == name {
+			return &term, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memCalendar) ListTerms(ctx context.Context) ([]Term, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var terms []Term
+	for _, term := range s.terms {
+		terms = append(terms, term)
+	}
+	sort.Slice(terms, func(i, j int) bool { return terms[i].StartDate.Before(terms[j].StartDate) })
+	return terms, nil
+}
+
+func (s *memCalendar) DeleteTerm(ctx context.Context, id uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.terms[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.terms, id)
+	return nil
+}
+
+func (s *memCalendar) CreateEvent(ctx context.Context, event *CalendarEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if closes(event.Kind) {
+		for _, record := range s.attendance {
+			if !record.Date.Before(event.StartDate) && !record.Date.After(event.EndDate) {
+				return ErrConflict
+			}
+		}
+	}
+	s.nextID++
+	event.ID = s.nextID
+	event.CreatedAt = time.Now()
+	s.calendarEvents[event.ID] = *event
+	return nil
+}
+
+func (s *memCalendar) ListEvents(ctx context.Context, from, to Date) ([]CalendarEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var events []CalendarEvent
+	for _, id := range sortedKeys(s.calendarEvents) {
+		event := s.calendarEvents[id]
+		if !event.EndDate.Before(from) && !event.StartDate.After(to) {
+			events = append(events, event)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].StartDate.Before(events[j].StartDate) })
+	return events, nil
+}
+
+func (s *memCalendar) DeleteEvent(ctx context.Context, id uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.calendarEvents[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.calendarEvents, id)
+	return nil
+}
+
+// closes reports whether events of kind leave their days without classes.
+func closes(kind string) bool {
+	return kind == EventHoliday || kind == EventExams
+}
+
+// closedOn reports whether a holiday or exams cover date. The caller holds
+// the lock.
+func (m *memoryDB) closedOn(date Date) bool {
+	for _, event := range m.calendarEvents {
+		if closes(event.Kind) && !date.Before(event.StartDate) && !date.After(event.EndDate) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+type memCorrections struct {
+	*memoryDB
+}
+
+func (s *memCorrections) CreateCorrection(ctx context.Context, correction *AttendanceCorrection) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.attendance[correction.AttendanceID]
+	if !ok {
+		return ErrNotFound
+	}
+	for _, other := range s.corrections {
+		if other.AttendanceID == record.ID && other.State == CorrectionPending {
+			return ErrDuplicate
+		}
+	}
+	s.nextID++
+	correction.ID = s.nextID
+	correction.CreatedAt = time.Now()
+	if correction.State == "" {
+		correction.State = CorrectionPending
+	}
+	s.corrections[correction.ID] = *correction
+	if correction.State == CorrectionApproved {
+		s.applyCorrection(record, *correction, correction.RequestedBy)
+	}
+	return nil
+}
+
+func (s *memCorrections) GetCorrection(ctx context.Context, id uint) (*AttendanceCorrection, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	correction, ok := s.corrections[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &correction, nil
+}
+
+func (s *memCorrections) ListCorrections(ctx context.Context, filter CorrectionFilter) ([]AttendanceCorrection, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var corrections []AttendanceCorrection
+	ids := sortedKeys(s.corrections)
+	for i := len(ids) - 1; i >= 0; i-- {
+		correction := s.corrections[ids[i]]
+		if filter.AttendanceID != 0 && correction.AttendanceID != filter.AttendanceID {
+			continue
+		}
+		if filter.RequestedBy != 0 && correction.RequestedBy != filter.RequestedBy {
+			continue
+		}
+		if filter.State != "" && correction.State != filter.State {
+			continue
+		}
+		corrections = append(corrections, correction)
+	}
+	return corrections, nil
+}
+
+func (s *memCorrections) ReviewCorrection(ctx context.Context, id uint, approve bool, reviewedBy uint, comment string) (*AttendanceCorrection, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	correction, ok := s.corrections[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if correction.State != CorrectionPending {
+		return nil, ErrConflict
+	}
+
+	now := time.Now()
+	correction.State = CorrectionRejected
+	if approve {
+		correction.State = CorrectionApproved
+	}
+	correction.ReviewedBy = &reviewedBy
+	correction.ReviewedAt = &now
+	correction.ReviewComment = comment
+	s.corrections[id] = correction
+	if approve {
+		s.applyCorrection(s.attendance[correction.AttendanceID], correction, reviewedBy)
+	}
+	return &correction, nil
+}
+
+// applyCorrection gives the record the status the correction asks for.
+func (m *memoryDB) applyCorrection(record Attendance, correction AttendanceCorrection, changedBy uint) {
+	state := record.State()
+	state.Status, state.Reason = correction.Status, correction.Reason
+	m.updateAttendance(record, state, changedBy, &correction.ID)
+}
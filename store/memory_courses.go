@@ -0,0 +1,257 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+type memCourses struct {
+	*memoryDB
+}
+
+func (s *memCourses) CreateCourse(ctx context.Context, course *Course) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.courseCodeTaken(course.Code, 0) {
+		return ErrDuplicate
+	}
+	s.stamp(&course.Model)
+	s.courses[course.ID] = *course
+	return nil
+}
+
+func (s *memCourses) GetCourse(ctx context.Context, id uint) (*Course, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	course, ok := s.courses[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &course, nil
+}
+
+func (s *memCourses) ListCourses(ctx context.Context) ([]Course, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var courses []Course
+	for _, course := range s.courses {
+		courses = append(courses, course)
+	}
+	sort.Slice(courses, func(i, j int) bool { return courses[i].Code < courses[j].Code })
+	return courses, nil
+}
+
+func (s *memCourses) UpdateCourse(ctx context.Context, course *Course) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.courses[course.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if s.courseCodeTaken(course.Code, course.ID) {
+		return ErrDuplicate
+	}
+	stored.Code = course.Code
+	stored.Name = course.Name
+	stored.UpdatedAt = time.Now()
+	s.courses[course.ID] = stored
+	*course = stored
+	return nil
+}
+
+func (s *memCourses) DeleteCourse(ctx context.Context, id uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.courses[id]; !ok {
+		return ErrNotFound
+	}
+	for _, section := range s.sections {
+		if section.CourseID == id {
+			return ErrConflict
+		}
+	}
+	delete(s.courses, id)
+	return nil
+}
+
+// courseCodeTaken reports whether a course other than exceptId has code.
+func (m *memoryDB) courseCodeTaken(code string, exceptId uint) bool {
+	for _, course := range m.courses {
+		if course.Code == code && course.ID != exceptId {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *memCourses) CreateSection(ctx context.Context, section *Section) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.sectionNameTaken(section) {
+		return ErrDuplicate
+	}
+	s.stamp(&section.Model)
+	s.sections[section.ID] = *section
+	return nil
+}
+
+func (s *memCourses) GetSection(ctx context.Context, id uint) (*Section, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	section, ok := s.sections[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &section, nil
+}
+
+func (s *memCourses) ListSections(ctx context.Context, filter SectionFilter) ([]Section, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var sections []Section
+	for _, id := range sortedKeys(s.sections) {
+		section := s.sections[id]
+		if filter.CourseID != 0 && section.CourseID != filter.CourseID {
+			continue
+		}
+		if filter.TeacherID != 0 && (section.TeacherID == nil || *section.TeacherID != filter.TeacherID) {
+			continue
+		}
+		if filter.StudentID != 0 && !s.isEnrolled(section.ID, filter.StudentID) {
+			continue
+		}
+		if filter.Term != "" && section.Term != filter.Term {
+			continue
+		}
+		sections = append(sections, section)
+	}
+	return sections, nil
+}
+
+func (s *memCourses) UpdateSection(ctx context.Context, section *Section) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.sections[section.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	stored.Name = section.Name
+	stored.Term = section.Term
+	stored.TeacherID = section.TeacherID
+	if s.sectionNameTaken(&stored) {
+		return ErrDuplicate
+	}
+	stored.UpdatedAt = time.Now()
+	s.sections[section.ID] = stored
+	*section = stored
+	return nil
+}
+
+func (s *memCourses) DeleteSection(ctx context.Context, id uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.sections[id]; !ok {
+		return ErrNotFound
+	}
+	for _, record := range s.attendance {
+		if record.SectionID == id {
+			return ErrConflict
+		}
+	}
+	for enrollmentId, enrollment := range s.enrollments {
+		if enrollment.SectionID == id {
+			delete(s.enrollments, enrollmentId)
+		}
+	}
+	for slotId, slot := range s.timetableSlots {
+		if slot.SectionID == id {
+			delete(s.timetableSlots, slotId)
+		}
+	}
+	delete(s.sections, id)
+	return nil
+}
+
+// sectionNameTaken reports whether another section of the course has the
+// same name in the same term.
+func (m *memoryDB) sectionNameTaken(section *Section) bool {
+	for _, other := range m.sections {
+		if other.ID != section.ID && other.CourseID == section.CourseID &&
+			other.Term == section.Term && other.Name == section.Name {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *memCourses) Enroll(ctx context.Context, sectionId uint, studentIds []uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, studentId := range studentIds {
+		if s.isEnrolled(sectionId, studentId) {
+			continue
+		}
+		s.nextID++
+		s.enrollments[s.nextID] = Enrollment{
+			ID:        s.nextID,
+			CreatedAt: time.Now(),
+			SectionID: sectionId,
+			StudentID: studentId,
+		}
+	}
+	return nil
+}
+
+func (s *memCourses) Unenroll(ctx context.Context, sectionId uint, studentId uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, enrollment := range s.enrollments {
+		if enrollment.SectionID == sectionId && enrollment.StudentID == studentId {
+			delete(s.enrollments, id)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (s *memCourses) IsEnrolled(ctx context.Context, sectionId uint, studentId uint) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.isEnrolled(sectionId, studentId), nil
+}
+
+func (s *memCourses) ListEnrolledStudents(ctx context.Context, sectionId uint) ([]Student, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var students []Student
+	for _, id := range sortedKeys(s.students) {
+		if s.isEnrolled(sectionId, id) {
+			students = append(students, s.students[id])
+		}
+	}
+	return students, nil
+}
+
+func (m *memoryDB) isEnrolled(sectionId uint, studentId uint) bool {
+	for _, enrollment := range m.enrollments {
+		if enrollment.SectionID == sectionId && enrollment.StudentID == studentId {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+type memImpersonations struct {
+	*memoryDB
+}
+
+func (s *memImpersonations) CreateImpersonation(ctx context.Context, impersonation *Impersonation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	impersonation.ID = s.nextID
+	impersonation.CreatedAt = time.Now()
+	s.impersonations[impersonation.ID] = *impersonation
+	return nil
+}
+
+func (s *memImpersonations) GetImpersonation(ctx context.Context, id uint) (*Impersonation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	impersonation, ok := s.impersonations[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &impersonation, nil
+}
+
+func (s *memImpersonations) ListImpersonations(ctx context.Context, userId uint, limit int) ([]Impersonation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ids := sortedKeys(s.impersonations)
+	var impersonations []Impersonation
+	for i := len(ids) - 1; i >= 0 && len(impersonations) < limit; i-- {
+		if impersonation := s.impersonations[ids[i]]; userId == 0 || impersonation.UserID == userId {
+			impersonations = append(impersonations, impersonation)
+		}
+	}
+	return impersonations, nil
+}
+
+func (s *memImpersonations) EndImpersonation(ctx context.Context, id uint, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	impersonation, ok := s.impersonations[id]
+	if !ok || impersonation.EndedAt != nil {
+		return ErrNotFound
+	}
+	impersonation.EndedAt = &now
+	s.impersonations[id] = impersonation
+	return nil
+}
+
+func (s *memImpersonations) RecordImpersonationAction(ctx context.Context, action *ImpersonationAction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	action.ID = s.nextID
+	action.CreatedAt = time.Now()
+	s.impersonationActions = append(s.impersonationActions, *action)
+	return nil
+}
+
+func (s *memImpersonations) ListImpersonationActions(ctx context.Context, impersonationId uint) ([]ImpersonationAction, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var actions []ImpersonationAction
+	for _, action := range s.impersonationActions {
+		if action.ImpersonationID == impersonationId {
+			actions = append(actions, action)
+		}
+	}
+	return actions, nil
+}
@@ -0,0 +1,79 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+type memInvitations struct {
+	*memoryDB
+}
+
+func (s *memInvitations) CreateInvitation(ctx context.Context, invitation *Invitation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	invitation.ID = s.nextID
+	invitation.CreatedAt = time.Now()
+	s.invitations[invitation.ID] = *invitation
+	return nil
+}
+
+func (s *memInvitations) GetInvitationByToken(ctx context.Context, tokenHash string) (*Invitation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, invitation := range s.invitations {
+		if invitation.TokenHash == tokenHash {
+			return &invitation, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memInvitations) ListPendingInvitations(ctx context.Context, now time.Time) ([]Invitation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var invitations []Invitation
+	for _, invitation := range s.invitations {
+		if invitation.UsedAt == nil && invitation.ExpiresAt.After(now) {
+			invitations = append(invitations, invitation)
+		}
+	}
+	sort.Slice(invitations, func(i, j int) bool { return invitations[i].ID > invitations[j].ID })
+	return invitations, nil
+}
+
+func (s *memInvitations) DeleteInvitation(ctx context.Context, id uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	invitation, ok := s.invitations[id]
+	if !ok || invitation.UsedAt != nil {
+		return ErrNotFound
+	}
+	delete(s.invitations, id)
+	return nil
+}
+
+func (s *memInvitations) RedeemInvitation(ctx context.Context, id uint, account *NewAccount) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	invitation, ok := s.invitations[id]
+	if !ok || invitation.UsedAt != nil || !invitation.ExpiresAt.After(now) {
+		return ErrConflict
+	}
+	if err := s.createAccount(account); err != nil {
+		return err
+	}
+
+	invitation.UsedAt = &now
+	invitation.UsedByID = &account.User.ID
+	s.invitations[id] = invitation
+	return nil
+}
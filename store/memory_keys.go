@@ -0,0 +1,83 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+type memKeys struct {
+	*memoryDB
+}
+
+// sortSigningKeys orders keys the way ListSigningKeys returns them.
+func sortSigningKeys(keys []SigningKey) {
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].ActiveAt.Equal(keys[j].ActiveAt) {
+			return keys[i].ActiveAt.Before(keys[j].ActiveAt)
+		}
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+}
+
+func (s *memKeys) ListSigningKeys(ctx context.Context, now time.Time) ([]SigningKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var keys []SigningKey
+	for _, key := range s.signingKeys {
+		if key.ExpiresAt == nil || key.ExpiresAt.After(now) {
+			keys = append(keys, key)
+		}
+	}
+	sortSigningKeys(keys)
+	return keys, nil
+}
+
+func (s *memKeys) AddSigningKey(ctx context.Context, key *SigningKey, previousKID string, retireAfter time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]SigningKey, 0, len(s.signingKeys))
+	for _, existing := range s.signingKeys {
+		keys = append(keys, existing)
+	}
+	sortSigningKeys(keys)
+	newest := ""
+	if len(keys) > 0 {
+		newest = keys[len(keys)-1].KID
+	}
+	if newest != previousKID {
+		return ErrConflict
+	}
+	if _, ok := s.signingKeys[key.KID]; ok {
+		return ErrDuplicate
+	}
+
+	expiresAt := key.ActiveAt.Add(retireAfter)
+	for kid, existing := range s.signingKeys {
+		if existing.ActiveAt.After(key.ActiveAt) {
+			withdrawn := key.ActiveAt
+			existing.ExpiresAt = &withdrawn
+			s.signingKeys[kid] = existing
+		} else if existing.ExpiresAt == nil {
+			existing.ExpiresAt = &expiresAt
+			s.signingKeys[kid] = existing
+		}
+	}
+	key.CreatedAt = time.Now()
+	s.signingKeys[key.KID] = *key
+	return nil
+}
+
+func (s *memKeys) PurgeExpiredSigningKeys(ctx context.Context, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for kid, key := range s.signingKeys {
+		if key.ExpiresAt != nil && key.ExpiresAt.Before(now) {
+			delete(s.signingKeys, kid)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+type memLogins struct {
+	*memoryDB
+}
+
+func (s *memLogins) RecordLoginEvent(ctx context.Context, event *LoginEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	event.ID = s.nextID
+	event.CreatedAt = time.Now()
+	s.loginEvents = append(s.loginEvents, *event)
+	return nil
+}
+
+func (s *memLogins) CountFailedLogins(ctx context.Context, ip string, since time.Time) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var count int64
+	for _, event := range s.loginEvents {
+		if event.IP == ip && !event.Success && !event.CreatedAt.Before(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *memLogins) ListLoginEvents(ctx context.Context, userId uint, limit int) ([]LoginEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var events []LoginEvent
+	for i := len(s.loginEvents) - 1; i >= 0 && len(events) < limit; i-- {
+		if event := s.loginEvents[i]; event.UserID != nil && *event.UserID == userId {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
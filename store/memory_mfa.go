@@ -0,0 +1,113 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+type memMFA struct {
+	*memoryDB
+}
+
+func (s *memMFA) SetTOTPSecret(ctx context.Context, userId uint, secret string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userId]
+	if !ok || user.TOTPEnabled {
+		return ErrConflict
+	}
+	user.TOTPSecret = secret
+	s.users[userId] = user
+	return nil
+}
+
+func (s *memMFA) EnableTOTP(ctx context.Context, userId uint, step int64, codeHashes []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userId]
+	if !ok || user.TOTPEnabled || user.TOTPSecret == "" {
+		return ErrConflict
+	}
+	user.TOTPEnabled = true
+	user.TOTPLastStep = step
+	s.users[userId] = user
+	s.replaceRecoveryCodes(userId, codeHashes)
+	return nil
+}
+
+func (s *memMFA) UseTOTPStep(ctx context.Context, userId uint, step int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userId]
+	if !ok || user.TOTPLastStep >= step {
+		return ErrConflict
+	}
+	user.TOTPLastStep = step
+	s.users[userId] = user
+	return nil
+}
+
+func (s *memMFA) DisableTOTP(ctx context.Context, userId uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if user, ok := s.users[userId]; ok {
+		user.TOTPSecret = ""
+		user.TOTPEnabled = false
+		user.TOTPLastStep = 0
+		s.users[userId] = user
+	}
+	s.replaceRecoveryCodes(userId, nil)
+	return nil
+}
+
+func (s *memMFA) ReplaceRecoveryCodes(ctx context.Context, userId uint, codeHashes []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.replaceRecoveryCodes(userId, codeHashes)
+	return nil
+}
+
+func (m *memoryDB) replaceRecoveryCodes(userId uint, codeHashes []string) {
+	for id, code := range m.recoveryCodes {
+		if code.UserID == userId {
+			delete(m.recoveryCodes, id)
+		}
+	}
+	for _, hash := range codeHashes {
+		m.nextID++
+		m.recoveryCodes[m.nextID] = RecoveryCode{ID: m.nextID, UserID: userId, CodeHash: hash}
+	}
+}
+
+func (s *memMFA) UseRecoveryCode(ctx context.Context, userId uint, codeHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, code := range s.recoveryCodes {
+		if code.UserID == userId && code.CodeHash == codeHash && code.UsedAt == nil {
+			now := time.Now()
+			code.UsedAt = &now
+			s.recoveryCodes[id] = code
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (s *memMFA) CountRecoveryCodes(ctx context.Context, userId uint) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var count int64
+	for _, code := range s.recoveryCodes {
+		if code.UserID == userId && code.UsedAt == nil {
+			count++
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,58 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+func (s *memAttendance) CreateReason(ctx context.Context, reason *AttendanceReason) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.reasons[reason.Code]; ok {
+		return ErrDuplicate
+	}
+	reason.CreatedAt = time.Now()
+	s.reasons[reason.Code] = *reason
+	return nil
+}
+
+func (s *memAttendance) GetReason(ctx context.Context, code string) (*AttendanceReason, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	reason, ok := s.reasons[code]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &reason, nil
+}
+
+func (s *memAttendance) ListReasons(ctx context.Context) ([]AttendanceReason, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	reasons := make([]AttendanceReason, 0, len(s.reasons))
+	for _, reason := range s.reasons {
+		reasons = append(reasons, reason)
+	}
+	sort.Slice(reasons, func(i, j int) bool { return reasons[i].Code < reasons[j].Code })
+	return reasons, nil
+}
+
+func (s *memAttendance) DeleteReason(ctx context.Context, code string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.reasons[code]; !ok {
+		return ErrNotFound
+	}
+	for _, record := range s.attendance {
+		if record.Reason == code {
+			return ErrConflict
+		}
+	}
+	delete(s.reasons, code)
+	return nil
+}
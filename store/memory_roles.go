@@ -0,0 +1,148 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+type memRoles struct {
+	*memoryDB
+}
+
+func (s *memRoles) ListRoles(ctx context.Context) ([]Role, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var roles []Role
+	for _, role := range s.roles {
+		roles = append(roles, role)
+	}
+	sort.Slice(roles, func(i, j int) bool { return roles[i].Name < roles[j].Name })
+	return roles, nil
+}
+
+func (s *memRoles) GetRoleByName(ctx context.Context, name string) (*Role, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, role := range s.roles {
+		if role.Name == name {
+			return &role, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memRoles) CreateRole(ctx context.Context, role *Role) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.roles {
+		if existing.Name == role.Name {
+			return ErrDuplicate
+		}
+	}
+	s.nextID++
+	role.ID = s.nextID
+	role.CreatedAt = time.Now()
+	role.UpdatedAt = role.CreatedAt
+	for i := range role.Permissions {
+		role.Permissions[i].RoleID = role.ID
+	}
+	stored := *role
+	stored.Permissions = append([]RolePermission(nil), role.Permissions...)
+	s.roles[role.ID] = stored
+	return nil
+}
+
+func (s *memRoles) SetRolePermissions(ctx context.Context, roleId uint, permissions []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	role, ok := s.roles[roleId]
+	if !ok {
+		return ErrNotFound
+	}
+	role.Permissions = nil
+	for _, permission := range permissions {
+		role.Permissions = append(role.Permissions, RolePermission{RoleID: roleId, Permission: permission})
+	}
+	role.UpdatedAt = time.Now()
+	s.roles[roleId] = role
+	return nil
+}
+
+func (s *memRoles) DeleteRole(ctx context.Context, roleId uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.roles[roleId]; !ok {
+		return ErrNotFound
+	}
+	delete(s.roles, roleId)
+	for key := range s.userRoles {
+		if key.roleId == roleId {
+			delete(s.userRoles, key)
+		}
+	}
+	return nil
+}
+
+func (s *memRoles) ListUserRoles(ctx context.Context, userId uint) ([]Role, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.rolesOf(userId), nil
+}
+
+func (m *memoryDB) rolesOf(userId uint) []Role {
+	var roles []Role
+	for key := range m.userRoles {
+		if key.userId == userId {
+			roles = append(roles, m.roles[key.roleId])
+		}
+	}
+	sort.Slice(roles, func(i, j int) bool { return roles[i].Name < roles[j].Name })
+	return roles
+}
+
+func (s *memRoles) AssignRole(ctx context.Context, userId uint, roleId uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.roles[roleId]; !ok {
+		return ErrNotFound
+	}
+	key := userRoleKey{userId: userId, roleId: roleId}
+	if _, ok := s.userRoles[key]; !ok {
+		s.userRoles[key] = time.Now()
+	}
+	return nil
+}
+
+func (s *memRoles) RevokeRole(ctx context.Context, userId uint, roleId uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.userRoles, userRoleKey{userId: userId, roleId: roleId})
+	return nil
+}
+
+func (s *memRoles) GetUserPermissions(ctx context.Context, userId uint) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	seen := map[string]bool{}
+	var permissions []string
+	for _, role := range s.rolesOf(userId) {
+		for _, permission := range role.PermissionNames() {
+			if !seen[permission] {
+				seen[permission] = true
+				permissions = append(permissions, permission)
+			}
+		}
+	}
+	sort.Strings(permissions)
+	return permissions, nil
+}
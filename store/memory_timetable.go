@@ -0,0 +1,165 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+type memTimetable struct {
+	*memoryDB
+}
+
+func (s *memTimetable) CreatePeriod(ctx context.Context, period *Period) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.periodNameTaken(period) {
+		return ErrDuplicate
+	}
+	s.nextID++
+	period.ID = s.nextID
+	period.CreatedAt = time.Now()
+	s.periods[period.ID] = *period
+	return nil
+}
+
+func (s *memTimetable) GetPeriod(ctx context.Context, id uint) (*Period, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	period, ok := s.periods[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &period, nil
+}
+
+func (s *memTimetable) ListPeriods(ctx context.Context) ([]Period, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var periods []Period
+	for _, period := range s.periods {
+		periods = append(periods, period)
+	}
+	sort.Slice(periods, func(i, j int) bool {
+		a, b := periods[i], periods[j]
+		if a.Weekday != b.Weekday {
+			return a.Weekday < b.Weekday
+		}
+		if a.StartTime != b.StartTime {
+			return a.StartTime < b.StartTime
+		}
+		return a.Name < b.Name
+	})
+	return periods, nil
+}
+
+func (s *memTimetable) UpdatePeriod(ctx context.Context, period *Period) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.periods[period.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	stored.Name = period.Name
+	stored.StartTime = period.StartTime
+	stored.EndTime = period.EndTime
+	if s.periodNameTaken(&stored) {
+		return ErrDuplicate
+	}
+	s.periods[period.ID] = stored
+	*period = stored
+	return nil
+}
+
+func (s *memTimetable) DeletePeriod(ctx context.Context, id uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.periods[id]; !ok {
+		return ErrNotFound
+	}
+	for _, slot := range s.timetableSlots {
+		if slot.PeriodID == id {
+			return ErrConflict
+		}
+	}
+	delete(s.periods, id)
+	return nil
+}
+
+// periodNameTaken reports whether another period on the same weekday has the
+// same name.
+func (m *memoryDB) periodNameTaken(period *Period) bool {
+	for _, other := range m.periods {
+		if other.ID != period.ID && other.Weekday == period.Weekday && other.Name == period.Name {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *memTimetable) CreateSlot(ctx context.Context, slot *TimetableSlot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, other := range s.timetableSlots {
+		if other.SectionID == slot.SectionID && other.PeriodID == slot.PeriodID {
+			return ErrDuplicate
+		}
+	}
+	s.nextID++
+	slot.ID = s.nextID
+	slot.CreatedAt = time.Now()
+	s.timetableSlots[slot.ID] = *slot
+	return nil
+}
+
+func (s *memTimetable) DeleteSlot(ctx context.Context, sectionId uint, id uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	slot, ok := s.timetableSlots[id]
+	if !ok || slot.SectionID != sectionId {
+		return ErrNotFound
+	}
+	delete(s.timetableSlots, id)
+	return nil
+}
+
+func (s *memTimetable) ListClasses(ctx context.Context, filter ClassFilter) ([]ScheduledClass, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var classes []ScheduledClass
+	for _, slot := range s.timetableSlots {
+		section, ok := s.sections[slot.SectionID]
+		if !ok {
+			continue
+		}
+		period := s.periods[slot.PeriodID]
+		class := newScheduledClass(slot, period, section, s.courses[section.CourseID])
+
+		if filter.SectionID != 0 && slot.SectionID != filter.SectionID {
+			continue
+		}
+		if filter.StudentID != 0 && !s.isEnrolled(slot.SectionID, filter.StudentID) {
+			continue
+		}
+		if filter.TeacherID != 0 && (class.TeacherID == nil || *class.TeacherID != filter.TeacherID) {
+			continue
+		}
+		if filter.Weekday != nil && period.Weekday != *filter.Weekday {
+			continue
+		}
+		if filter.PeriodName != "" && period.Name != filter.PeriodName {
+			continue
+		}
+		classes = append(classes, class)
+	}
+	sortClasses(classes)
+	return classes, nil
+}
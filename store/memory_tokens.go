@@ -0,0 +1,211 @@
+package store
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+type memTokens struct {
+	*memoryDB
+}
+
+func (s *memTokens) CreateRefreshToken(ctx context.Context, token *RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.createRefreshToken(token)
+	return nil
+}
+
+func (m *memoryDB) createRefreshToken(token *RefreshToken) {
+	m.nextID++
+	token.ID = m.nextID
+	token.CreatedAt = time.Now()
+	m.refreshTokens[token.ID] = *token
+}
+
+func (s *memTokens) GetRefreshToken(ctx context.Context, tokenHash string) (*RefreshToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, token := range s.refreshTokens {
+		if token.TokenHash == tokenHash {
+			return &token, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memTokens) RotateRefreshToken(ctx context.Context, current *RefreshToken, next *RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.refreshTokens[current.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if stored.RevokedAt != nil {
+		return ErrConflict
+	}
+
+	s.createRefreshToken(next)
+	now := time.Now()
+	stored.RevokedAt = &now
+	stored.ReplacedBy = &next.ID
+	s.refreshTokens[current.ID] = stored
+	*current = stored
+	return nil
+}
+
+func (s *memTokens) RevokeRefreshFamily(ctx context.Context, familyId string) error {
+	return s.revokeRefreshTokens(func(token RefreshToken) bool { return token.FamilyID == familyId })
+}
+
+func (s *memTokens) RevokeUserRefreshTokens(ctx context.Context, userId uint) error {
+	return s.revokeRefreshTokens(func(token RefreshToken) bool { return token.UserID == userId })
+}
+
+func (s *memTokens) revokeRefreshTokens(match func(RefreshToken) bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.revokeRefreshTokensLocked(match)
+	return nil
+}
+
+func (m *memoryDB) revokeRefreshTokensLocked(match func(RefreshToken) bool) {
+	now := time.Now()
+	for id, token := range m.refreshTokens {
+		if token.RevokedAt == nil && match(token) {
+			token.RevokedAt = &now
+			m.refreshTokens[id] = token
+		}
+	}
+}
+
+func (s *memTokens) RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.revokedTokens[jti]; !ok {
+		s.revokedTokens[jti] = RevokedToken{JTI: jti, ExpiresAt: expiresAt}
+	}
+	return nil
+}
+
+func (s *memTokens) IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.revokedTokens[jti]
+	return ok, nil
+}
+
+func (s *memTokens) CreatePasswordReset(ctx context.Context, reset *PasswordReset) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	reset.ID = s.nextID
+	reset.CreatedAt = time.Now()
+	s.passwordResets[reset.ID] = *reset
+	return nil
+}
+
+func (s *memTokens) GetPasswordReset(ctx context.Context, tokenHash string) (*PasswordReset, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, reset := range s.passwordResets {
+		if reset.TokenHash == tokenHash {
+			return &reset, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memTokens) ResetPassword(ctx context.Context, reset *PasswordReset, passwordHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	stored, ok := s.passwordResets[reset.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if stored.UsedAt != nil || !now.Before(stored.ExpiresAt) {
+		return ErrConflict
+	}
+	user, ok := s.users[stored.UserID]
+	if !ok {
+		return ErrNotFound
+	}
+
+	// Older links stop working once the password has been reset
+	for id, other := range s.passwordResets {
+		if other.UserID == stored.UserID && other.UsedAt == nil {
+			other.UsedAt = &now
+			s.passwordResets[id] = other
+		}
+	}
+	reset.UsedAt = &now
+
+	user.Password = passwordHash
+	user.TokensNotBefore = &now
+	if user.Email != "" && strings.EqualFold(user.Email, stored.Email) {
+		user.EmailVerified = true
+	}
+	user.UpdatedAt = now
+	s.users[user.ID] = user
+	s.revokeRefreshTokensLocked(func(token RefreshToken) bool { return token.UserID == user.ID })
+	return nil
+}
+
+func (s *memTokens) CreateOIDCLogin(ctx context.Context, login *OIDCLogin) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	login.CreatedAt = time.Now()
+	s.oidcLogins[login.StateHash] = *login
+	return nil
+}
+
+func (s *memTokens) TakeOIDCLogin(ctx context.Context, stateHash string) (*OIDCLogin, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	login, ok := s.oidcLogins[stateHash]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	delete(s.oidcLogins, stateHash)
+	return &login, nil
+}
+
+func (s *memTokens) PurgeExpiredTokens(ctx context.Context, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, token := range s.refreshTokens {
+		if token.ExpiresAt.Before(now) {
+			delete(s.refreshTokens, id)
+		}
+	}
+	for id, reset := range s.passwordResets {
+		if reset.ExpiresAt.Before(now) {
+			delete(s.passwordResets, id)
+		}
+	}
+	for state, login := range s.oidcLogins {
+		if login.ExpiresAt.Before(now) {
+			delete(s.oidcLogins, state)
+		}
+	}
+	for jti, token := range s.revokedTokens {
+		if token.ExpiresAt.Before(now) {
+			delete(s.revokedTokens, jti)
+		}
+	}
+	return nil
+}
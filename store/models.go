@@ -0,0 +1,486 @@
+package store
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+type User struct {
+	gorm.Model        // Includes fields ID, CreatedAt, UpdatedAt, DeletedAt
+	Username   string `gorm:"uniqueIndex"` // Ensures usernames are unique
+	Password   string `gorm:"size:60"`
+	UserType   string
+	Email      string // Where notifications such as password resets are sent
+	Disabled   bool   // Disabled users cannot log in and their tokens stop working
+
+	// The user proved they receive Email, by using a password reset link
+	// sent to it or by signing in with a provider that verified it
+	EmailVerified bool
+
+	// Access tokens issued before the second of this time are no longer
+	// accepted. It is set whenever the password changes.
+	TokensNotBefore *time.Time
+
+	FailedLogins int        // Consecutive failed logins since the last success
+	LockedUntil  *time.Time // Logins are refused until then
+
+	TOTPSecret   string // Base32 TOTP secret, set once enrollment starts
+	TOTPEnabled  bool   // Logins need a TOTP or recovery code
+	TOTPLastStep int64  // Last accepted TOTP time step, so codes cannot be replayed
+}
+
+type Student struct {
+	gorm.Model                    // Includes fields ID, CreatedAt, UpdatedAt, DeletedAt
+	Username       string         // Foreign key for the User
+	Name           string         // Student's full name
+	Class          string         // Free-text class label; courses are tracked by Enrollment
+	RegisterNumber string         // Unique registration number for the student
+	Email          string         // Student's email address
+	Phone          string         // Student's phone number
+	Attendance     []Attendance   `gorm:"foreignKey:StudentId"`
+	MedicalClaims  []MedicalClaim `gorm:"foreignKey:StudentId"`
+}
+
+type Teacher struct {
+	gorm.Model
+	Username string
+	Name     string
+	Claim    []ClaimReview `gorm:"foreignKey:TeacherId"`
+}
+
+type IPM struct {
+	gorm.Model
+	Username string
+	Name     string
+}
+
+type Attendance struct {
+	gorm.Model
+	StudentId uint
+	SectionID uint // The section of a course the class was held for
+	Period    string
+	Date      Date
+	TeacherId string
+	Status    string // One of AttendanceStatuses
+	Reason    string // Code of the AttendanceReason for the status, if any
+	IsApplied bool   // A medical claim covering the class was approved
+	IsClaimed bool   // A medical claim covering the class was filed
+}
+
+// AttendanceState is the part of an attendance record that can change
+// after it is created.
+type AttendanceState struct {
+	Status    string `json:"status"`
+	Reason    string `json:"reason"`
+	IsApplied bool   `json:"is_applied"`
+	IsClaimed bool   `json:"is_claimed"`
+}
+
+func (a *Attendance) State() AttendanceState {
+	return AttendanceState{Status: a.Status, Reason: a.Reason, IsApplied: a.IsApplied, IsClaimed: a.IsClaimed}
+}
+
+// AttendanceChange is an entry in the history of an attendance record. The
+// store writes one with every change, in the same transaction, and never
+// alters or deletes them.
+type AttendanceChange struct {
+	ID           uint `gorm:"primaryKey"`
+	CreatedAt    time.Time
+	AttendanceID uint
+	ChangedBy    uint             // User who made the change
+	CorrectionID *uint            // The correction the change applied, if any
+	Before       *AttendanceState `gorm:"serializer:json"` // nil when the record was created
+	After        AttendanceState  `gorm:"serializer:json"`
+}
+
+// AttendanceCorrection asks for an attendance record to be given another
+// status. Corrections of recent records are approved as they are made;
+// older ones wait for a reviewer.
+type AttendanceCorrection struct {
+	ID            uint `gorm:"primaryKey"`
+	CreatedAt     time.Time
+	AttendanceID  uint
+	RequestedBy   uint   // User who asked for the correction
+	Status        string // The status the record should have
+	Reason        string // and its reason code, if any
+	Explanation   string // Why the record is wrong
+	State         string `gorm:"default:pending"` // One of the Correction* states
+	ReviewedBy    *uint  // nil if approved without review
+	ReviewedAt    *time.Time
+	ReviewComment string
+}
+
+// States of an AttendanceCorrection.
+const (
+	CorrectionPending  = "pending"
+	CorrectionApproved = "approved"
+	CorrectionRejected = "rejected"
+)
+
+// Attendance statuses. How much each counts towards attendance percentages
+// is configured.
+const (
+	AttendancePresent = "present"
+	AttendanceLate    = "late"
+	AttendanceHalfDay = "half_day"
+	AttendanceOnDuty  = "on_duty" // Away on official college duty
+	AttendanceExcused = "excused" // Absence excused by the principal
+	AttendanceAbsent  = "absent"
+)
+
+// AttendanceStatuses lists every attendance status.
+var AttendanceStatuses = []string{
+	AttendancePresent,
+	AttendanceLate,
+	AttendanceHalfDay,
+	AttendanceOnDuty,
+	AttendanceExcused,
+	AttendanceAbsent,
+}
+
+// AttendanceReason is a code that explains an attendance status, e.g. why a
+// student was late or what duty they were on. Admins maintain the list.
+type AttendanceReason struct {
+	Code        string `gorm:"primaryKey"`
+	CreatedAt   time.Time
+	Description string
+}
+
+// AttendanceSummary counts a student's attendance records in a course with
+// one status. The store keeps it up to date whenever attendance changes, so
+// percentages never need to scan the attendance table.
+type AttendanceSummary struct {
+	StudentID uint   `gorm:"primaryKey;autoIncrement:false"`
+	CourseID  uint   `gorm:"primaryKey;autoIncrement:false"`
+	Status    string `gorm:"primaryKey"`
+	Course    Course `gorm:"foreignKey:CourseID"`
+	UpdatedAt time.Time
+	Classes   int // Records in any section of the course
+	Claimed   int // Absences covered by an approved medical claim
+}
+
+// sortSummaries orders summaries by course code and status, as the store
+// returns them.
+func sortSummaries(summaries []AttendanceSummary) {
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].Course.Code != summaries[j].Course.Code {
+			return summaries[i].Course.Code < summaries[j].Course.Code
+		}
+		return summaries[i].Status < summaries[j].Status
+	})
+}
+
+// Course is a subject, e.g. CS101. It is taught in one or more sections.
+type Course struct {
+	gorm.Model
+	Code string // Unique among courses that are not deleted
+	Name string
+}
+
+// Section is one class of a course in a term, such as batch A of CS101,
+// taught by TeacherID. Attendance is recorded per section.
+type Section struct {
+	gorm.Model
+	CourseID  uint
+	Name      string // Unique within the course and term
+	Term      string
+	TeacherID *uint
+}
+
+// Enrollment puts a student in a section.
+type Enrollment struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	SectionID uint
+	StudentID uint
+}
+
+// Period is a slot of the school day on one weekday, such as period 01 on
+// Mondays from 09:00 to 09:50. Attendance.Period holds its Name.
+type Period struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	Weekday   time.Weekday
+	Name      string // Unique per weekday
+	StartTime string // HH:MM
+	EndTime   string
+}
+
+// Term is a span of instruction, such as a semester. Classes are only held
+// within terms; Section.Term holds the Name of the section's term.
+type Term struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	Name      string // Unique
+	StartDate Date
+	EndDate   Date // Inclusive; terms do not overlap
+}
+
+// CalendarEvent changes the days from StartDate to EndDate, inclusive: no
+// classes are held on holidays and during exams, and a working day holds the
+// classes of another weekday, e.g. a Saturday following Monday's timetable.
+type CalendarEvent struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	Kind      string // One of CalendarEventKinds
+	Name      string
+	StartDate Date
+	EndDate   Date
+	Weekday   *time.Weekday // Whose timetable a working day follows
+}
+
+// Kinds of CalendarEvent.
+const (
+	EventHoliday    = "holiday"
+	EventExams      = "exams"
+	EventWorkingDay = "working_day"
+)
+
+// CalendarEventKinds lists every kind of CalendarEvent.
+var CalendarEventKinds = []string{EventHoliday, EventExams, EventWorkingDay}
+
+// TimetableSlot schedules a section in a period. The class is taught by
+// TeacherID, or by the section's teacher when it is nil.
+type TimetableSlot struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	SectionID uint
+	PeriodID  uint
+	TeacherID *uint
+}
+
+// ScheduledClass is a timetable slot with what it refers to, as returned by
+// timetable queries.
+type ScheduledClass struct {
+	Slot    TimetableSlot
+	Period  Period
+	Section Section
+	Course  Course
+
+	// Who teaches the class: the slot's teacher, or else the section's
+	TeacherID *uint
+}
+
+type File struct {
+	gorm.Model
+	Name           string
+	Path           string
+	MedicalClaimID uint
+}
+
+type MedicalClaim struct {
+	gorm.Model
+	StudentId    uint
+	Student      Student `gorm:"foreignKey:StudentId"`
+	Reason       string
+	Description  string
+	Status       string        `gorm:"default:Pending"`
+	Message      string        `gorm:"default:''"`
+	ClaimReviews []ClaimReview `gorm:"foreignKey:ClaimId"`
+	Files        []File        `gorm:"foreignKey:MedicalClaimID"`
+}
+
+type ClaimReview struct {
+	gorm.Model
+	ClaimId      uint         // Foreign key to the MedicalClaim
+	MedicalClaim MedicalClaim `gorm:"foreignKey:ClaimId"`
+	AttendanceId uint         // Foreign key to the Attendance
+	Attendance   Attendance   `gorm:"foreignKey:AttendanceId"`
+	TeacherId    string       // Foreign key to the Teacher
+	Teacher      Teacher      `gorm:"foreignKey:TeacherId"`
+	Status       string       `gorm:"default:Pending"`
+	Message      string       // Optional message left by the teacher
+}
+
+// TeacherKey renders a teacher ID the way ClaimReview.TeacherId and
+// Attendance.TeacherId store it.
+func TeacherKey(id uint) string {
+	return strconv.FormatUint(uint64(id), 10)
+}
+
+// RefreshToken is a rotating refresh token. Only the SHA-256 hash of the token
+// is stored. Every token issued from one login shares a FamilyID, so reusing a
+// token that was already rotated revokes the whole family.
+type RefreshToken struct {
+	ID         uint `gorm:"primarykey"`
+	CreatedAt  time.Time
+	UserID     uint
+	FamilyID   string
+	TokenHash  string
+	ExpiresAt  time.Time
+	RevokedAt  *time.Time
+	ReplacedBy *uint // ID of the token this one was rotated into
+}
+
+// RevokedToken blocks an access token, identified by its jti, until it expires.
+type RevokedToken struct {
+	JTI       string `gorm:"primaryKey"`
+	ExpiresAt time.Time
+}
+
+// PasswordReset is a one-time token, stored hashed, that lets a user who
+// forgot their password set a new one before ExpiresAt.
+type PasswordReset struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UserID    uint
+	Email     string // Where the link was sent
+	TokenHash string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+// LoginEvent records one attempt to log in.
+type LoginEvent struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UserID    *uint // Nil when no account has the username
+	Username  string
+	IP        string
+	UserAgent string
+	Success   bool
+	Reason    string // Why a failed attempt was refused
+}
+
+// RecoveryCode is a single-use code, stored hashed, that stands in for a TOTP
+// code when the user has lost their authenticator.
+type RecoveryCode struct {
+	ID       uint `gorm:"primarykey"`
+	UserID   uint
+	CodeHash string
+	UsedAt   *time.Time
+}
+
+// UserIdentity links a user to their account at an external identity
+// provider, identified by the provider's issuer and subject.
+type UserIdentity struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UserID    uint
+	Issuer    string
+	Subject   string
+	Email     string // Email the provider reported when the link was made
+}
+
+// OIDCLogin is a single sign-on login in progress. It is keyed by the hash of
+// the state parameter and holds the PKCE verifier and nonce of the request.
+type OIDCLogin struct {
+	StateHash    string `gorm:"primaryKey"`
+	CreatedAt    time.Time
+	CodeVerifier string
+	Nonce        string
+	ExpiresAt    time.Time
+	UserID       *uint // Set when a logged-in user is linking the identity to their account
+}
+
+func (OIDCLogin) TableName() string {
+	return "oidc_logins"
+}
+
+// APIKey lets a script act as UserID without logging in. The key is stored
+// hashed; Prefix is its first characters, kept to tell keys apart. Requests
+// made with it get the permissions in Scopes that the user still holds.
+type APIKey struct {
+	ID          uint `gorm:"primarykey"`
+	CreatedAt   time.Time
+	UserID      uint
+	Name        string
+	Prefix      string
+	KeyHash     string
+	Scopes      pq.StringArray `gorm:"type:text[]"`
+	CreatedByID *uint
+	ExpiresAt   time.Time
+	LastUsedAt  *time.Time
+	LastUsedIP  string
+	RevokedAt   *time.Time
+}
+
+// SigningKey is a key pair the server signs its JWTs with. A key signs new
+// tokens from ActiveAt until a newer key becomes active, and is published for
+// verification until ExpiresAt, which is set once it has been replaced.
+type SigningKey struct {
+	KID        string `gorm:"primaryKey"`
+	CreatedAt  time.Time
+	Algorithm  string // JWT alg, RS256 or EdDSA
+	PrivateKey string // PKCS #8, PEM encoded
+	ActiveAt   time.Time
+	ExpiresAt  *time.Time
+}
+
+// Role is a named set of permissions that can be assigned to users.
+type Role struct {
+	ID          uint `gorm:"primarykey"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Name        string
+	Description string
+	Permissions []RolePermission `gorm:"foreignKey:RoleID"`
+}
+
+type RolePermission struct {
+	RoleID     uint   `gorm:"primaryKey"`
+	Permission string `gorm:"primaryKey"`
+}
+
+type UserRole struct {
+	UserID    uint `gorm:"primaryKey"`
+	RoleID    uint `gorm:"primaryKey"`
+	CreatedAt time.Time
+}
+
+// PermissionNames returns the role's permissions as plain strings.
+func (r Role) PermissionNames() []string {
+	names := make([]string, len(r.Permissions))
+	for i, permission := range r.Permissions {
+		names[i] = permission.Permission
+	}
+	return names
+}
+
+// Invitation lets an admin create a staff account. The invitee redeems the
+// single-use token before ExpiresAt to get a user with Role, linked to the
+// Teacher or IPM profile ProfileID (or a new profile called Name).
+type Invitation struct {
+	ID          uint `gorm:"primarykey"`
+	CreatedAt   time.Time
+	TokenHash   string
+	Role        string
+	Name        string
+	Email       string
+	ProfileID   uint  // Existing Teacher or IPM profile to link, 0 for a new one
+	CreatedByID *uint // Nil for invitations created from the command line
+	ExpiresAt   time.Time
+	UsedAt      *time.Time
+	UsedByID    *uint
+}
+
+// Impersonation is an admin viewing the API as another user for support. The
+// token issued for it is TokenID; it can be ended before it expires.
+type Impersonation struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	AdminID   uint
+	UserID    uint
+	Reason    string
+	TokenID   string
+	ExpiresAt time.Time
+	EndedAt   *time.Time
+}
+
+// ImpersonationAction is a request an admin made while impersonating, kept
+// as the audit trail of the impersonation.
+type ImpersonationAction struct {
+	ID              uint `gorm:"primarykey"`
+	CreatedAt       time.Time
+	ImpersonationID uint
+	AdminID         uint
+	UserID          uint
+	Method          string
+	Path            string
+	Status          int
+	IP              string
+}
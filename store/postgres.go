@@ -0,0 +1,820 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// NewPostgres returns a Store backed by the shared GORM handle.
+func NewPostgres(db *gorm.DB) *Store {
+	return &Store{
+		Users:          &pgUsers{db: db},
+		Students:       &pgStudents{db: db},
+		Teachers:       &pgTeachers{db: db},
+		Attendance:     &pgAttendance{db: db},
+		Corrections:    &pgCorrections{db: db},
+		Courses:        &pgCourses{db: db},
+		Timetable:      &pgTimetable{db: db},
+		Calendar:       &pgCalendar{db: db},
+		Claims:         &pgClaims{db: db},
+		Tokens:         &pgTokens{db: db},
+		Logins:         &pgLogins{db: db},
+		MFA:            &pgMFA{db: db},
+		Roles:          &pgRoles{db: db},
+		Invitations:    &pgInvitations{db: db},
+		APIKeys:        &pgAPIKeys{db: db},
+		Keys:           &pgKeys{db: db},
+		Impersonations: &pgImpersonations{db: db},
+	}
+}
+
+// notFound maps GORM's missing-record error onto ErrNotFound.
+func notFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// duplicate maps unique constraint violations onto ErrDuplicate.
+func duplicate(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return ErrDuplicate
+	}
+	return err
+}
+
+type pgUsers struct {
+	db *gorm.DB
+}
+
+func (s *pgUsers) CreateUser(ctx context.Context, user *User) error {
+	return duplicate(s.db.WithContext(ctx).Create(user).Error)
+}
+
+func (s *pgUsers) GetUser(ctx context.Context, id uint) (*User, error) {
+	var user User
+	if err := s.db.WithContext(ctx).First(&user, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &user, nil
+}
+
+func (s *pgUsers) GetUserByUsername(ctx context.Context, username string) (*User, error) {
+	var user User
+	if err := s.db.WithContext(ctx).Where("username = ?", username).First(&user).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &user, nil
+}
+
+func (s *pgUsers) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	var user User
+	if err := s.db.WithContext(ctx).Where("lower(email) = lower(?)", email).First(&user).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &user, nil
+}
+
+func (s *pgUsers) SetPassword(ctx context.Context, userId uint, passwordHash string) error {
+	result := s.db.WithContext(ctx).Model(&User{}).Where("id = ?", userId).
+		Updates(map[string]interface{}{"password": passwordHash, "tokens_not_before": time.Now()})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *pgUsers) GetUserByIdentity(ctx context.Context, issuer string, subject string) (*User, error) {
+	var user User
+	err := s.db.WithContext(ctx).
+		Joins("JOIN user_identities ON user_identities.user_id = users.id").
+		Where("user_identities.issuer = ? AND user_identities.subject = ?", issuer, subject).
+		First(&user).Error
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &user, nil
+}
+
+func (s *pgUsers) LinkIdentity(ctx context.Context, identity *UserIdentity) error {
+	return duplicate(s.db.WithContext(ctx).Create(identity).Error)
+}
+
+func (s *pgUsers) RecordLoginFailure(ctx context.Context, userId uint, maxFailures int, lockout time.Duration) (*User, error) {
+	var user User
+	err := s.db.WithContext(ctx).Raw(`UPDATE users SET
+		failed_logins = failed_logins + 1,
+		locked_until = CASE WHEN failed_logins + 1 >= @max THEN @until ELSE locked_until END
+		WHERE id = @id AND deleted_at IS NULL
+		RETURNING *`,
+		map[string]interface{}{"id": userId, "max": maxFailures, "until": time.Now().Add(lockout)}).
+		Scan(&user).Error
+	if err != nil {
+		return nil, err
+	}
+	if user.ID == 0 {
+		return nil, ErrNotFound
+	}
+	return &user, nil
+}
+
+func (s *pgUsers) ClearLoginFailures(ctx context.Context, userId uint) error {
+	result := s.db.WithContext(ctx).Model(&User{}).Where("id = ?", userId).
+		Updates(map[string]interface{}{"failed_logins": 0, "locked_until": nil})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *pgUsers) CreateAccount(ctx context.Context, account *NewAccount) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return createAccount(tx, account)
+	})
+}
+
+// createAccount does the work of CreateAccount inside the caller's transaction.
+func createAccount(tx *gorm.DB, account *NewAccount) error {
+	user := account.User
+	if err := tx.Create(user).Error; err != nil {
+		return duplicate(err)
+	}
+	if err := tx.Create(&UserRole{UserID: user.ID, RoleID: account.RoleID}).Error; err != nil {
+		return err
+	}
+	if account.Identity != nil {
+		account.Identity.UserID = user.ID
+		if err := tx.Create(account.Identity).Error; err != nil {
+			return duplicate(err)
+		}
+	}
+
+	switch {
+	case account.Student != nil:
+		account.Student.Username = user.Username
+		return tx.Create(account.Student).Error
+	case account.Teacher != nil && account.Teacher.ID == 0:
+		account.Teacher.Username = user.Username
+		return tx.Create(account.Teacher).Error
+	case account.Teacher != nil:
+		return linkProfile(tx, account.Teacher, account.Teacher.ID, user.Username)
+	case account.IPM != nil && account.IPM.ID == 0:
+		account.IPM.Username = user.Username
+		return tx.Create(account.IPM).Error
+	case account.IPM != nil:
+		return linkProfile(tx, account.IPM, account.IPM.ID, user.Username)
+	}
+	return nil
+}
+
+// linkProfile points the existing profile with id at username and reloads it
+// into profile. Profiles already linked to a user are not taken over.
+func linkProfile(tx *gorm.DB, profile interface{}, id uint, username string) error {
+	result := tx.Model(profile).
+		Where("id = ? AND (username IS NULL OR username = '')", id).
+		Update("username", username)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrConflict
+	}
+	return tx.First(profile, id).Error
+}
+
+func (s *pgUsers) GetProfileIDs(ctx context.Context, username string) (*ProfileIDs, error) {
+	var row struct {
+		StudentID *uint
+		TeacherID *uint
+		IPMID     *uint `gorm:"column:ipm_id"`
+	}
+	err := s.db.WithContext(ctx).Raw(`SELECT
+		(SELECT id FROM students WHERE username = @username AND deleted_at IS NULL ORDER BY id LIMIT 1) AS student_id,
+		(SELECT id FROM teachers WHERE username = @username AND deleted_at IS NULL ORDER BY id LIMIT 1) AS teacher_id,
+		(SELECT id FROM ip_ms WHERE username = @username AND deleted_at IS NULL ORDER BY id LIMIT 1) AS ipm_id`,
+		map[string]interface{}{"username": username}).Scan(&row).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var ids ProfileIDs
+	if row.StudentID != nil {
+		ids.StudentID = *row.StudentID
+	}
+	if row.TeacherID != nil {
+		ids.TeacherID = *row.TeacherID
+	}
+	if row.IPMID != nil {
+		ids.IPMID = *row.IPMID
+	}
+	return &ids, nil
+}
+
+func (s *pgUsers) ListUsers(ctx context.Context, filter UserFilter) ([]User, int64, error) {
+	query := s.db.WithContext(ctx).Model(&User{})
+	if filter.Search != "" {
+		pattern := "%" + escapeLike(filter.Search) + "%"
+		query = query.Where("(username ILIKE ? OR email ILIKE ?)", pattern, pattern)
+	}
+	if filter.UserType != "" {
+		query = query.Where("user_type = ?", filter.UserType)
+	}
+	if filter.Disabled != nil {
+		query = query.Where("disabled = ?", *filter.Disabled)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var users []User
+	err := query.Order("id").Offset(filter.Offset).Limit(filter.Limit).Find(&users).Error
+	return users, total, err
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+func (s *pgUsers) SetEmail(ctx context.Context, userId uint, email string) error {
+	return s.updateUser(ctx, userId, map[string]interface{}{"email": email, "email_verified": false})
+}
+
+// updateUser applies updates to the user, returning ErrNotFound if there is
+// no such user.
+func (s *pgUsers) updateUser(ctx context.Context, userId uint, updates map[string]interface{}) error {
+	result := s.db.WithContext(ctx).Model(&User{}).Where("id = ?", userId).Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *pgUsers) ChangeUserType(ctx context.Context, userId uint, userType string, oldRoleId uint, newRoleId uint) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&User{}).Where("id = ?", userId).Update("user_type", userType)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		err := tx.Where("user_id = ? AND role_id = ?", userId, oldRoleId).Delete(&UserRole{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&UserRole{UserID: userId, RoleID: newRoleId}).Error
+	})
+}
+
+func (s *pgUsers) SetDisabled(ctx context.Context, userId uint, disabled bool) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&User{}).Where("id = ?", userId).Update("disabled", disabled)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		if !disabled {
+			return nil
+		}
+		return tx.Model(&RefreshToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", userId).
+			Update("revoked_at", time.Now()).Error
+	})
+}
+
+func (s *pgUsers) DeleteUser(ctx context.Context, userId uint) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var user User
+		if err := tx.First(&user, userId).Error; err != nil {
+			return notFound(err)
+		}
+		if err := tx.Delete(&user).Error; err != nil {
+			return err
+		}
+		for _, profile := range []interface{}{&Student{}, &Teacher{}, &IPM{}} {
+			err := tx.Model(profile).Where("username = ?", user.Username).Update("username", "").Error
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Model(&RefreshToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", userId).
+			Update("revoked_at", time.Now()).Error
+	})
+}
+
+func (s *pgUsers) ForcePasswordReset(ctx context.Context, userId uint, now time.Time) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&User{}).Where("id = ?", userId).
+			Updates(map[string]interface{}{"password": "", "tokens_not_before": now})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		return tx.Model(&RefreshToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", userId).
+			Update("revoked_at", now).Error
+	})
+}
+
+// profileModel returns the model of the profile table of kind.
+func profileModel(kind ProfileKind) (interface{}, error) {
+	switch kind {
+	case ProfileStudent:
+		return &Student{}, nil
+	case ProfileTeacher:
+		return &Teacher{}, nil
+	case ProfileIPM:
+		return &IPM{}, nil
+	}
+	return nil, fmt.Errorf("unknown profile kind %q", kind)
+}
+
+func (s *pgUsers) LinkProfile(ctx context.Context, kind ProfileKind, profileId uint, username string) error {
+	profile, err := profileModel(kind)
+	if err != nil {
+		return err
+	}
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(profile, profileId).Error; err != nil {
+			return notFound(err)
+		}
+		return linkProfile(tx, profile, profileId, username)
+	})
+}
+
+func (s *pgUsers) UnlinkProfile(ctx context.Context, kind ProfileKind, username string) error {
+	profile, err := profileModel(kind)
+	if err != nil {
+		return err
+	}
+	result := s.db.WithContext(ctx).Model(profile).Where("username = ?", username).Update("username", "")
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type pgStudents struct {
+	db *gorm.DB
+}
+
+func (s *pgStudents) CreateStudent(ctx context.Context, student *Student) error {
+	return s.db.WithContext(ctx).Create(student).Error
+}
+
+func (s *pgStudents) GetStudentByUsername(ctx context.Context, username string) (*Student, error) {
+	var student Student
+	if err := s.db.WithContext(ctx).Preload("Attendance").Where("username = ?", username).First(&student).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &student, nil
+}
+
+func (s *pgStudents) GetStudentByRegisterNumber(ctx context.Context, registerNumber string) (*Student, error) {
+	var student Student
+	if err := s.db.WithContext(ctx).Where("register_number = ?", registerNumber).First(&student).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &student, nil
+}
+
+func (s *pgStudents) GetStudent(ctx context.Context, id uint) (*Student, error) {
+	var student Student
+	if err := s.db.WithContext(ctx).First(&student, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &student, nil
+}
+
+type pgTeachers struct {
+	db *gorm.DB
+}
+
+func (s *pgTeachers) CreateTeacher(ctx context.Context, teacher *Teacher) error {
+	return s.db.WithContext(ctx).Create(teacher).Error
+}
+
+func (s *pgTeachers) GetTeacher(ctx context.Context, id uint) (*Teacher, error) {
+	var teacher Teacher
+	if err := s.db.WithContext(ctx).Preload("Claim").First(&teacher, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &teacher, nil
+}
+
+func (s *pgTeachers) GetTeacherByUsername(ctx context.Context, username string) (*Teacher, error) {
+	var teacher Teacher
+	if err := s.db.WithContext(ctx).Where("username = ?", username).First(&teacher).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &teacher, nil
+}
+
+type pgAttendance struct {
+	db *gorm.DB
+}
+
+func (s *pgAttendance) CreateAttendance(ctx context.Context, attendance *Attendance, changedBy uint) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := checkOpenDay(tx, attendance.Date); err != nil {
+			return err
+		}
+		return createAttendance(tx, attendance, changedBy)
+	})
+}
+
+func (s *pgAttendance) GetAttendance(ctx context.Context, id uint) (*Attendance, error) {
+	var record Attendance
+	err := s.db.WithContext(ctx).First(&record, id).Error
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &record, nil
+}
+
+func (s *pgAttendance) SetAttendanceStatus(ctx context.Context, id uint, mark Mark, changedBy uint) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var record Attendance
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&record, id).Error; err != nil {
+			return notFound(err)
+		}
+		state := record.State()
+		state.Status, state.Reason = mark.Status, mark.Reason
+		return updateAttendance(tx, &record, state, changedBy, nil)
+	})
+}
+
+func (s *pgAttendance) RecordRollCall(ctx context.Context, rollCall RollCall) ([]RollCallResult, error) {
+	var results []RollCallResult
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Concurrent roll calls of the section wait for each other, so a
+		// student cannot end up with two records for the class
+		var section Section
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&section, rollCall.SectionID).Error; err != nil {
+			return notFound(err)
+		}
+		if err := checkOpenDay(tx, rollCall.Date); err != nil {
+			return err
+		}
+
+		var existing []Attendance
+		err := tx.Where("section_id = ? AND date = ? AND period = ?", rollCall.SectionID, rollCall.Date, rollCall.Period).
+			Order("id").
+			Find(&existing).Error
+		if err != nil {
+			return err
+		}
+		recorded := map[uint]Attendance{}
+		for _, record := range existing {
+			if _, ok := recorded[record.StudentId]; !ok {
+				recorded[record.StudentId] = record
+			}
+		}
+
+		for _, studentId := range sortedKeys(rollCall.Marks) {
+			mark := rollCall.Marks[studentId]
+			result := RollCallResult{StudentID: studentId, Mark: mark, Outcome: RollCallUnchanged}
+			if record, ok := recorded[studentId]; ok {
+				result.AttendanceID = record.ID
+				if record.Status != mark.Status || record.Reason != mark.Reason {
+					state := record.State()
+					state.Status, state.Reason = mark.Status, mark.Reason
+					if err := updateAttendance(tx, &record, state, rollCall.ChangedBy, nil); err != nil {
+						return err
+					}
+					result.Outcome = RollCallUpdated
+				}
+			} else {
+				record := Attendance{
+					StudentId: studentId,
+					SectionID: rollCall.SectionID,
+					Date:      rollCall.Date,
+					Period:    rollCall.Period,
+					TeacherId: rollCall.TeacherID,
+					Status:    mark.Status,
+					Reason:    mark.Reason,
+				}
+				if err := createAttendance(tx, &record, rollCall.ChangedBy); err != nil {
+					return err
+				}
+				result.AttendanceID = record.ID
+				result.Outcome = RollCallCreated
+			}
+			results = append(results, result)
+		}
+		return nil
+	})
+	return results, err
+}
+
+func (s *pgAttendance) ListAttendanceSummaries(ctx context.Context, studentId uint) ([]AttendanceSummary, error) {
+	var summaries []AttendanceSummary
+	err := s.db.WithContext(ctx).
+		Preload("Course").
+		Joins("JOIN courses ON courses.id = attendance_summaries.course_id").
+		Where("attendance_summaries.student_id = ?", studentId).
+		Order("courses.code, attendance_summaries.status").
+		Find(&summaries).Error
+	return summaries, err
+}
+
+func (s *pgAttendance) ListAttendanceChanges(ctx context.Context, attendanceId uint) ([]AttendanceChange, error) {
+	var changes []AttendanceChange
+	err := s.db.WithContext(ctx).Where("attendance_id = ?", attendanceId).Order("id").Find(&changes).Error
+	return changes, err
+}
+
+// createAttendance inserts a record with the first entry of its history.
+func createAttendance(tx *gorm.DB, record *Attendance, changedBy uint) error {
+	if err := tx.Create(record).Error; err != nil {
+		return duplicate(err)
+	}
+	change := AttendanceChange{AttendanceID: record.ID, ChangedBy: changedBy, After: record.State()}
+	if err := tx.Create(&change).Error; err != nil {
+		return err
+	}
+	return refreshAttendanceSummary(tx, record.StudentId, record.SectionID)
+}
+
+// updateAttendance gives a record, locked by the caller's transaction, the
+// new state and writes the change to its history.
+func updateAttendance(tx *gorm.DB, record *Attendance, state AttendanceState, changedBy uint, correctionId *uint) error {
+	before := record.State()
+	if state == before {
+		return nil
+	}
+	err := tx.Model(record).
+		Select("status", "reason", "is_applied", "is_claimed").
+		Updates(Attendance{Status: state.Status, Reason: state.Reason, IsApplied: state.IsApplied, IsClaimed: state.IsClaimed}).Error
+	if err != nil {
+		return err
+	}
+	record.Status, record.Reason, record.IsApplied, record.IsClaimed = state.Status, state.Reason, state.IsApplied, state.IsClaimed
+
+	change := AttendanceChange{
+		AttendanceID: record.ID,
+		ChangedBy:    changedBy,
+		CorrectionID: correctionId,
+		Before:       &before,
+		After:        state,
+	}
+	if err := tx.Create(&change).Error; err != nil {
+		return err
+	}
+	return refreshAttendanceSummary(tx, record.StudentId, record.SectionID)
+}
+
+// refreshAttendanceSummary recounts the student's attendance in the course
+// of the section. It runs in the transaction that changed the attendance.
+func refreshAttendanceSummary(tx *gorm.DB, studentId, sectionId uint) error {
+	args := map[string]interface{}{"student": studentId, "section": sectionId}
+	err := tx.Exec(`
+		DELETE FROM attendance_summaries
+		WHERE student_id = @student
+			AND course_id = (SELECT course_id FROM sections WHERE id = @section)`, args).Error
+	if err != nil {
+		return err
+	}
+	return tx.Exec(`
+		INSERT INTO attendance_summaries (student_id, course_id, status, updated_at, classes, claimed)
+		SELECT @student, sections.course_id, attendances.status, now(),
+			count(*),
+			count(*) FILTER (WHERE attendances.status = 'absent' AND attendances.is_applied)
+		FROM attendances
+		JOIN sections ON sections.id = attendances.section_id
+		WHERE attendances.student_id = @student
+			AND attendances.deleted_at IS NULL
+			AND sections.course_id = (SELECT course_id FROM sections WHERE id = @section)
+		GROUP BY sections.course_id, attendances.status`, args).Error
+}
+
+func (s *pgAttendance) FindAttendance(ctx context.Context, studentId uint, date Date, period string) ([]Attendance, error) {
+	var records []Attendance
+	err := s.db.WithContext(ctx).Where("date = ? AND period = ? AND student_id = ?", date, period, studentId).Find(&records).Error
+	return records, err
+}
+
+func (s *pgAttendance) ListAttendance(ctx context.Context, filter AttendanceFilter) ([]Attendance, int64, error) {
+	query := filterAttendance(s.db.WithContext(ctx).Model(&Attendance{}), filter)
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var records []Attendance
+	err := query.Order("date, period, id").Offset(filter.Offset).Limit(filter.Limit).Find(&records).Error
+	return records, total, err
+}
+
+func (s *pgAttendance) SummarizeAttendance(ctx context.Context, filter AttendanceFilter) ([]AttendanceSummary, error) {
+	var summaries []AttendanceSummary
+	err := filterAttendance(s.db.WithContext(ctx).Model(&Attendance{}), filter).
+		Select("attendances.student_id, sections.course_id, attendances.status, count(*) AS classes, "+
+			"count(*) FILTER (WHERE attendances.status = ? AND attendances.is_applied) AS claimed", AttendanceAbsent).
+		Joins("JOIN sections ON sections.id = attendances.section_id").
+		Group("attendances.student_id, sections.course_id, attendances.status").
+		Scan(&summaries).Error
+	if err != nil || len(summaries) == 0 {
+		return nil, err
+	}
+
+	courseIds := make([]uint, len(summaries))
+	for i, summary := range summaries {
+		courseIds[i] = summary.CourseID
+	}
+	var courses []Course
+	if err := s.db.WithContext(ctx).Unscoped().Where("id IN ?", courseIds).Find(&courses).Error; err != nil {
+		return nil, err
+	}
+	byId := make(map[uint]Course, len(courses))
+	for _, course := range courses {
+		byId[course.ID] = course
+	}
+	for i := range summaries {
+		summaries[i].Course = byId[summaries[i].CourseID]
+	}
+	sortSummaries(summaries)
+	return summaries, nil
+}
+
+// filterAttendance narrows a query on attendances to the records matching
+// filter.
+func filterAttendance(query *gorm.DB, filter AttendanceFilter) *gorm.DB {
+	if filter.StudentID != 0 {
+		query = query.Where("attendances.student_id = ?", filter.StudentID)
+	}
+	if filter.SectionID != 0 {
+		query = query.Where("attendances.section_id = ?", filter.SectionID)
+	}
+	if filter.CourseID != 0 {
+		query = query.Where("attendances.section_id IN (SELECT id FROM sections WHERE course_id = ?)", filter.CourseID)
+	}
+	if filter.TeacherID != "" {
+		query = query.Where("attendances.teacher_id = ?", filter.TeacherID)
+	}
+	if filter.Status != "" {
+		query = query.Where("attendances.status = ?", filter.Status)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("attendances.date >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("attendances.date <= ?", filter.To)
+	}
+	return query
+}
+
+type pgClaims struct {
+	db *gorm.DB
+}
+
+func (s *pgClaims) CreateClaim(ctx context.Context, claim *MedicalClaim, changedBy uint) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(claim).Error; err != nil {
+			return err
+		}
+		var attendanceIds []uint
+		for _, review := range claim.ClaimReviews {
+			attendanceIds = append(attendanceIds, review.AttendanceId)
+		}
+		if len(attendanceIds) == 0 {
+			return nil
+		}
+
+		var records []Attendance
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id IN ?", attendanceIds).Order("id").Find(&records).Error
+		if err != nil {
+			return err
+		}
+		for i := range records {
+			state := records[i].State()
+			state.IsClaimed = true
+			if err := updateAttendance(tx, &records[i], state, changedBy, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *pgClaims) GetClaim(ctx context.Context, id uint) (*MedicalClaim, error) {
+	var claim MedicalClaim
+	err := s.db.WithContext(ctx).
+		Preload("Student").
+		Preload("ClaimReviews").
+		Preload("Files").
+		Preload("ClaimReviews.Teacher").
+		Preload("ClaimReviews.Attendance").
+		First(&claim, id).Error
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &claim, nil
+}
+
+func (s *pgClaims) ListClaimsByStudent(ctx context.Context, studentId uint) ([]MedicalClaim, error) {
+	var claims []MedicalClaim
+	err := s.db.WithContext(ctx).Where("student_id = ?", studentId).Find(&claims).Error
+	return claims, err
+}
+
+func (s *pgClaims) ListReviewedClaims(ctx context.Context) ([]MedicalClaim, error) {
+	var claims []MedicalClaim
+	err := s.db.WithContext(ctx).
+		Preload("Student").
+		Preload("ClaimReviews").
+		Preload("ClaimReviews.Teacher").
+		Preload("Files").
+		Find(&claims, "id NOT IN (SELECT claim_id FROM claim_reviews WHERE status = 'pending')").Error
+	return claims, err
+}
+
+func (s *pgClaims) UpdateClaimStatus(ctx context.Context, id uint, status string, message string, changedBy uint) (*MedicalClaim, error) {
+	var claim MedicalClaim
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&claim, id).Error; err != nil {
+			return notFound(err)
+		}
+
+		err := tx.Model(&claim).Updates(MedicalClaim{Status: status, Message: message}).Error
+		if err != nil {
+			return err
+		}
+		if status == "" {
+			return nil
+		}
+
+		var records []Attendance
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id IN (SELECT attendance_id FROM claim_reviews WHERE claim_id = ? AND deleted_at IS NULL)", id).
+			Order("id").
+			Find(&records).Error
+		if err != nil {
+			return err
+		}
+		approved := strings.EqualFold(status, ClaimApproved)
+		for i := range records {
+			state := records[i].State()
+			state.IsApplied = approved
+			if err := updateAttendance(tx, &records[i], state, changedBy, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &claim, nil
+}
+
+func (s *pgClaims) ListReviewsByTeacher(ctx context.Context, teacherId string) ([]ClaimReview, error) {
+	var reviews []ClaimReview
+	err := s.db.WithContext(ctx).
+		Preload("MedicalClaim").
+		Preload("MedicalClaim.Files").
+		Preload("MedicalClaim.Student").
+		Where("teacher_id = ?", teacherId).
+		Find(&reviews).Error
+	return reviews, err
+}
+
+func (s *pgClaims) GetClaimReview(ctx context.Context, id uint) (*ClaimReview, error) {
+	var review ClaimReview
+	if err := s.db.WithContext(ctx).First(&review, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &review, nil
+}
+
+func (s *pgClaims) UpdateClaimReview(ctx context.Context, review *ClaimReview) error {
+	return s.db.WithContext(ctx).Save(review).Error
+}
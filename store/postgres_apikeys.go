@@ -0,0 +1,53 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type pgAPIKeys struct {
+	db *gorm.DB
+}
+
+func (s *pgAPIKeys) CreateAPIKey(ctx context.Context, key *APIKey) error {
+	return duplicate(s.db.WithContext(ctx).Create(key).Error)
+}
+
+func (s *pgAPIKeys) GetAPIKeyByHash(ctx context.Context, keyHash string) (*APIKey, error) {
+	var key APIKey
+	if err := s.db.WithContext(ctx).Where("key_hash = ?", keyHash).First(&key).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &key, nil
+}
+
+func (s *pgAPIKeys) ListAPIKeys(ctx context.Context, userId uint) ([]APIKey, error) {
+	query := s.db.WithContext(ctx).Order("id DESC")
+	if userId != 0 {
+		query = query.Where("user_id = ?", userId)
+	}
+	var keys []APIKey
+	err := query.Find(&keys).Error
+	return keys, err
+}
+
+func (s *pgAPIKeys) RevokeAPIKey(ctx context.Context, id uint) error {
+	result := s.db.WithContext(ctx).Model(&APIKey{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *pgAPIKeys) TouchAPIKey(ctx context.Context, id uint, ip string, now time.Time, notBefore time.Time) error {
+	return s.db.WithContext(ctx).Model(&APIKey{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", id, notBefore).
+		Updates(map[string]interface{}{"last_used_at": now, "last_used_ip": ip}).Error
+}
@@ -0,0 +1,114 @@
+package store
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+// calendarLockID is the advisory lock key that orders new holidays and
+// exams against new attendance records. CreateEvent holds it exclusively,
+// attendance writers shared, so a record cannot be created for a day while
+// that day is being closed.
+const calendarLockID = 4931870265
+
+type pgCalendar struct {
+	db *gorm.DB
+}
+
+func (s *pgCalendar) CreateTerm(ctx context.Context, term *Term) error {
+	// The terms_no_overlap exclusion constraint rejects overlapping terms
+	err := s.db.WithContext(ctx).Create(term).Error
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23P01" {
+		return ErrConflict
+	}
+	return duplicate(err)
+}
+
+func (s *pgCalendar) GetTermByName(ctx context.Context, name string) (*Term, error) {
+	var term Term
+	if err := s.db.WithContext(ctx).Where("name = ?", name).First(&term).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &term, nil
+}
+
+func (s *pgCalendar) ListTerms(ctx context.Context) ([]Term, error) {
+	var terms []Term
+	err := s.db.WithContext(ctx).Order("start_date").Find(&terms).Error
+	return terms, err
+}
+
+func (s *pgCalendar) DeleteTerm(ctx context.Context, id uint) error {
+	result := s.db.WithContext(ctx).Delete(&Term{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *pgCalendar) CreateEvent(ctx context.Context, event *CalendarEvent) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if event.Kind == EventHoliday || event.Kind == EventExams {
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", calendarLockID).Error; err != nil {
+				return err
+			}
+			var recorded int64
+			err := tx.Model(&Attendance{}).
+				Where("date BETWEEN ? AND ?", event.StartDate, event.EndDate).
+				Count(&recorded).Error
+			if err != nil {
+				return err
+			}
+			if recorded > 0 {
+				return ErrConflict
+			}
+		}
+		return tx.Create(event).Error
+	})
+}
+
+func (s *pgCalendar) ListEvents(ctx context.Context, from, to Date) ([]CalendarEvent, error) {
+	var events []CalendarEvent
+	err := s.db.WithContext(ctx).
+		Where("end_date >= ? AND start_date <= ?", from, to).
+		Order("start_date, id").
+		Find(&events).Error
+	return events, err
+}
+
+func (s *pgCalendar) DeleteEvent(ctx context.Context, id uint) error {
+	result := s.db.WithContext(ctx).Delete(&CalendarEvent{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// checkOpenDay takes the calendar lock shared for the rest of tx and returns
+// ErrConflict if a holiday or exams cover date.
+func checkOpenDay(tx *gorm.DB, date Date) error {
+	if err := tx.Exec("SELECT pg_advisory_xact_lock_shared(?)", calendarLockID).Error; err != nil {
+		return err
+	}
+	var closing int64
+	err := tx.Model(&CalendarEvent{}).
+		Where("kind IN ? AND start_date <= ? AND end_date >= ?", []string{EventHoliday, EventExams}, date, date).
+		Count(&closing).Error
+	if err != nil {
+		return err
+	}
+	if closing > 0 {
+		return ErrConflict
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type pgCorrections struct {
+	db *gorm.DB
+}
+
+func (s *pgCorrections) CreateCorrection(ctx context.Context, correction *AttendanceCorrection) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var record Attendance
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&record, correction.AttendanceID).Error; err != nil {
+			return notFound(err)
+		}
+		var pending int64
+		err := tx.Model(&AttendanceCorrection{}).
+			Where("attendance_id = ? AND state = ?", record.ID, CorrectionPending).
+			Count(&pending).Error
+		if err != nil {
+			return err
+		}
+		if pending > 0 {
+			return ErrDuplicate
+		}
+		if err := tx.Create(correction).Error; err != nil {
+			return duplicate(err)
+		}
+		if correction.State != CorrectionApproved {
+			return nil
+		}
+		return applyCorrection(tx, &record, correction, correction.RequestedBy)
+	})
+}
+
+func (s *pgCorrections) GetCorrection(ctx context.Context, id uint) (*AttendanceCorrection, error) {
+	var correction AttendanceCorrection
+	if err := s.db.WithContext(ctx).First(&correction, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &correction, nil
+}
+
+func (s *pgCorrections) ListCorrections(ctx context.Context, filter CorrectionFilter) ([]AttendanceCorrection, error) {
+	query := s.db.WithContext(ctx).Order("id DESC")
+	if filter.AttendanceID != 0 {
+		query = query.Where("attendance_id = ?", filter.AttendanceID)
+	}
+	if filter.RequestedBy != 0 {
+		query = query.Where("requested_by = ?", filter.RequestedBy)
+	}
+	if filter.State != "" {
+		query = query.Where("state = ?", filter.State)
+	}
+	var corrections []AttendanceCorrection
+	err := query.Find(&corrections).Error
+	return corrections, err
+}
+
+func (s *pgCorrections) ReviewCorrection(ctx context.Context, id uint, approve bool, reviewedBy uint, comment string) (*AttendanceCorrection, error) {
+	var correction AttendanceCorrection
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&correction, id).Error; err != nil {
+			return notFound(err)
+		}
+		if correction.State != CorrectionPending {
+			return ErrConflict
+		}
+
+		now := time.Now()
+		correction.State = CorrectionRejected
+		if approve {
+			correction.State = CorrectionApproved
+		}
+		correction.ReviewedBy = &reviewedBy
+		correction.ReviewedAt = &now
+		correction.ReviewComment = comment
+		err := tx.Model(&correction).
+			Select("state", "reviewed_by", "reviewed_at", "review_comment").
+			Updates(&correction).Error
+		if err != nil || !approve {
+			return err
+		}
+
+		var record Attendance
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&record, correction.AttendanceID).Error; err != nil {
+			return err
+		}
+		return applyCorrection(tx, &record, &correction, reviewedBy)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &correction, nil
+}
+
+// applyCorrection gives the record the status the correction asks for.
+func applyCorrection(tx *gorm.DB, record *Attendance, correction *AttendanceCorrection, changedBy uint) error {
+	state := record.State()
+	state.Status, state.Reason = correction.Status, correction.Reason
+	return updateAttendance(tx, record, state, changedBy, &correction.ID)
+}
@@ -0,0 +1,164 @@
+package store
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type pgCourses struct {
+	db *gorm.DB
+}
+
+func (s *pgCourses) CreateCourse(ctx context.Context, course *Course) error {
+	return duplicate(s.db.WithContext(ctx).Create(course).Error)
+}
+
+func (s *pgCourses) GetCourse(ctx context.Context, id uint) (*Course, error) {
+	var course Course
+	if err := s.db.WithContext(ctx).First(&course, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &course, nil
+}
+
+func (s *pgCourses) ListCourses(ctx context.Context) ([]Course, error) {
+	var courses []Course
+	err := s.db.WithContext(ctx).Order("code").Find(&courses).Error
+	return courses, err
+}
+
+func (s *pgCourses) UpdateCourse(ctx context.Context, course *Course) error {
+	result := s.db.WithContext(ctx).Model(course).Select("code", "name").Updates(course)
+	if result.Error != nil {
+		return duplicate(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *pgCourses) DeleteCourse(ctx context.Context, id uint) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var course Course
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&course, id).Error; err != nil {
+			return notFound(err)
+		}
+		var sections int64
+		if err := tx.Model(&Section{}).Where("course_id = ?", id).Count(&sections).Error; err != nil {
+			return err
+		}
+		if sections > 0 {
+			return ErrConflict
+		}
+		return tx.Delete(&course).Error
+	})
+}
+
+func (s *pgCourses) CreateSection(ctx context.Context, section *Section) error {
+	return duplicate(s.db.WithContext(ctx).Create(section).Error)
+}
+
+func (s *pgCourses) GetSection(ctx context.Context, id uint) (*Section, error) {
+	var section Section
+	if err := s.db.WithContext(ctx).First(&section, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &section, nil
+}
+
+func (s *pgCourses) ListSections(ctx context.Context, filter SectionFilter) ([]Section, error) {
+	query := s.db.WithContext(ctx).Order("id")
+	if filter.CourseID != 0 {
+		query = query.Where("course_id = ?", filter.CourseID)
+	}
+	if filter.TeacherID != 0 {
+		query = query.Where("teacher_id = ?", filter.TeacherID)
+	}
+	if filter.StudentID != 0 {
+		query = query.Where("id IN (?)", s.db.Model(&Enrollment{}).Select("section_id").Where("student_id = ?", filter.StudentID))
+	}
+	if filter.Term != "" {
+		query = query.Where("term = ?", filter.Term)
+	}
+	var sections []Section
+	err := query.Find(&sections).Error
+	return sections, err
+}
+
+func (s *pgCourses) UpdateSection(ctx context.Context, section *Section) error {
+	result := s.db.WithContext(ctx).Model(section).Select("name", "term", "teacher_id").Updates(section)
+	if result.Error != nil {
+		return duplicate(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *pgCourses) DeleteSection(ctx context.Context, id uint) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var section Section
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&section, id).Error; err != nil {
+			return notFound(err)
+		}
+		var records int64
+		if err := tx.Model(&Attendance{}).Where("section_id = ?", id).Count(&records).Error; err != nil {
+			return err
+		}
+		if records > 0 {
+			return ErrConflict
+		}
+		if err := tx.Where("section_id = ?", id).Delete(&Enrollment{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("section_id = ?", id).Delete(&TimetableSlot{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&section).Error
+	})
+}
+
+func (s *pgCourses) Enroll(ctx context.Context, sectionId uint, studentIds []uint) error {
+	if len(studentIds) == 0 {
+		return nil
+	}
+	enrollments := make([]Enrollment, len(studentIds))
+	for i, studentId := range studentIds {
+		enrollments[i] = Enrollment{SectionID: sectionId, StudentID: studentId}
+	}
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&enrollments).Error
+}
+
+func (s *pgCourses) Unenroll(ctx context.Context, sectionId uint, studentId uint) error {
+	result := s.db.WithContext(ctx).
+		Where("section_id = ? AND student_id = ?", sectionId, studentId).
+		Delete(&Enrollment{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *pgCourses) IsEnrolled(ctx context.Context, sectionId uint, studentId uint) (bool, error) {
+	var count int64
+	err := s.db.WithContext(ctx).Model(&Enrollment{}).
+		Where("section_id = ? AND student_id = ?", sectionId, studentId).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (s *pgCourses) ListEnrolledStudents(ctx context.Context, sectionId uint) ([]Student, error) {
+	var students []Student
+	err := s.db.WithContext(ctx).
+		Where("id IN (?)", s.db.Model(&Enrollment{}).Select("student_id").Where("section_id = ?", sectionId)).
+		Order("id").
+		Find(&students).Error
+	return students, err
+}
@@ -0,0 +1,60 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type pgImpersonations struct {
+	db *gorm.DB
+}
+
+func (s *pgImpersonations) CreateImpersonation(ctx context.Context, impersonation *Impersonation) error {
+	return s.db.WithContext(ctx).Create(impersonation).Error
+}
+
+func (s *pgImpersonations) GetImpersonation(ctx context.Context, id uint) (*Impersonation, error) {
+	var impersonation Impersonation
+	if err := s.db.WithContext(ctx).First(&impersonation, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &impersonation, nil
+}
+
+func (s *pgImpersonations) ListImpersonations(ctx context.Context, userId uint, limit int) ([]Impersonation, error) {
+	query := s.db.WithContext(ctx).Order("id DESC").Limit(limit)
+	if userId != 0 {
+		query = query.Where("user_id = ?", userId)
+	}
+	var impersonations []Impersonation
+	err := query.Find(&impersonations).Error
+	return impersonations, err
+}
+
+func (s *pgImpersonations) EndImpersonation(ctx context.Context, id uint, now time.Time) error {
+	result := s.db.WithContext(ctx).Model(&Impersonation{}).
+		Where("id = ? AND ended_at IS NULL", id).
+		Update("ended_at", now)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *pgImpersonations) RecordImpersonationAction(ctx context.Context, action *ImpersonationAction) error {
+	return s.db.WithContext(ctx).Create(action).Error
+}
+
+func (s *pgImpersonations) ListImpersonationActions(ctx context.Context, impersonationId uint) ([]ImpersonationAction, error) {
+	var actions []ImpersonationAction
+	err := s.db.WithContext(ctx).
+		Where("impersonation_id = ?", impersonationId).
+		Order("id").
+		Find(&actions).Error
+	return actions, err
+}
@@ -0,0 +1,64 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type pgInvitations struct {
+	db *gorm.DB
+}
+
+func (s *pgInvitations) CreateInvitation(ctx context.Context, invitation *Invitation) error {
+	return s.db.WithContext(ctx).Create(invitation).Error
+}
+
+func (s *pgInvitations) GetInvitationByToken(ctx context.Context, tokenHash string) (*Invitation, error) {
+	var invitation Invitation
+	if err := s.db.WithContext(ctx).Where("token_hash = ?", tokenHash).First(&invitation).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &invitation, nil
+}
+
+func (s *pgInvitations) ListPendingInvitations(ctx context.Context, now time.Time) ([]Invitation, error) {
+	var invitations []Invitation
+	err := s.db.WithContext(ctx).
+		Where("used_at IS NULL AND expires_at > ?", now).
+		Order("created_at DESC").
+		Find(&invitations).Error
+	return invitations, err
+}
+
+func (s *pgInvitations) DeleteInvitation(ctx context.Context, id uint) error {
+	result := s.db.WithContext(ctx).Where("used_at IS NULL").Delete(&Invitation{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *pgInvitations) RedeemInvitation(ctx context.Context, id uint, account *NewAccount) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := createAccount(tx, account); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		result := tx.Model(&Invitation{}).
+			Where("id = ? AND used_at IS NULL AND expires_at > ?", id, now).
+			Updates(map[string]interface{}{"used_at": now, "used_by_id": account.User.ID})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrConflict
+		}
+		return nil
+	})
+}
@@ -0,0 +1,60 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type pgKeys struct {
+	db *gorm.DB
+}
+
+func (s *pgKeys) ListSigningKeys(ctx context.Context, now time.Time) ([]SigningKey, error) {
+	var keys []SigningKey
+	err := s.db.WithContext(ctx).
+		Where("expires_at IS NULL OR expires_at > ?", now).
+		Order("active_at, created_at").
+		Find(&keys).Error
+	return keys, err
+}
+
+func (s *pgKeys) AddSigningKey(ctx context.Context, key *SigningKey, previousKID string, retireAfter time.Duration) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Serialize rotations so that only one instance replaces a given key
+		if err := tx.Exec("LOCK TABLE signing_keys IN SHARE ROW EXCLUSIVE MODE").Error; err != nil {
+			return err
+		}
+
+		var newest SigningKey
+		err := tx.Order("active_at DESC, created_at DESC").First(&newest).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if newest.KID != previousKID {
+			return ErrConflict
+		}
+
+		// Keys that were published but would only have started signing after
+		// key are withdrawn; they never signed anything
+		err = tx.Model(&SigningKey{}).
+			Where("active_at > ?", key.ActiveAt).
+			Update("expires_at", key.ActiveAt).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&SigningKey{}).
+			Where("expires_at IS NULL").
+			Update("expires_at", key.ActiveAt.Add(retireAfter)).Error
+		if err != nil {
+			return err
+		}
+		return duplicate(tx.Create(key).Error)
+	})
+}
+
+func (s *pgKeys) PurgeExpiredSigningKeys(ctx context.Context, now time.Time) error {
+	return s.db.WithContext(ctx).Where("expires_at < ?", now).Delete(&SigningKey{}).Error
+}
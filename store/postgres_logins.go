@@ -0,0 +1,34 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type pgLogins struct {
+	db *gorm.DB
+}
+
+func (s *pgLogins) RecordLoginEvent(ctx context.Context, event *LoginEvent) error {
+	return s.db.WithContext(ctx).Create(event).Error
+}
+
+func (s *pgLogins) CountFailedLogins(ctx context.Context, ip string, since time.Time) (int64, error) {
+	var count int64
+	err := s.db.WithContext(ctx).Model(&LoginEvent{}).
+		Where("ip = ? AND NOT success AND created_at >= ?", ip, since).
+		Count(&count).Error
+	return count, err
+}
+
+func (s *pgLogins) ListLoginEvents(ctx context.Context, userId uint, limit int) ([]LoginEvent, error) {
+	var events []LoginEvent
+	err := s.db.WithContext(ctx).
+		Where("user_id = ?", userId).
+		Order("created_at DESC, id DESC").
+		Limit(limit).
+		Find(&events).Error
+	return events, err
+}
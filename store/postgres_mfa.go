@@ -0,0 +1,105 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type pgMFA struct {
+	db *gorm.DB
+}
+
+func (s *pgMFA) SetTOTPSecret(ctx context.Context, userId uint, secret string) error {
+	result := s.db.WithContext(ctx).Model(&User{}).
+		Where("id = ? AND NOT totp_enabled", userId).
+		Update("totp_secret", secret)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrConflict
+	}
+	return nil
+}
+
+func (s *pgMFA) EnableTOTP(ctx context.Context, userId uint, step int64, codeHashes []string) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&User{}).
+			Where("id = ? AND NOT totp_enabled AND totp_secret <> ''", userId).
+			Updates(map[string]interface{}{"totp_enabled": true, "totp_last_step": step})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrConflict
+		}
+		return replaceRecoveryCodes(tx, userId, codeHashes)
+	})
+}
+
+func (s *pgMFA) UseTOTPStep(ctx context.Context, userId uint, step int64) error {
+	result := s.db.WithContext(ctx).Model(&User{}).
+		Where("id = ? AND totp_last_step < ?", userId, step).
+		Update("totp_last_step", step)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrConflict
+	}
+	return nil
+}
+
+func (s *pgMFA) DisableTOTP(ctx context.Context, userId uint) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&User{}).Where("id = ?", userId).
+			Updates(map[string]interface{}{"totp_secret": "", "totp_enabled": false, "totp_last_step": 0}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userId).Delete(&RecoveryCode{}).Error
+	})
+}
+
+func (s *pgMFA) ReplaceRecoveryCodes(ctx context.Context, userId uint, codeHashes []string) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return replaceRecoveryCodes(tx, userId, codeHashes)
+	})
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userId uint, codeHashes []string) error {
+	if err := tx.Where("user_id = ?", userId).Delete(&RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	codes := make([]RecoveryCode, len(codeHashes))
+	for i, hash := range codeHashes {
+		codes[i] = RecoveryCode{UserID: userId, CodeHash: hash}
+	}
+	if len(codes) == 0 {
+		return nil
+	}
+	return tx.Create(&codes).Error
+}
+
+func (s *pgMFA) UseRecoveryCode(ctx context.Context, userId uint, codeHash string) error {
+	result := s.db.WithContext(ctx).Model(&RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userId, codeHash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *pgMFA) CountRecoveryCodes(ctx context.Context, userId uint) (int64, error) {
+	var count int64
+	err := s.db.WithContext(ctx).Model(&RecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userId).
+		Count(&count).Error
+	return count, err
+}
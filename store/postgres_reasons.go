@@ -0,0 +1,43 @@
+package store
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func (s *pgAttendance) CreateReason(ctx context.Context, reason *AttendanceReason) error {
+	return duplicate(s.db.WithContext(ctx).Create(reason).Error)
+}
+
+func (s *pgAttendance) GetReason(ctx context.Context, code string) (*AttendanceReason, error) {
+	var reason AttendanceReason
+	if err := s.db.WithContext(ctx).First(&reason, "code = ?", code).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &reason, nil
+}
+
+func (s *pgAttendance) ListReasons(ctx context.Context) ([]AttendanceReason, error) {
+	var reasons []AttendanceReason
+	err := s.db.WithContext(ctx).Order("code").Find(&reasons).Error
+	return reasons, err
+}
+
+func (s *pgAttendance) DeleteReason(ctx context.Context, code string) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var reason AttendanceReason
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&reason, "code = ?", code).Error; err != nil {
+			return notFound(err)
+		}
+		var records int64
+		if err := tx.Unscoped().Model(&Attendance{}).Where("reason = ?", code).Count(&records).Error; err != nil {
+			return err
+		}
+		if records > 0 {
+			return ErrConflict
+		}
+		return tx.Delete(&reason).Error
+	})
+}
@@ -0,0 +1,89 @@
+package store
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type pgRoles struct {
+	db *gorm.DB
+}
+
+func (s *pgRoles) ListRoles(ctx context.Context) ([]Role, error) {
+	var roles []Role
+	err := s.db.WithContext(ctx).Preload("Permissions").Order("name").Find(&roles).Error
+	return roles, err
+}
+
+func (s *pgRoles) GetRoleByName(ctx context.Context, name string) (*Role, error) {
+	var role Role
+	if err := s.db.WithContext(ctx).Preload("Permissions").Where("name = ?", name).First(&role).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &role, nil
+}
+
+func (s *pgRoles) CreateRole(ctx context.Context, role *Role) error {
+	return duplicate(s.db.WithContext(ctx).Create(role).Error)
+}
+
+func (s *pgRoles) SetRolePermissions(ctx context.Context, roleId uint, permissions []string) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("role_id = ?", roleId).Delete(&RolePermission{}).Error; err != nil {
+			return err
+		}
+		if len(permissions) == 0 {
+			return nil
+		}
+		rows := make([]RolePermission, len(permissions))
+		for i, permission := range permissions {
+			rows[i] = RolePermission{RoleID: roleId, Permission: permission}
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&rows).Error
+	})
+}
+
+func (s *pgRoles) DeleteRole(ctx context.Context, roleId uint) error {
+	result := s.db.WithContext(ctx).Delete(&Role{}, roleId)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *pgRoles) ListUserRoles(ctx context.Context, userId uint) ([]Role, error) {
+	var roles []Role
+	err := s.db.WithContext(ctx).
+		Preload("Permissions").
+		Joins("JOIN user_roles ON user_roles.role_id = roles.id").
+		Where("user_roles.user_id = ?", userId).
+		Order("roles.name").
+		Find(&roles).Error
+	return roles, err
+}
+
+func (s *pgRoles) AssignRole(ctx context.Context, userId uint, roleId uint) error {
+	return s.db.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&UserRole{UserID: userId, RoleID: roleId}).Error
+}
+
+func (s *pgRoles) RevokeRole(ctx context.Context, userId uint, roleId uint) error {
+	return s.db.WithContext(ctx).Where("user_id = ? AND role_id = ?", userId, roleId).Delete(&UserRole{}).Error
+}
+
+func (s *pgRoles) GetUserPermissions(ctx context.Context, userId uint) ([]string, error) {
+	var permissions []string
+	err := s.db.WithContext(ctx).
+		Model(&RolePermission{}).
+		Distinct("role_permissions.permission").
+		Joins("JOIN user_roles ON user_roles.role_id = role_permissions.role_id").
+		Where("user_roles.user_id = ?", userId).
+		Pluck("role_permissions.permission", &permissions).Error
+	return permissions, err
+}
@@ -0,0 +1,128 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"api/migrate"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openTestPostgres migrates the database at TEST_DATABASE_URL and returns
+// it, skipping the test when the variable is unset. The tests add rows with
+// unique names, so the database can be reused between runs.
+func openTestPostgres(t *testing.T) *gorm.DB {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	db, err := gorm.Open(postgres.Open(url), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+
+	migrator, err := migrate.New(sqlDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("migrating: %v", err)
+	}
+	return db
+}
+
+// createTestAttendance records an absence for a new student in a new
+// section and returns it.
+func createTestAttendance(t *testing.T, s *Store) *Attendance {
+	t.Helper()
+	ctx := context.Background()
+	suffix := strconv.FormatInt(time.Now().UnixNano(), 36)
+
+	student := &Student{Username: "student-" + suffix, Name: "Student", RegisterNumber: suffix}
+	if err := s.Students.CreateStudent(ctx, student); err != nil {
+		t.Fatal(err)
+	}
+	course := &Course{Code: "T" + suffix, Name: "Test course"}
+	if err := s.Courses.CreateCourse(ctx, course); err != nil {
+		t.Fatal(err)
+	}
+	section := &Section{CourseID: course.ID, Name: "A", Term: "test"}
+	if err := s.Courses.CreateSection(ctx, section); err != nil {
+		t.Fatal(err)
+	}
+
+	attendance := &Attendance{
+		StudentId: student.ID,
+		SectionID: section.ID,
+		Date:      Today(),
+		Period:    "01",
+		Status:    AttendanceAbsent,
+	}
+	if err := s.Attendance.CreateAttendance(ctx, attendance, 1); err != nil {
+		t.Fatal(err)
+	}
+	return attendance
+}
+
+func TestPostgresAttendanceChangesAppendOnly(t *testing.T) {
+	db := openTestPostgres(t)
+	s := NewPostgres(db)
+	ctx := context.Background()
+	attendance := createTestAttendance(t, s)
+
+	changes, err := s.Attendance.ListAttendanceChanges(ctx, attendance.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 {
+		t.Fatalf("got %d changes, want 1", len(changes))
+	}
+
+	err = db.Exec("UPDATE attendance_changes SET changed_by = 2 WHERE id = ?", changes[0].ID).Error
+	if err == nil || !strings.Contains(err.Error(), "append-only") {
+		t.Errorf("UPDATE: got %v, want the append-only error", err)
+	}
+	err = db.Exec("DELETE FROM attendance_changes WHERE id = ?", changes[0].ID).Error
+	if err == nil || !strings.Contains(err.Error(), "append-only") {
+		t.Errorf("DELETE: got %v, want the append-only error", err)
+	}
+
+	changes, err = s.Attendance.ListAttendanceChanges(ctx, attendance.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].ChangedBy != 1 {
+		t.Errorf("history changed: %+v", changes)
+	}
+}
+
+func TestPostgresAttendanceUniquePerClass(t *testing.T) {
+	db := openTestPostgres(t)
+	s := NewPostgres(db)
+	attendance := createTestAttendance(t, s)
+
+	again := &Attendance{
+		StudentId: attendance.StudentId,
+		SectionID: attendance.SectionID,
+		Date:      attendance.Date,
+		Period:    attendance.Period,
+		Status:    AttendancePresent,
+	}
+	err := s.Attendance.CreateAttendance(context.Background(), again, 1)
+	if !errors.Is(err, ErrDuplicate) {
+		t.Errorf("got %v, want ErrDuplicate", err)
+	}
+}
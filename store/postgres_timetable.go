@@ -0,0 +1,169 @@
+package store
+
+import (
+	"context"
+	"sort"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type pgTimetable struct {
+	db *gorm.DB
+}
+
+func (s *pgTimetable) CreatePeriod(ctx context.Context, period *Period) error {
+	return duplicate(s.db.WithContext(ctx).Create(period).Error)
+}
+
+func (s *pgTimetable) GetPeriod(ctx context.Context, id uint) (*Period, error) {
+	var period Period
+	if err := s.db.WithContext(ctx).First(&period, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &period, nil
+}
+
+func (s *pgTimetable) ListPeriods(ctx context.Context) ([]Period, error) {
+	var periods []Period
+	err := s.db.WithContext(ctx).Order("weekday, start_time, name").Find(&periods).Error
+	return periods, err
+}
+
+func (s *pgTimetable) UpdatePeriod(ctx context.Context, period *Period) error {
+	result := s.db.WithContext(ctx).Model(period).Select("name", "start_time", "end_time").Updates(period)
+	if result.Error != nil {
+		return duplicate(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *pgTimetable) DeletePeriod(ctx context.Context, id uint) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var period Period
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&period, id).Error; err != nil {
+			return notFound(err)
+		}
+		var slots int64
+		if err := tx.Model(&TimetableSlot{}).Where("period_id = ?", id).Count(&slots).Error; err != nil {
+			return err
+		}
+		if slots > 0 {
+			return ErrConflict
+		}
+		return tx.Delete(&period).Error
+	})
+}
+
+func (s *pgTimetable) CreateSlot(ctx context.Context, slot *TimetableSlot) error {
+	return duplicate(s.db.WithContext(ctx).Create(slot).Error)
+}
+
+func (s *pgTimetable) DeleteSlot(ctx context.Context, sectionId uint, id uint) error {
+	result := s.db.WithContext(ctx).Where("section_id = ?", sectionId).Delete(&TimetableSlot{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *pgTimetable) ListClasses(ctx context.Context, filter ClassFilter) ([]ScheduledClass, error) {
+	query := s.db.WithContext(ctx).Model(&TimetableSlot{}).
+		Select("timetable_slots.*").
+		Joins("JOIN periods ON periods.id = timetable_slots.period_id").
+		Joins("JOIN sections ON sections.id = timetable_slots.section_id AND sections.deleted_at IS NULL")
+	if filter.SectionID != 0 {
+		query = query.Where("timetable_slots.section_id = ?", filter.SectionID)
+	}
+	if filter.StudentID != 0 {
+		query = query.Where("timetable_slots.section_id IN (?)",
+			s.db.Model(&Enrollment{}).Select("section_id").Where("student_id = ?", filter.StudentID))
+	}
+	if filter.TeacherID != 0 {
+		query = query.Where("COALESCE(timetable_slots.teacher_id, sections.teacher_id) = ?", filter.TeacherID)
+	}
+	if filter.Weekday != nil {
+		query = query.Where("periods.weekday = ?", *filter.Weekday)
+	}
+	if filter.PeriodName != "" {
+		query = query.Where("periods.name = ?", filter.PeriodName)
+	}
+	var slots []TimetableSlot
+	if err := query.Find(&slots).Error; err != nil {
+		return nil, err
+	}
+	if len(slots) == 0 {
+		return nil, nil
+	}
+
+	var periodIds, sectionIds []uint
+	for _, slot := range slots {
+		periodIds = append(periodIds, slot.PeriodID)
+		sectionIds = append(sectionIds, slot.SectionID)
+	}
+	var periods []Period
+	if err := s.db.WithContext(ctx).Find(&periods, periodIds).Error; err != nil {
+		return nil, err
+	}
+	var sections []Section
+	if err := s.db.WithContext(ctx).Find(&sections, sectionIds).Error; err != nil {
+		return nil, err
+	}
+	var courseIds []uint
+	for _, section := range sections {
+		courseIds = append(courseIds, section.CourseID)
+	}
+	var courses []Course
+	if err := s.db.WithContext(ctx).Unscoped().Find(&courses, courseIds).Error; err != nil {
+		return nil, err
+	}
+
+	periodsById := map[uint]Period{}
+	for _, period := range periods {
+		periodsById[period.ID] = period
+	}
+	sectionsById := map[uint]Section{}
+	for _, section := range sections {
+		sectionsById[section.ID] = section
+	}
+	coursesById := map[uint]Course{}
+	for _, course := range courses {
+		coursesById[course.ID] = course
+	}
+
+	classes := make([]ScheduledClass, len(slots))
+	for i, slot := range slots {
+		section := sectionsById[slot.SectionID]
+		classes[i] = newScheduledClass(slot, periodsById[slot.PeriodID], section, coursesById[section.CourseID])
+	}
+	sortClasses(classes)
+	return classes, nil
+}
+
+func newScheduledClass(slot TimetableSlot, period Period, section Section, course Course) ScheduledClass {
+	class := ScheduledClass{Slot: slot, Period: period, Section: section, Course: course, TeacherID: slot.TeacherID}
+	if class.TeacherID == nil {
+		class.TeacherID = section.TeacherID
+	}
+	return class
+}
+
+// sortClasses orders classes by weekday, start time and section.
+func sortClasses(classes []ScheduledClass) {
+	sort.Slice(classes, func(i, j int) bool {
+		a, b := classes[i], classes[j]
+		if a.Period.Weekday != b.Period.Weekday {
+			return a.Period.Weekday < b.Period.Weekday
+		}
+		if a.Period.StartTime != b.Period.StartTime {
+			return a.Period.StartTime < b.Period.StartTime
+		}
+		return a.Section.ID < b.Section.ID
+	})
+}
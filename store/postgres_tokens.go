@@ -0,0 +1,153 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type pgTokens struct {
+	db *gorm.DB
+}
+
+func (s *pgTokens) CreateRefreshToken(ctx context.Context, token *RefreshToken) error {
+	return s.db.WithContext(ctx).Create(token).Error
+}
+
+func (s *pgTokens) GetRefreshToken(ctx context.Context, tokenHash string) (*RefreshToken, error) {
+	var token RefreshToken
+	if err := s.db.WithContext(ctx).Where("token_hash = ?", tokenHash).First(&token).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &token, nil
+}
+
+func (s *pgTokens) RotateRefreshToken(ctx context.Context, current *RefreshToken, next *RefreshToken) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(next).Error; err != nil {
+			return err
+		}
+
+		// Only one rotation of a given token may win
+		now := time.Now()
+		result := tx.Model(&RefreshToken{}).
+			Where("id = ? AND revoked_at IS NULL", current.ID).
+			Updates(map[string]interface{}{"revoked_at": now, "replaced_by": next.ID})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrConflict
+		}
+		current.RevokedAt = &now
+		current.ReplacedBy = &next.ID
+		return nil
+	})
+}
+
+func (s *pgTokens) RevokeRefreshFamily(ctx context.Context, familyId string) error {
+	return s.db.WithContext(ctx).Model(&RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyId).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (s *pgTokens) RevokeUserRefreshTokens(ctx context.Context, userId uint) error {
+	return s.db.WithContext(ctx).Model(&RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userId).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (s *pgTokens) RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	return s.db.WithContext(ctx).
+		Exec("INSERT INTO revoked_tokens (jti, expires_at) VALUES (?, ?) ON CONFLICT (jti) DO NOTHING", jti, expiresAt).
+		Error
+}
+
+func (s *pgTokens) IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	var count int64
+	err := s.db.WithContext(ctx).Model(&RevokedToken{}).Where("jti = ?", jti).Count(&count).Error
+	return count > 0, err
+}
+
+func (s *pgTokens) CreatePasswordReset(ctx context.Context, reset *PasswordReset) error {
+	return s.db.WithContext(ctx).Create(reset).Error
+}
+
+func (s *pgTokens) GetPasswordReset(ctx context.Context, tokenHash string) (*PasswordReset, error) {
+	var reset PasswordReset
+	if err := s.db.WithContext(ctx).Where("token_hash = ?", tokenHash).First(&reset).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &reset, nil
+}
+
+func (s *pgTokens) ResetPassword(ctx context.Context, reset *PasswordReset, passwordHash string) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Model(&PasswordReset{}).
+			Where("id = ? AND used_at IS NULL AND expires_at > ?", reset.ID, now).
+			Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrConflict
+		}
+		reset.UsedAt = &now
+
+		// Older links stop working once the password has been reset
+		err := tx.Model(&PasswordReset{}).
+			Where("user_id = ? AND used_at IS NULL", reset.UserID).
+			Update("used_at", now).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&User{}).Where("id = ?", reset.UserID).
+			Updates(map[string]interface{}{"password": passwordHash, "tokens_not_before": now}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&User{}).
+			Where("id = ? AND email <> '' AND lower(email) = lower(?)", reset.UserID, reset.Email).
+			Update("email_verified", true).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&RefreshToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", reset.UserID).
+			Update("revoked_at", now).Error
+	})
+}
+
+func (s *pgTokens) CreateOIDCLogin(ctx context.Context, login *OIDCLogin) error {
+	return s.db.WithContext(ctx).Create(login).Error
+}
+
+func (s *pgTokens) TakeOIDCLogin(ctx context.Context, stateHash string) (*OIDCLogin, error) {
+	var logins []OIDCLogin
+	err := s.db.WithContext(ctx).
+		Raw("DELETE FROM oidc_logins WHERE state_hash = ? RETURNING *", stateHash).
+		Scan(&logins).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(logins) == 0 {
+		return nil, ErrNotFound
+	}
+	return &logins[0], nil
+}
+
+func (s *pgTokens) PurgeExpiredTokens(ctx context.Context, now time.Time) error {
+	db := s.db.WithContext(ctx)
+	if err := db.Where("expires_at < ?", now).Delete(&RefreshToken{}).Error; err != nil {
+		return err
+	}
+	if err := db.Where("expires_at < ?", now).Delete(&PasswordReset{}).Error; err != nil {
+		return err
+	}
+	if err := db.Where("expires_at < ?", now).Delete(&OIDCLogin{}).Error; err != nil {
+		return err
+	}
+	return db.Where("expires_at < ?", now).Delete(&RevokedToken{}).Error
+}
@@ -0,0 +1,515 @@
+// Package store keeps every database query behind small interfaces so that
+// handlers never build GORM queries themselves. Postgres is the production
+// implementation; Memory backs unit tests and local experiments.
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned when the requested record does not exist.
+var ErrNotFound = errors.New("record not found")
+
+// ErrDuplicate is returned when a record violates a uniqueness constraint,
+// e.g. a username or role name that is already taken.
+var ErrDuplicate = errors.New("record already exists")
+
+// ErrConflict is returned when a record changed between being read and
+// being updated, e.g. a refresh token that was rotated concurrently.
+var ErrConflict = errors.New("record was modified concurrently")
+
+type UserStore interface {
+	CreateUser(ctx context.Context, user *User) error
+	GetUser(ctx context.Context, id uint) (*User, error)
+	GetUserByUsername(ctx context.Context, username string) (*User, error)
+	// GetUserByEmail matches email case-insensitively.
+	GetUserByEmail(ctx context.Context, email string) (*User, error)
+	// SetPassword sets the password and rejects the access tokens issued
+	// up to now.
+	SetPassword(ctx context.Context, userId uint, passwordHash string) error
+	// GetUserByIdentity returns the user linked to the external identity.
+	GetUserByIdentity(ctx context.Context, issuer string, subject string) (*User, error)
+	// LinkIdentity links an external identity to an existing user. It
+	// returns ErrDuplicate if the identity is already linked.
+	LinkIdentity(ctx context.Context, identity *UserIdentity) error
+	// RecordLoginFailure counts a failed login against the user and locks
+	// the account until now+lockout once maxFailures is reached. It returns
+	// the updated user.
+	RecordLoginFailure(ctx context.Context, userId uint, maxFailures int, lockout time.Duration) (*User, error)
+	// ClearLoginFailures resets the failure count and lifts any lockout.
+	ClearLoginFailures(ctx context.Context, userId uint) error
+	// CreateAccount creates the user, assigns its role and creates or links
+	// its profile in one transaction.
+	CreateAccount(ctx context.Context, account *NewAccount) error
+	// GetProfileIDs returns the IDs of the Student, Teacher and IPM profiles
+	// linked to username; profiles that do not exist are left as zero.
+	GetProfileIDs(ctx context.Context, username string) (*ProfileIDs, error)
+
+	// ListUsers returns one page of the users matching filter, in ID order,
+	// and how many users match in total.
+	ListUsers(ctx context.Context, filter UserFilter) ([]User, int64, error)
+	// SetEmail changes the user's email, which is then unverified.
+	SetEmail(ctx context.Context, userId uint, email string) error
+	// ChangeUserType sets the user's type and replaces their role oldRoleId
+	// with newRoleId in one transaction.
+	ChangeUserType(ctx context.Context, userId uint, userType string, oldRoleId uint, newRoleId uint) error
+	// SetDisabled enables or disables the account. Disabling also revokes
+	// its refresh tokens.
+	SetDisabled(ctx context.Context, userId uint, disabled bool) error
+	// DeleteUser soft-deletes the user and revokes its refresh tokens.
+	// Profiles stay, unlinked, so that their records are kept.
+	DeleteUser(ctx context.Context, userId uint) error
+	// ForcePasswordReset clears the password, revokes the refresh tokens and
+	// rejects access tokens issued up to now, in one transaction.
+	ForcePasswordReset(ctx context.Context, userId uint, now time.Time) error
+	// LinkProfile links the profile of kind with profileId to username. It
+	// returns ErrNotFound if there is no such profile and ErrConflict if it
+	// is linked to another user.
+	LinkProfile(ctx context.Context, kind ProfileKind, profileId uint, username string) error
+	// UnlinkProfile unlinks the profiles of kind from username. It returns
+	// ErrNotFound if none is linked.
+	UnlinkProfile(ctx context.Context, kind ProfileKind, username string) error
+}
+
+// UserFilter selects users for ListUsers. Zero fields match every user.
+type UserFilter struct {
+	Search   string // Substring of the username or email, case-insensitive
+	UserType string
+	Disabled *bool
+	Offset   int
+	Limit    int
+}
+
+// ProfileKind names one of the profile tables a user can be linked to.
+type ProfileKind string
+
+const (
+	ProfileStudent ProfileKind = "student"
+	ProfileTeacher ProfileKind = "teacher"
+	ProfileIPM     ProfileKind = "ipm"
+)
+
+// NewAccount is everything created when someone signs up. At most one of
+// Student, Teacher and IPM is set; a Teacher or IPM with a non-zero ID is an
+// existing profile that gets linked to the new user. Identity, when set, links
+// the account to an external identity provider.
+type NewAccount struct {
+	User     *User
+	RoleID   uint
+	Student  *Student
+	Teacher  *Teacher
+	IPM      *IPM
+	Identity *UserIdentity
+}
+
+// ProfileIDs identifies the profiles linked to a user account.
+type ProfileIDs struct {
+	StudentID uint
+	TeacherID uint
+	IPMID     uint
+}
+
+type StudentStore interface {
+	CreateStudent(ctx context.Context, student *Student) error
+	// GetStudentByUsername returns the student with their attendance records.
+	GetStudentByUsername(ctx context.Context, username string) (*Student, error)
+	GetStudent(ctx context.Context, id uint) (*Student, error)
+	GetStudentByRegisterNumber(ctx context.Context, registerNumber string) (*Student, error)
+}
+
+type TeacherStore interface {
+	CreateTeacher(ctx context.Context, teacher *Teacher) error
+	GetTeacher(ctx context.Context, id uint) (*Teacher, error)
+	GetTeacherByUsername(ctx context.Context, username string) (*Teacher, error)
+}
+
+// AttendanceStore records attendance. Every change to a record is written to
+// its history, as made by the user whose ID is passed as changedBy, and
+// updates the student's AttendanceSummary for the course.
+type AttendanceStore interface {
+	// CreateAttendance returns ErrDuplicate if the student already has a
+	// record for the class and ErrConflict if a holiday or exams cover its
+	// date.
+	CreateAttendance(ctx context.Context, attendance *Attendance, changedBy uint) error
+	GetAttendance(ctx context.Context, id uint) (*Attendance, error)
+	// SetAttendanceStatus changes the status and reason of a record. It
+	// returns ErrNotFound if there is no such record.
+	SetAttendanceStatus(ctx context.Context, id uint, mark Mark, changedBy uint) error
+	FindAttendance(ctx context.Context, studentId uint, date Date, period string) ([]Attendance, error)
+	// ListAttendance returns one page of the records matching filter,
+	// ordered by date, period and ID, and how many match in total.
+	ListAttendance(ctx context.Context, filter AttendanceFilter) ([]Attendance, int64, error)
+	// RecordRollCall records the attendance of a whole class in one
+	// transaction. Students who already have a record for the class keep it,
+	// with the status and reason updated, so repeating a roll call changes
+	// nothing. The results are ordered by student ID. It returns
+	// ErrDuplicate if a record for the class was created at the same time
+	// and ErrConflict if a holiday or exams cover the date.
+	RecordRollCall(ctx context.Context, rollCall RollCall) ([]RollCallResult, error)
+	// ListAttendanceSummaries returns the student's summaries, with their
+	// course, ordered by course code and status.
+	ListAttendanceSummaries(ctx context.Context, studentId uint) ([]AttendanceSummary, error)
+	// SummarizeAttendance counts the records matching filter into
+	// summaries per student, course and status, as ListAttendanceSummaries
+	// returns them but counted on the fly. Offset and Limit are ignored.
+	SummarizeAttendance(ctx context.Context, filter AttendanceFilter) ([]AttendanceSummary, error)
+	// ListAttendanceChanges returns the history of a record, oldest first.
+	ListAttendanceChanges(ctx context.Context, attendanceId uint) ([]AttendanceChange, error)
+
+	// CreateReason returns ErrDuplicate if the code is taken.
+	CreateReason(ctx context.Context, reason *AttendanceReason) error
+	GetReason(ctx context.Context, code string) (*AttendanceReason, error)
+	// ListReasons returns every reason ordered by code.
+	ListReasons(ctx context.Context) ([]AttendanceReason, error)
+	// DeleteReason returns ErrConflict while attendance records use it.
+	DeleteReason(ctx context.Context, code string) error
+}
+
+// AttendanceFilter selects records for ListAttendance. Zero fields match
+// every record.
+type AttendanceFilter struct {
+	StudentID uint
+	SectionID uint
+	CourseID  uint   // Records of any section of the course
+	TeacherID string // Records taken by the teacher
+	Status    string
+	From      Date // First day, inclusive
+	To        Date // Last day, inclusive
+	Offset    int
+	Limit     int
+}
+
+// RollCall is the attendance of one class of a section.
+type RollCall struct {
+	SectionID uint
+	Date      Date
+	Period    string
+	TeacherID string        // Stored on new records
+	Marks     map[uint]Mark // The attendance of each student, by student ID
+	ChangedBy uint          // User taking the roll call
+}
+
+// Mark is the status, and optionally the reason for it, recorded for a
+// student.
+type Mark struct {
+	Status string
+	Reason string
+}
+
+// Outcomes of a roll call for a student.
+const (
+	RollCallCreated   = "created"
+	RollCallUpdated   = "updated"
+	RollCallUnchanged = "unchanged"
+)
+
+// RollCallResult is what a roll call did for one student.
+type RollCallResult struct {
+	StudentID    uint
+	AttendanceID uint
+	Mark         Mark
+	Outcome      string
+}
+
+// CorrectionStore keeps requests to correct attendance records.
+type CorrectionStore interface {
+	// CreateCorrection saves a correction. One created as approved is
+	// applied to the record at once. It returns ErrNotFound if the record
+	// does not exist and ErrDuplicate if it has a pending correction.
+	CreateCorrection(ctx context.Context, correction *AttendanceCorrection) error
+	GetCorrection(ctx context.Context, id uint) (*AttendanceCorrection, error)
+	// ListCorrections returns the corrections matching filter, newest first.
+	ListCorrections(ctx context.Context, filter CorrectionFilter) ([]AttendanceCorrection, error)
+	// ReviewCorrection approves, applying it, or rejects a pending
+	// correction. It returns ErrConflict if the correction is not pending.
+	ReviewCorrection(ctx context.Context, id uint, approve bool, reviewedBy uint, comment string) (*AttendanceCorrection, error)
+}
+
+// CorrectionFilter selects corrections; zero fields match any.
+type CorrectionFilter struct {
+	AttendanceID uint
+	RequestedBy  uint
+	State        string
+}
+
+// CourseStore manages courses, their sections and the students enrolled in
+// them.
+type CourseStore interface {
+	// CreateCourse returns ErrDuplicate if the code is taken.
+	CreateCourse(ctx context.Context, course *Course) error
+	GetCourse(ctx context.Context, id uint) (*Course, error)
+	// ListCourses returns every course ordered by code.
+	ListCourses(ctx context.Context) ([]Course, error)
+	// UpdateCourse saves the code and name. It returns ErrDuplicate if the
+	// code is taken.
+	UpdateCourse(ctx context.Context, course *Course) error
+	// DeleteCourse returns ErrConflict while the course has sections.
+	DeleteCourse(ctx context.Context, id uint) error
+
+	// CreateSection returns ErrDuplicate if the course already has a
+	// section of that name in the term.
+	CreateSection(ctx context.Context, section *Section) error
+	GetSection(ctx context.Context, id uint) (*Section, error)
+	// ListSections returns the sections matching filter, ordered by ID.
+	ListSections(ctx context.Context, filter SectionFilter) ([]Section, error)
+	// UpdateSection saves the name, term and teacher. It returns
+	// ErrDuplicate like CreateSection.
+	UpdateSection(ctx context.Context, section *Section) error
+	// DeleteSection removes the section, its enrollments and its timetable
+	// slots. It returns
+	// ErrConflict once attendance has been recorded for the section.
+	DeleteSection(ctx context.Context, id uint) error
+
+	// Enroll adds students to a section, skipping those already in it.
+	Enroll(ctx context.Context, sectionId uint, studentIds []uint) error
+	// Unenroll returns ErrNotFound if the student is not in the section.
+	Unenroll(ctx context.Context, sectionId uint, studentId uint) error
+	IsEnrolled(ctx context.Context, sectionId uint, studentId uint) (bool, error)
+	// ListEnrolledStudents returns the students in a section by ID.
+	ListEnrolledStudents(ctx context.Context, sectionId uint) ([]Student, error)
+}
+
+// SectionFilter narrows ListSections. Zero fields match every section.
+type SectionFilter struct {
+	CourseID  uint
+	TeacherID uint
+	StudentID uint // Sections the student is enrolled in
+	Term      string
+}
+
+// TimetableStore manages the periods of the week and the timetable slots
+// that schedule sections in them.
+type TimetableStore interface {
+	// CreatePeriod returns ErrDuplicate if the weekday already has a period
+	// of that name.
+	CreatePeriod(ctx context.Context, period *Period) error
+	GetPeriod(ctx context.Context, id uint) (*Period, error)
+	// ListPeriods returns every period by weekday and start time.
+	ListPeriods(ctx context.Context) ([]Period, error)
+	// UpdatePeriod saves the name and times. It returns ErrDuplicate like
+	// CreatePeriod.
+	UpdatePeriod(ctx context.Context, period *Period) error
+	// DeletePeriod returns ErrConflict while a slot uses the period.
+	DeletePeriod(ctx context.Context, id uint) error
+
+	// CreateSlot returns ErrDuplicate if the section is already scheduled
+	// in the period.
+	CreateSlot(ctx context.Context, slot *TimetableSlot) error
+	// DeleteSlot returns ErrNotFound if the section has no such slot.
+	DeleteSlot(ctx context.Context, sectionId uint, id uint) error
+	// ListClasses returns the scheduled classes matching filter by weekday
+	// and start time.
+	ListClasses(ctx context.Context, filter ClassFilter) ([]ScheduledClass, error)
+}
+
+// CalendarStore keeps the academic calendar: the terms and the events that
+// change which days have classes.
+type CalendarStore interface {
+	// CreateTerm returns ErrDuplicate if the name is taken and ErrConflict
+	// if the term overlaps another.
+	CreateTerm(ctx context.Context, term *Term) error
+	GetTermByName(ctx context.Context, name string) (*Term, error)
+	// ListTerms returns every term by start date.
+	ListTerms(ctx context.Context) ([]Term, error)
+	DeleteTerm(ctx context.Context, id uint) error
+
+	// CreateEvent returns ErrConflict for a holiday or exams on days that
+	// already have attendance recorded. It waits for attendance being
+	// recorded at the same time, which in turn fails once the day is closed.
+	CreateEvent(ctx context.Context, event *CalendarEvent) error
+	// ListEvents returns the events on any of the days from from to to,
+	// inclusive, by start date.
+	ListEvents(ctx context.Context, from, to Date) ([]CalendarEvent, error)
+	DeleteEvent(ctx context.Context, id uint) error
+}
+
+// ClassFilter narrows ListClasses. Zero fields match every class.
+type ClassFilter struct {
+	SectionID  uint
+	StudentID  uint // Classes of the sections the student is enrolled in
+	TeacherID  uint // Classes the teacher teaches
+	Weekday    *time.Weekday
+	PeriodName string
+}
+
+// ClaimApproved is the status IPM staff give a claim they accept.
+const ClaimApproved = "Approved"
+
+type ClaimStore interface {
+	// CreateClaim saves the claim together with its files and claim reviews,
+	// and marks the attendance records under review as IsClaimed. Like the
+	// AttendanceStore, it records the change as made by changedBy.
+	CreateClaim(ctx context.Context, claim *MedicalClaim, changedBy uint) error
+	// GetClaim returns the claim with its student, files and reviews.
+	GetClaim(ctx context.Context, id uint) (*MedicalClaim, error)
+	ListClaimsByStudent(ctx context.Context, studentId uint) ([]MedicalClaim, error)
+	// ListReviewedClaims returns the claims that no teacher still has pending.
+	ListReviewedClaims(ctx context.Context) ([]MedicalClaim, error)
+	// UpdateClaimStatus sets the status and message where given. Approving
+	// the claim (ClaimApproved, in any case) marks the attendance records
+	// under review as IsApplied; any other status clears them again.
+	UpdateClaimStatus(ctx context.Context, id uint, status string, message string, changedBy uint) (*MedicalClaim, error)
+
+	// ListReviewsByTeacher returns the teacher's reviews with their claims.
+	ListReviewsByTeacher(ctx context.Context, teacherId string) ([]ClaimReview, error)
+	GetClaimReview(ctx context.Context, id uint) (*ClaimReview, error)
+	UpdateClaimReview(ctx context.Context, review *ClaimReview) error
+}
+
+type TokenStore interface {
+	CreateRefreshToken(ctx context.Context, token *RefreshToken) error
+	GetRefreshToken(ctx context.Context, tokenHash string) (*RefreshToken, error)
+	// RotateRefreshToken revokes current and saves next in its place. It
+	// returns ErrConflict if current was already revoked.
+	RotateRefreshToken(ctx context.Context, current *RefreshToken, next *RefreshToken) error
+	RevokeRefreshFamily(ctx context.Context, familyId string) error
+	RevokeUserRefreshTokens(ctx context.Context, userId uint) error
+
+	RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error
+	IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error)
+
+	CreatePasswordReset(ctx context.Context, reset *PasswordReset) error
+	GetPasswordReset(ctx context.Context, tokenHash string) (*PasswordReset, error)
+	// ResetPassword uses up reset and every other pending reset of its user,
+	// sets the new password, revokes the user's refresh tokens and rejects
+	// their access tokens issued up to now, in one transaction. The user's
+	// email counts as verified if it is still the one the link was sent to.
+	// It returns ErrConflict if reset was used or has expired.
+	ResetPassword(ctx context.Context, reset *PasswordReset, passwordHash string) error
+
+	CreateOIDCLogin(ctx context.Context, login *OIDCLogin) error
+	// TakeOIDCLogin deletes and returns the login with the given state hash,
+	// so that each state is used at most once.
+	TakeOIDCLogin(ctx context.Context, stateHash string) (*OIDCLogin, error)
+
+	// PurgeExpiredTokens deletes refresh tokens, revoked tokens, password
+	// resets and single sign-on logins that expired before now.
+	PurgeExpiredTokens(ctx context.Context, now time.Time) error
+}
+
+type LoginStore interface {
+	RecordLoginEvent(ctx context.Context, event *LoginEvent) error
+	// CountFailedLogins counts failed attempts from ip since the given time.
+	CountFailedLogins(ctx context.Context, ip string, since time.Time) (int64, error)
+	// ListLoginEvents returns the user's most recent attempts, newest first.
+	ListLoginEvents(ctx context.Context, userId uint, limit int) ([]LoginEvent, error)
+}
+
+// MFAStore manages TOTP two-factor authentication. The TOTP fields live on
+// User; recovery codes are stored hashed.
+type MFAStore interface {
+	// SetTOTPSecret starts enrollment with a new secret. It returns
+	// ErrConflict if TOTP is already enabled.
+	SetTOTPSecret(ctx context.Context, userId uint, secret string) error
+	// EnableTOTP finishes enrollment: it records step as used and replaces
+	// the user's recovery codes. It returns ErrConflict if TOTP is already
+	// enabled.
+	EnableTOTP(ctx context.Context, userId uint, step int64, codeHashes []string) error
+	// UseTOTPStep records step as used. It returns ErrConflict if step is
+	// not after the last one used, so a code works only once.
+	UseTOTPStep(ctx context.Context, userId uint, step int64) error
+	// DisableTOTP clears the secret and deletes the recovery codes.
+	DisableTOTP(ctx context.Context, userId uint) error
+
+	ReplaceRecoveryCodes(ctx context.Context, userId uint, codeHashes []string) error
+	// UseRecoveryCode marks an unused code as used. It returns ErrNotFound
+	// if the user has no such unused code.
+	UseRecoveryCode(ctx context.Context, userId uint, codeHash string) error
+	CountRecoveryCodes(ctx context.Context, userId uint) (int64, error)
+}
+
+type RoleStore interface {
+	// ListRoles returns every role with its permissions.
+	ListRoles(ctx context.Context) ([]Role, error)
+	GetRoleByName(ctx context.Context, name string) (*Role, error)
+	// CreateRole saves the role together with its permissions.
+	CreateRole(ctx context.Context, role *Role) error
+	SetRolePermissions(ctx context.Context, roleId uint, permissions []string) error
+	DeleteRole(ctx context.Context, roleId uint) error
+
+	ListUserRoles(ctx context.Context, userId uint) ([]Role, error)
+	AssignRole(ctx context.Context, userId uint, roleId uint) error
+	RevokeRole(ctx context.Context, userId uint, roleId uint) error
+	// GetUserPermissions returns the union of the permissions of every role
+	// assigned to the user.
+	GetUserPermissions(ctx context.Context, userId uint) ([]string, error)
+}
+
+type InvitationStore interface {
+	CreateInvitation(ctx context.Context, invitation *Invitation) error
+	GetInvitationByToken(ctx context.Context, tokenHash string) (*Invitation, error)
+	// ListPendingInvitations returns unused invitations that have not expired.
+	ListPendingInvitations(ctx context.Context, now time.Time) ([]Invitation, error)
+	DeleteInvitation(ctx context.Context, id uint) error
+	// RedeemInvitation marks the invitation used and creates the account in
+	// one transaction. It returns ErrConflict if the invitation was already
+	// used or has expired.
+	RedeemInvitation(ctx context.Context, id uint, account *NewAccount) error
+}
+
+type APIKeyStore interface {
+	CreateAPIKey(ctx context.Context, key *APIKey) error
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (*APIKey, error)
+	// ListAPIKeys returns the user's keys, or every key when userId is 0,
+	// newest first.
+	ListAPIKeys(ctx context.Context, userId uint) ([]APIKey, error)
+	// RevokeAPIKey returns ErrNotFound if there is no such unrevoked key.
+	RevokeAPIKey(ctx context.Context, id uint) error
+	// TouchAPIKey records a use of the key. To save writes it only does so
+	// when the previous use was recorded before notBefore.
+	TouchAPIKey(ctx context.Context, id uint, ip string, now time.Time, notBefore time.Time) error
+}
+
+// SigningKeyStore holds the keys access tokens are signed with, so that every
+// instance of the API signs with the same keys and rotates them together.
+type SigningKeyStore interface {
+	// ListSigningKeys returns the keys that have not expired at now, in the
+	// order they become active.
+	ListSigningKeys(ctx context.Context, now time.Time) ([]SigningKey, error)
+	// AddSigningKey saves key and sets every key that has no expiry yet to
+	// expire retireAfter after key becomes active. Keys that would become
+	// active after key expire when it does. It returns ErrConflict if
+	// the newest existing key is not previousKID (empty when there are no
+	// keys), which means another instance rotated first.
+	AddSigningKey(ctx context.Context, key *SigningKey, previousKID string, retireAfter time.Duration) error
+	PurgeExpiredSigningKeys(ctx context.Context, now time.Time) error
+}
+
+// ImpersonationStore keeps the audit trail of admins impersonating users.
+type ImpersonationStore interface {
+	CreateImpersonation(ctx context.Context, impersonation *Impersonation) error
+	GetImpersonation(ctx context.Context, id uint) (*Impersonation, error)
+	// ListImpersonations returns the most recent impersonations of the user,
+	// or of any user when userId is 0, newest first.
+	ListImpersonations(ctx context.Context, userId uint, limit int) ([]Impersonation, error)
+	// EndImpersonation returns ErrNotFound if there is no such impersonation
+	// that has not ended yet.
+	EndImpersonation(ctx context.Context, id uint, now time.Time) error
+	RecordImpersonationAction(ctx context.Context, action *ImpersonationAction) error
+	// ListImpersonationActions returns the requests made during an
+	// impersonation in the order they were made.
+	ListImpersonationActions(ctx context.Context, impersonationId uint) ([]ImpersonationAction, error)
+}
+
+// Store groups the individual stores handed to the HTTP handlers.
+type Store struct {
+	Users          UserStore
+	Students       StudentStore
+	Teachers       TeacherStore
+	Attendance     AttendanceStore
+	Corrections    CorrectionStore
+	Courses        CourseStore
+	Timetable      TimetableStore
+	Calendar       CalendarStore
+	Claims         ClaimStore
+	Tokens         TokenStore
+	Logins         LoginStore
+	MFA            MFAStore
+	Roles          RoleStore
+	Invitations    InvitationStore
+	APIKeys        APIKeyStore
+	Keys           SigningKeyStore
+	Impersonations ImpersonationStore
+}
@@ -2,86 +2,138 @@ package main
 
 import (
 	"encoding/json"
+	"math"
 	"net/http"
 
-	"gorm.io/gorm"
-	// ... other imports
+	"api/store"
 )
 
-type Student struct {
-	gorm.Model                          // Includes fields ID, CreatedAt, UpdatedAt, DeletedAt
-	Username             string         // Foreign key for the User
-	Name                 string         // Student's full name
-	Class                string         // Class or course the student is enrolled in
-	RegisterNumber       string         // Unique registration number for the student
-	Email                string         // Student's email address
-	Phone                string         // Student's phone number
-	AttendancePercentage float64        // Student's attendance percentage
-	Attendance           []Attendance   `gorm:"foreignKey:StudentId"`
-	MedicalClaims        []MedicalClaim `gorm:"foreignKey:StudentId"`
-}
-
-func createStudentInfo(w http.ResponseWriter, r *http.Request) {
-	// Extract the username from JWT claims
-	username, err := getUsernameFromJWT(r)
-	if err != nil {
-		http.Error(w, "Failed to get username from JWT", http.StatusInternalServerError)
-		return
-	}
+func (s *server) createStudentInfo(w http.ResponseWriter, r *http.Request) {
+	p := principalFrom(r.Context())
 
 	// Decode the request body into a Student struct
-	var student Student
-	err = json.NewDecoder(r.Body).Decode(&student)
+	var student store.Student
+	err := json.NewDecoder(r.Body).Decode(&student)
 	if err != nil {
 		http.Error(w, "Failed to decode request body", http.StatusBadRequest)
 		return
 	}
 
-	// Connect to the database
-	db, sqlDB, err := connectDB()
-	if err != nil {
-		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
-		return
-	}
-	defer sqlDB.Close()
-
 	// Find the student and preload the attendance records
-	result := db.Preload("Attendance").Where("username = ?", username).First(&student)
-	if result.Error != nil {
-		http.Error(w, result.Error.Error(), http.StatusNotFound)
+	found, err := s.store.Students.GetStudentByUsername(r.Context(), p.Username)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
+	student = *found
 
 	// Respond with the student info
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(student)
 }
 
-func getStudentInfo(w http.ResponseWriter, r *http.Request) {
-	// Extract the username from JWT claims
-	username, err := getUsernameFromJWT(r)
+func (s *server) getStudentInfo(w http.ResponseWriter, r *http.Request) {
+	p := principalFrom(r.Context())
+
+	// Fetch student info along with the attendance records
+	student, err := s.store.Students.GetStudentByUsername(r.Context(), p.Username)
 	if err != nil {
-		http.Error(w, "Failed to get username from JWT", http.StatusInternalServerError)
+		http.Error(w, "Student not found", http.StatusNotFound)
 		return
 	}
 
-	// Connect to the database
-	db, sqlDB, err := connectDB()
+	// With ?term= the percentages only count the classes of that term
+	term, ok := s.queryTerm(w, r)
+	if !ok {
+		return
+	}
+	var summaries []store.AttendanceSummary
+	var termResponse *termBody
+	if term != nil {
+		summaries, err = s.store.Attendance.SummarizeAttendance(r.Context(), store.AttendanceFilter{
+			StudentID: student.ID,
+			From:      term.StartDate,
+			To:        term.EndDate,
+		})
+		body := newTermBody(*term)
+		termResponse = &body
+	} else {
+		summaries, err = s.store.Attendance.ListAttendanceSummaries(r.Context(), student.ID)
+	}
 	if err != nil {
-		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	defer sqlDB.Close()
 
-	// Fetch student info from the database and preload the attendance records
-	var student Student
-	result := db.Preload("Attendance").Where("username = ?", username).First(&student)
-	if result.Error != nil {
-		http.Error(w, "Student not found", http.StatusNotFound)
-		return
+	// Summaries come per status, ordered by course
+	var courses []courseAttendance
+	total := courseAttendance{Statuses: map[string]int{}}
+	for _, summary := range summaries {
+		if len(courses) == 0 || courses[len(courses)-1].CourseID != summary.CourseID {
+			courses = append(courses, courseAttendance{
+				CourseID:   summary.CourseID,
+				CourseCode: summary.Course.Code,
+				CourseName: summary.Course.Name,
+				Statuses:   map[string]int{},
+			})
+		}
+		courses[len(courses)-1].add(summary)
+		total.add(summary)
+	}
+	for i := range courses {
+		courses[i].Percentage = s.attendancePercentage(courses[i])
 	}
 
-	// Return student info as JSON
+	// Return student info as JSON, with their attendance percentages. Like
+	// the student, the fields are named as in Go.
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(student)
+	json.NewEncoder(w).Encode(struct {
+		*store.Student
+		Term                 *termBody
+		AttendancePercentage *float64
+		CourseAttendance     []courseAttendance
+	}{student, termResponse, s.attendancePercentage(total), courses})
+}
+
+// courseAttendance is a student's attendance in one course.
+type courseAttendance struct {
+	CourseID   uint
+	CourseCode string
+	CourseName string
+	Classes    int
+	Statuses   map[string]int // Classes by status
+	Claimed    int
+	Percentage *float64
+}
+
+func (c *courseAttendance) add(summary store.AttendanceSummary) {
+	c.Classes += summary.Classes
+	c.Statuses[summary.Status] += summary.Classes
+	c.Claimed += summary.Claimed
+}
+
+// attendancePercentage is the weighted share of classes attended, to two
+// decimals. Each status counts with its weight in cfg.StatusWeights, except
+// absences under approved claims, which count as cfg.ApprovedClaims says.
+// It is nil when no classes count.
+func (s *server) attendancePercentage(c courseAttendance) *float64 {
+	weights := s.cfg.StatusWeights
+	classes := float64(c.Classes)
+	var attended float64
+	for status, n := range c.Statuses {
+		attended += weights[status] * float64(n)
+	}
+	claimed := float64(c.Claimed)
+	switch s.cfg.ApprovedClaims {
+	case "present":
+		attended += claimed * (weights[store.AttendancePresent] - weights[store.AttendanceAbsent])
+	case "excluded":
+		attended -= claimed * weights[store.AttendanceAbsent]
+		classes -= claimed
+	}
+	if classes == 0 {
+		return nil
+	}
+	percentage := math.Round(10000*attended/classes) / 100
+	return &percentage
 }
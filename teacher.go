@@ -3,77 +3,48 @@ package main
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
 
-	"gorm.io/gorm"
+	"api/store"
 )
 
-type Teacher struct {
-	gorm.Model
-	Username string
-	Name     string
-	Claim    []ClaimReview `gorm:"foreignKey:TeacherId"`
-}
-
-func createTeacherHandler(w http.ResponseWriter, r *http.Request) {
-	teacher := &Teacher{}
+func (s *server) createTeacherHandler(w http.ResponseWriter, r *http.Request) {
+	teacher := &store.Teacher{}
 	err := json.NewDecoder(r.Body).Decode(teacher)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	db, sqlDB, err := connectDB()
+	err = s.store.Teachers.CreateTeacher(r.Context(), teacher)
 	if err != nil {
-		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
-		return
-	}
-	defer sqlDB.Close()
-
-	result := db.Create(teacher)
-	if result.Error != nil {
-		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 }
 
-func getTeacherByIdHandler(w http.ResponseWriter, r *http.Request) {
-	teacherId := r.URL.Query().Get("id")
-
-	db, sqlDB, err := connectDB()
+func (s *server) getTeacherByIdHandler(w http.ResponseWriter, r *http.Request) {
+	teacherId, err := strconv.Atoi(r.URL.Query().Get("id"))
 	if err != nil {
-		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
 		return
 	}
-	defer sqlDB.Close()
 
-	var teacher Teacher
-	result := db.Preload("Claims").First(&teacher, teacherId)
-	if result.Error != nil {
-		http.Error(w, result.Error.Error(), http.StatusNotFound)
+	teacher, err := s.store.Teachers.GetTeacher(r.Context(), uint(teacherId))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
 
 	json.NewEncoder(w).Encode(teacher)
 }
 
-func getTeacherByTokenHandler(w http.ResponseWriter, r *http.Request) {
-	username, err := getUsernameFromJWT(r)
-	if err != nil {
-		http.Error(w, "Failed to get username from JWT", http.StatusInternalServerError)
-		return
-	}
+func (s *server) getTeacherByTokenHandler(w http.ResponseWriter, r *http.Request) {
+	p := principalFrom(r.Context())
 
-	db, sqlDB, err := connectDB()
+	teacher, err := s.store.Teachers.GetTeacher(r.Context(), p.TeacherID)
 	if err != nil {
-		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
-		return
-	}
-	defer sqlDB.Close()
-
-	var teacher Teacher
-	result := db.Where("username = ?", username).First(&teacher)
-	if result.Error != nil {
-		http.Error(w, result.Error.Error(), http.StatusNotFound)
+		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
 
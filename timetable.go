@@ -0,0 +1,443 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"api/store"
+)
+
+type periodBody struct {
+	ID        uint   `json:"id"`
+	Weekday   string `json:"weekday"`
+	Name      string `json:"name"`
+	StartTime string `json:"start_time"`
+	EndTime   string `json:"end_time"`
+}
+
+func newPeriodBody(period store.Period) periodBody {
+	return periodBody{
+		ID:        period.ID,
+		Weekday:   weekdayName(period.Weekday),
+		Name:      period.Name,
+		StartTime: period.StartTime,
+		EndTime:   period.EndTime,
+	}
+}
+
+// classBody is a class in a timetable.
+type classBody struct {
+	SlotID     uint   `json:"slot_id"`
+	Weekday    string `json:"weekday"`
+	Period     string `json:"period"`
+	StartTime  string `json:"start_time"`
+	EndTime    string `json:"end_time"`
+	SectionID  uint   `json:"section_id"`
+	Section    string `json:"section"`
+	Term       string `json:"term"`
+	CourseID   uint   `json:"course_id"`
+	CourseCode string `json:"course_code"`
+	CourseName string `json:"course_name"`
+	TeacherID  *uint  `json:"teacher_id"`
+}
+
+func newClassBody(class store.ScheduledClass) classBody {
+	return classBody{
+		SlotID:     class.Slot.ID,
+		Weekday:    weekdayName(class.Period.Weekday),
+		Period:     class.Period.Name,
+		StartTime:  class.Period.StartTime,
+		EndTime:    class.Period.EndTime,
+		SectionID:  class.Section.ID,
+		Section:    class.Section.Name,
+		Term:       class.Section.Term,
+		CourseID:   class.Course.ID,
+		CourseCode: class.Course.Code,
+		CourseName: class.Course.Name,
+		TeacherID:  class.TeacherID,
+	}
+}
+
+func weekdayName(weekday time.Weekday) string {
+	return strings.ToLower(weekday.String())
+}
+
+// parseWeekday parses an English weekday name such as "monday".
+func parseWeekday(name string) (time.Weekday, error) {
+	for weekday := time.Sunday; weekday <= time.Saturday; weekday++ {
+		if strings.EqualFold(name, weekday.String()) {
+			return weekday, nil
+		}
+	}
+	return 0, fmt.Errorf("%q is not a weekday", name)
+}
+
+// validClockTime reports whether value is a time of day as HH:MM.
+func validClockTime(value string) bool {
+	t, err := time.Parse("15:04", value)
+	return err == nil && t.Format("15:04") == value
+}
+
+// scheduledClasses returns the classes matching filter that take place in
+// period on date. It returns a *closedDayError if the academic calendar has
+// no classes on date.
+func (s *server) scheduledClasses(ctx context.Context, filter store.ClassFilter, date store.Date, period string) ([]store.ScheduledClass, error) {
+	weekday, err := s.calendarWeekday(ctx, date)
+	if err != nil {
+		return nil, err
+	}
+	filter.Weekday = &weekday
+	filter.PeriodName = period
+	return s.store.Timetable.ListClasses(ctx, filter)
+}
+
+func (s *server) listPeriodsHandler(w http.ResponseWriter, r *http.Request) {
+	periods, err := s.store.Timetable.ListPeriods(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]periodBody, len(periods))
+	for i, period := range periods {
+		response[i] = newPeriodBody(period)
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *server) createPeriodHandler(w http.ResponseWriter, r *http.Request) {
+	var body periodBody
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	weekday, err := parseWeekday(body.Weekday)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	period := store.Period{
+		Weekday:   weekday,
+		Name:      body.Name,
+		StartTime: body.StartTime,
+		EndTime:   body.EndTime,
+	}
+	if !s.validPeriod(w, r, &period) {
+		return
+	}
+
+	err = s.store.Timetable.CreatePeriod(r.Context(), &period)
+	if errors.Is(err, store.ErrDuplicate) {
+		http.Error(w, "The weekday already has a period of that name", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newPeriodBody(period))
+}
+
+// updatePeriodHandler renames or moves a period within its weekday. The
+// weekday cannot change, since the classes scheduled in the period would
+// move with it.
+func (s *server) updatePeriodHandler(w http.ResponseWriter, r *http.Request) {
+	periodId, err := pathID(r, "periodid")
+	if err != nil {
+		http.Error(w, "Invalid period ID", http.StatusBadRequest)
+		return
+	}
+	period, err := s.store.Timetable.GetPeriod(r.Context(), periodId)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Period not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var body struct {
+		Name      *string `json:"name"`
+		StartTime *string `json:"start_time"`
+		EndTime   *string `json:"end_time"`
+	}
+	err = json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if body.Name != nil {
+		period.Name = *body.Name
+	}
+	if body.StartTime != nil {
+		period.StartTime = *body.StartTime
+	}
+	if body.EndTime != nil {
+		period.EndTime = *body.EndTime
+	}
+	if !s.validPeriod(w, r, period) {
+		return
+	}
+
+	err = s.store.Timetable.UpdatePeriod(r.Context(), period)
+	if errors.Is(err, store.ErrDuplicate) {
+		http.Error(w, "The weekday already has a period of that name", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(newPeriodBody(*period))
+}
+
+// validPeriod checks the name and times of a period and that it does not
+// overlap another period of its weekday, answering 400 or 409 itself.
+func (s *server) validPeriod(w http.ResponseWriter, r *http.Request, period *store.Period) bool {
+	if period.Name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return false
+	}
+	if !validClockTime(period.StartTime) || !validClockTime(period.EndTime) {
+		http.Error(w, "start_time and end_time must be HH:MM", http.StatusBadRequest)
+		return false
+	}
+	if period.StartTime >= period.EndTime {
+		http.Error(w, "start_time must be before end_time", http.StatusBadRequest)
+		return false
+	}
+
+	periods, err := s.store.Timetable.ListPeriods(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	for _, other := range periods {
+		if other.ID != period.ID && other.Weekday == period.Weekday &&
+			other.StartTime < period.EndTime && period.StartTime < other.EndTime {
+			http.Error(w, "The period overlaps period "+other.Name, http.StatusConflict)
+			return false
+		}
+	}
+	return true
+}
+
+func (s *server) deletePeriodHandler(w http.ResponseWriter, r *http.Request) {
+	periodId, err := pathID(r, "periodid")
+	if err != nil {
+		http.Error(w, "Invalid period ID", http.StatusBadRequest)
+		return
+	}
+
+	err = s.store.Timetable.DeletePeriod(r.Context(), periodId)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Period not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, store.ErrConflict) {
+		http.Error(w, "Classes are scheduled in the period", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *server) sectionTimetableHandler(w http.ResponseWriter, r *http.Request) {
+	section, ok := s.pathSection(w, r)
+	if !ok {
+		return
+	}
+	s.writeTimetable(w, r, store.ClassFilter{SectionID: section.ID})
+}
+
+// createSlotHandler schedules a section in a period. The class is taught by
+// teacher_id, or by the section's teacher when it is omitted.
+func (s *server) createSlotHandler(w http.ResponseWriter, r *http.Request) {
+	section, ok := s.pathSection(w, r)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		PeriodID  uint  `json:"period_id"`
+		TeacherID *uint `json:"teacher_id"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	period, err := s.store.Timetable.GetPeriod(r.Context(), body.PeriodID)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Period not found", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if body.TeacherID != nil && !s.teacherExists(w, r, *body.TeacherID) {
+		return
+	}
+
+	// A teacher cannot teach two classes at once
+	teacherId := section.TeacherID
+	if body.TeacherID != nil {
+		teacherId = body.TeacherID
+	}
+	if teacherId != nil {
+		busy, err := s.store.Timetable.ListClasses(r.Context(), store.ClassFilter{
+			TeacherID:  *teacherId,
+			Weekday:    &period.Weekday,
+			PeriodName: period.Name,
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, class := range busy {
+			if class.Section.ID != section.ID {
+				http.Error(w, "The teacher already teaches another class in the period", http.StatusConflict)
+				return
+			}
+		}
+	}
+
+	slot := store.TimetableSlot{SectionID: section.ID, PeriodID: period.ID, TeacherID: body.TeacherID}
+	err = s.store.Timetable.CreateSlot(r.Context(), &slot)
+	if errors.Is(err, store.ErrDuplicate) {
+		http.Error(w, "The section is already scheduled in the period", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	course, err := s.store.Courses.GetCourse(r.Context(), section.CourseID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	class := store.ScheduledClass{Slot: slot, Period: *period, Section: *section, Course: *course, TeacherID: teacherId}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newClassBody(class))
+}
+
+func (s *server) deleteSlotHandler(w http.ResponseWriter, r *http.Request) {
+	sectionId, err := pathID(r, "sectionid")
+	if err != nil {
+		http.Error(w, "Invalid section ID", http.StatusBadRequest)
+		return
+	}
+	slotId, err := pathID(r, "slotid")
+	if err != nil {
+		http.Error(w, "Invalid slot ID", http.StatusBadRequest)
+		return
+	}
+
+	err = s.store.Timetable.DeleteSlot(r.Context(), sectionId, slotId)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Timetable slot not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getStudentTimetable returns the caller's own timetable.
+func (s *server) getStudentTimetable(w http.ResponseWriter, r *http.Request) {
+	p := principalFrom(r.Context())
+	if p.StudentID == 0 {
+		http.Error(w, "Student not found", http.StatusNotFound)
+		return
+	}
+	s.writeTimetable(w, r, store.ClassFilter{StudentID: p.StudentID})
+}
+
+func (s *server) getTeacherTimetable(w http.ResponseWriter, r *http.Request) {
+	p := principalFrom(r.Context())
+	if p.TeacherID == 0 {
+		http.Error(w, "Teacher not found", http.StatusNotFound)
+		return
+	}
+	s.writeTimetable(w, r, store.ClassFilter{TeacherID: p.TeacherID})
+}
+
+// studentTimetableHandler answers what classes the student in the path has.
+func (s *server) studentTimetableHandler(w http.ResponseWriter, r *http.Request) {
+	studentId, err := pathID(r, "studentid")
+	if err != nil {
+		http.Error(w, "Invalid student ID", http.StatusBadRequest)
+		return
+	}
+	if _, err := s.store.Students.GetStudent(r.Context(), studentId); errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Student not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.writeTimetable(w, r, store.ClassFilter{StudentID: studentId})
+}
+
+// writeTimetable writes the weekly timetable of the classes matching filter.
+// With ?date= it only has the classes on that day, following the academic
+// calendar, and with ?period= as well only those in that period.
+func (s *server) writeTimetable(w http.ResponseWriter, r *http.Request, filter store.ClassFilter) {
+	date, period := r.URL.Query().Get("date"), r.URL.Query().Get("period")
+	if period != "" && date == "" {
+		http.Error(w, "period needs a date", http.StatusBadRequest)
+		return
+	}
+
+	var day store.Date
+	var err error
+	if date != "" {
+		if day, err = store.ParseDate(date); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var classes []store.ScheduledClass
+	var closed *closedDayError
+	if !day.IsZero() {
+		classes, err = s.scheduledClasses(r.Context(), filter, day, period)
+	} else {
+		classes, err = s.store.Timetable.ListClasses(r.Context(), filter)
+	}
+	if errors.As(err, &closed) {
+		err = nil // No classes that day
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]classBody, len(classes))
+	for i, class := range classes {
+		response[i] = newClassBody(class)
+	}
+	json.NewEncoder(w).Encode(response)
+}
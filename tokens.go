@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+
+	"api/store"
+)
+
+// errTokenRevoked is returned for access tokens that were logged out or
+// belong to a disabled account.
+var errTokenRevoked = errors.New("token has been revoked")
+
+// tokenResponse is returned by /login and /token/refresh.
+type tokenResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"` // Access token lifetime in seconds
+}
+
+// newOpaqueToken returns a random URL-safe token for refresh tokens and
+// other secrets that are only stored hashed.
+func newOpaqueToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken returns the hex SHA-256 digest under which a token is stored.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueTokens signs a new access token for user and stores a refresh token.
+// An empty familyId starts a new session.
+func (s *server) issueTokens(ctx context.Context, user *store.User, familyId string) (*tokenResponse, error) {
+	if familyId == "" {
+		var err error
+		if familyId, err = newOpaqueToken(); err != nil {
+			return nil, err
+		}
+	}
+
+	refreshToken, err := newOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	err = s.store.Tokens.CreateRefreshToken(ctx, &store.RefreshToken{
+		UserID:    user.ID,
+		FamilyID:  familyId,
+		TokenHash: hashToken(refreshToken),
+		ExpiresAt: time.Now().Add(s.cfg.RefreshTokenTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := s.signAccessToken(ctx, user, familyId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tokenResponse{
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(s.cfg.AccessTokenTTL / time.Second),
+	}, nil
+}
+
+func (s *server) signAccessToken(ctx context.Context, user *store.User, sessionId string) (string, error) {
+	jti, err := newOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims := &CustomClaims{
+		Username:  user.Username,
+		UserType:  user.UserType,
+		SessionID: sessionId,
+		StandardClaims: jwt.StandardClaims{
+			Id:        jti,
+			Subject:   strconv.FormatUint(uint64(user.ID), 10),
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(s.cfg.AccessTokenTTL).Unix(),
+			Issuer:    s.cfg.JWTIssuer,
+		},
+	}
+
+	return s.signJWT(ctx, claims)
+}
+
+// verifyAccessToken checks the signature and expiry of tokenString, then
+// makes sure it has not been revoked and its account is still enabled.
+func (s *server) verifyAccessToken(ctx context.Context, tokenString string) (*CustomClaims, *store.User, error) {
+	claims := &CustomClaims{}
+	if err := s.parseJWT(ctx, tokenString, claims); err != nil {
+		return nil, nil, err
+	}
+
+	// Tokens with an audience, such as MFA challenges, are not access tokens
+	if claims.Audience != "" {
+		return nil, nil, errors.New("not an access token")
+	}
+
+	revoked, err := s.store.Tokens.IsAccessTokenRevoked(ctx, claims.Id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if revoked {
+		return nil, nil, errTokenRevoked
+	}
+
+	userId, err := strconv.ParseUint(claims.Subject, 10, 64)
+	if err != nil {
+		return nil, nil, errors.New("invalid token subject")
+	}
+	user, err := s.store.Users.GetUser(ctx, uint(userId))
+	if err != nil {
+		return nil, nil, err
+	}
+	if user.Disabled {
+		return nil, nil, errTokenRevoked
+	}
+	// iat is in whole seconds, so tokens issued in the second of the cutoff,
+	// such as those of a login right after it, are still accepted
+	if user.TokensNotBefore != nil && claims.IssuedAt < user.TokensNotBefore.Truncate(time.Second).Unix() {
+		return nil, nil, errTokenRevoked
+	}
+
+	return claims, user, nil
+}
+
+// parseJWT checks the signature and expiry of a token signed by this server
+// and decodes it into claims. The token's kid picks the verification key.
+func (s *server) parseJWT(ctx context.Context, tokenString string, claims jwt.Claims) error {
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, err := s.keys.verifier(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return key.private.Public(), nil
+	})
+	if err != nil {
+		return err
+	}
+	if !token.Valid {
+		return errors.New("invalid token")
+	}
+	return nil
+}
+
+// bearerToken returns the token from the request's Authorization header.
+func bearerToken(r *http.Request) (string, bool) {
+	authHeader := r.Header.Get("Authorization")
+	tokenString, ok := strings.CutPrefix(authHeader, "Bearer ")
+	return tokenString, ok && tokenString != ""
+}
+
+func (s *server) refreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil || body.RefreshToken == "" {
+		http.Error(w, "refresh_token is required", http.StatusBadRequest)
+		return
+	}
+
+	current, err := s.store.Tokens.GetRefreshToken(r.Context(), hashToken(body.RefreshToken))
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// A revoked token being presented again means it was stolen or replayed,
+	// so the whole session is killed.
+	if current.RevokedAt != nil {
+		if current.ReplacedBy != nil {
+			log.Printf("Refresh token reuse detected for user %d; revoking session", current.UserID)
+			s.store.Tokens.RevokeRefreshFamily(r.Context(), current.FamilyID)
+		}
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+	if time.Now().After(current.ExpiresAt) {
+		http.Error(w, "Refresh token expired", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := s.store.Users.GetUser(r.Context(), current.UserID)
+	if err != nil || user.Disabled {
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	refreshToken, err := newOpaqueToken()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	next := &store.RefreshToken{
+		UserID:    user.ID,
+		FamilyID:  current.FamilyID,
+		TokenHash: hashToken(refreshToken),
+		ExpiresAt: time.Now().Add(s.cfg.RefreshTokenTTL),
+	}
+	err = s.store.Tokens.RotateRefreshToken(r.Context(), current, next)
+	if errors.Is(err, store.ErrConflict) {
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	accessToken, err := s.signAccessToken(r.Context(), user, current.FamilyID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(tokenResponse{
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(s.cfg.AccessTokenTTL / time.Second),
+	})
+}
+
+func (s *server) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	p := principalFrom(r.Context())
+
+	// Kill the access token and every refresh token of its session
+	err := s.store.Tokens.RevokeAccessToken(r.Context(), p.TokenID, p.ExpiresAt)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if p.SessionID != "" {
+		err = s.store.Tokens.RevokeRefreshFamily(r.Context(), p.SessionID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// purgeExpiredTokens periodically removes tokens that can no longer be used.
+func (s *server) purgeExpiredTokens(interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := s.store.Tokens.PurgeExpiredTokens(context.Background(), time.Now()); err != nil {
+			log.Printf("Failed to purge expired tokens: %v", err)
+		}
+	}
+}
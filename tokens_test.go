@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestRefreshTokenRotation(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ts.createUser("alice", "student")
+	tokens := ts.login("alice")
+
+	var rotated tokenResponse
+	ts.request("POST", "/token/refresh", "", map[string]string{"refresh_token": tokens.RefreshToken}, http.StatusOK, &rotated)
+	if rotated.RefreshToken == "" || rotated.RefreshToken == tokens.RefreshToken {
+		t.Fatalf("refresh token was not rotated: %q", rotated.RefreshToken)
+	}
+	ts.request("GET", "/student/info", rotated.Token, nil, http.StatusOK, nil)
+
+	var next tokenResponse
+	ts.request("POST", "/token/refresh", "", map[string]string{"refresh_token": rotated.RefreshToken}, http.StatusOK, &next)
+}
+
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ts.createUser("alice", "student")
+	tokens := ts.login("alice")
+	other := ts.login("alice")
+
+	var rotated tokenResponse
+	ts.request("POST", "/token/refresh", "", map[string]string{"refresh_token": tokens.RefreshToken}, http.StatusOK, &rotated)
+
+	// Presenting the replaced token again kills every token of the session
+	ts.request("POST", "/token/refresh", "", map[string]string{"refresh_token": tokens.RefreshToken}, http.StatusUnauthorized, nil)
+	ts.request("POST", "/token/refresh", "", map[string]string{"refresh_token": rotated.RefreshToken}, http.StatusUnauthorized, nil)
+
+	// Other sessions are left alone
+	ts.request("POST", "/token/refresh", "", map[string]string{"refresh_token": other.RefreshToken}, http.StatusOK, nil)
+}
+
+func TestRefreshTokenInvalid(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ts.request("POST", "/token/refresh", "", map[string]string{"refresh_token": "nope"}, http.StatusUnauthorized, nil)
+	ts.request("POST", "/token/refresh", "", map[string]string{}, http.StatusBadRequest, nil)
+}
+
+func TestLogoutRevokesSession(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ts.createUser("alice", "student")
+	tokens := ts.login("alice")
+
+	ts.request("POST", "/logout", tokens.Token, nil, http.StatusNoContent, nil)
+	ts.request("GET", "/student/info", tokens.Token, nil, http.StatusUnauthorized, nil)
+	ts.request("POST", "/token/refresh", "", map[string]string{"refresh_token": tokens.RefreshToken}, http.StatusUnauthorized, nil)
+}
+
+func TestTokensNotBefore(t *testing.T) {
+	ts := newTestServer(t, nil)
+	alice := ts.createUser("alice", "student")
+	before := ts.login("alice")
+
+	// Tokens carry whole seconds, so only those of an earlier second can be
+	// told apart from the cutoff
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+	if err := ts.store.Users.SetPassword(context.Background(), alice.ID, alice.Password); err != nil {
+		t.Fatal(err)
+	}
+	ts.request("GET", "/student/info", before.Token, nil, http.StatusUnauthorized, nil)
+
+	// A login in the same second as the cutoff still works
+	after := ts.login("alice")
+	ts.request("GET", "/student/info", after.Token, nil, http.StatusOK, nil)
+}
+
+func TestChangePasswordEndsOtherSessions(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ts.createUser("alice", "student")
+	current := ts.login("alice")
+	other := ts.login("alice")
+
+	var tokens tokenResponse
+	body := map[string]string{"current_password": testPassword, "new_password": "a different passphrase"}
+	ts.request("POST", "/password/change", current.Token, body, http.StatusOK, &tokens)
+
+	ts.request("GET", "/student/info", current.Token, nil, http.StatusUnauthorized, nil)
+	ts.request("POST", "/token/refresh", "", map[string]string{"refresh_token": other.RefreshToken}, http.StatusUnauthorized, nil)
+	ts.request("GET", "/student/info", tokens.Token, nil, http.StatusOK, nil)
+	ts.request("POST", "/login", "", map[string]string{"username": "alice", "password": testPassword}, http.StatusUnauthorized, nil)
+}
+
+func TestResetPasswordEndsSessions(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ts.createUser("alice", "student")
+	tokens := ts.login("alice")
+
+	ts.request("POST", "/password/forgot", "", map[string]string{"username": "alice"}, http.StatusAccepted, nil)
+	sent := ts.notification()
+	match := regexp.MustCompile(`token=(\S+)`).FindStringSubmatch(sent.Body)
+	if sent.To != "alice@example.edu" || match == nil {
+		t.Fatalf("unexpected reset notification %+v", sent)
+	}
+
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+	body := map[string]string{"token": match[1], "password": "a different passphrase"}
+	ts.request("POST", "/password/reset", "", body, http.StatusNoContent, nil)
+
+	ts.request("GET", "/student/info", tokens.Token, nil, http.StatusUnauthorized, nil)
+	ts.request("POST", "/token/refresh", "", map[string]string{"refresh_token": tokens.RefreshToken}, http.StatusUnauthorized, nil)
+
+	// The link only works once
+	ts.request("POST", "/password/reset", "", body, http.StatusBadRequest, nil)
+}
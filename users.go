@@ -0,0 +1,449 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"api/store"
+)
+
+// userBody is how users are written to the admin API. Profiles are only
+// filled in for a single user.
+type userBody struct {
+	ID            uint          `json:"id"`
+	Username      string        `json:"username"`
+	Email         string        `json:"email"`
+	EmailVerified bool          `json:"email_verified"`
+	UserType      string        `json:"user_type"`
+	Disabled      bool          `json:"disabled"`
+	MFAEnabled    bool          `json:"mfa_enabled"`
+	LockedUntil   *time.Time    `json:"locked_until"`
+	CreatedAt     time.Time     `json:"created_at"`
+	Profiles      *profilesBody `json:"profiles,omitempty"`
+
+	// Only set when the user has no email to send a reset link to
+	ResetToken string `json:"reset_token,omitempty"`
+}
+
+// profilesBody holds the IDs of the profiles linked to a user, zero for none.
+type profilesBody struct {
+	StudentID uint `json:"student_id"`
+	TeacherID uint `json:"teacher_id"`
+	IPMID     uint `json:"ipm_id"`
+}
+
+func newUserBody(user store.User) userBody {
+	return userBody{
+		ID:            user.ID,
+		Username:      user.Username,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		UserType:      user.UserType,
+		Disabled:      user.Disabled,
+		MFAEnabled:    user.TOTPEnabled,
+		LockedUntil:   user.LockedUntil,
+		CreatedAt:     user.CreatedAt,
+	}
+}
+
+// listUsersHandler returns a page of users. ?q= searches usernames and
+// emails, ?user_type= and ?disabled= filter, and ?page= and ?per_page= page.
+func (s *server) listUsersHandler(w http.ResponseWriter, r *http.Request) {
+	page, err := pageParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := store.UserFilter{
+		Search:   strings.TrimSpace(query.Get("q")),
+		UserType: query.Get("user_type"),
+		Offset:   page.offset(),
+		Limit:    page.PerPage,
+	}
+	if value := query.Get("disabled"); value != "" {
+		disabled, err := strconv.ParseBool(value)
+		if err != nil {
+			http.Error(w, "disabled must be true or false", http.StatusBadRequest)
+			return
+		}
+		filter.Disabled = &disabled
+	}
+
+	users, total, err := s.store.Users.ListUsers(r.Context(), filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := struct {
+		Users []userBody `json:"users"`
+		pagination
+	}{Users: make([]userBody, len(users)), pagination: page}
+	for i, user := range users {
+		response.Users[i] = newUserBody(user)
+	}
+	response.Total = total
+	json.NewEncoder(w).Encode(response)
+}
+
+// createUserHandler creates an account without a password. The user picks
+// one through the reset link they are sent, or, when they have no email,
+// through the reset token in the response.
+func (s *server) createUserHandler(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Username       string `json:"username"`
+		UserType       string `json:"user_type"`
+		Email          string `json:"email"`
+		Name           string `json:"name"`
+		RegisterNumber string `json:"register_number"` // Students only
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if body.Username == "" || body.UserType == "" {
+		http.Error(w, "username and user_type are required", http.StatusBadRequest)
+		return
+	}
+
+	role, err := s.store.Roles.GetRoleByName(r.Context(), body.UserType)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Role not found", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	account := &store.NewAccount{
+		User: &store.User{
+			Username: body.Username,
+			UserType: role.Name,
+			Email:    body.Email,
+		},
+		RoleID: role.ID,
+	}
+	switch role.Name {
+	case "student":
+		if body.RegisterNumber == "" {
+			http.Error(w, "register_number is required for students", http.StatusBadRequest)
+			return
+		}
+		_, err := s.store.Students.GetStudentByRegisterNumber(r.Context(), body.RegisterNumber)
+		if err == nil {
+			http.Error(w, "Register number is already registered", http.StatusConflict)
+			return
+		}
+		if !errors.Is(err, store.ErrNotFound) {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		account.Student = &store.Student{Name: body.Name, RegisterNumber: body.RegisterNumber, Email: body.Email}
+	case "teacher":
+		account.Teacher = &store.Teacher{Name: body.Name}
+	case "ipm":
+		account.IPM = &store.IPM{Name: body.Name}
+	}
+
+	err = s.store.Users.CreateAccount(r.Context(), account)
+	if errors.Is(err, store.ErrDuplicate) {
+		http.Error(w, "Username is already taken", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	token, err := s.sendPasswordReset(r.Context(), account.User,
+		"An account "+account.User.Username+" was created for you.", "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := newUserBody(*account.User)
+	if account.User.Email == "" {
+		response.ResetToken = token
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *server) getUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.pathUser(w, r)
+	if !ok {
+		return
+	}
+
+	profiles, err := s.store.Users.GetProfileIDs(r.Context(), user.Username)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := newUserBody(*user)
+	response.Profiles = &profilesBody{
+		StudentID: profiles.StudentID,
+		TeacherID: profiles.TeacherID,
+		IPMID:     profiles.IPMID,
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// updateUserHandler changes the email and user type of a user. Changing the
+// user type also swaps the role of the old type for that of the new one.
+func (s *server) updateUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.pathUser(w, r)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Email    *string `json:"email"`
+		UserType *string `json:"user_type"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if body.UserType != nil && *body.UserType != user.UserType {
+		if principalFrom(r.Context()).UserID == user.ID {
+			http.Error(w, "You cannot change your own user type", http.StatusForbidden)
+			return
+		}
+		newRole, err := s.store.Roles.GetRoleByName(r.Context(), *body.UserType)
+		if errors.Is(err, store.ErrNotFound) {
+			http.Error(w, "Role not found", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// Accounts whose type is not a role any more have no role to remove
+		var oldRoleId uint
+		if oldRole, err := s.store.Roles.GetRoleByName(r.Context(), user.UserType); err == nil {
+			oldRoleId = oldRole.ID
+		} else if !errors.Is(err, store.ErrNotFound) {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		err = s.store.Users.ChangeUserType(r.Context(), user.ID, newRole.Name, oldRoleId, newRole.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		user.UserType = newRole.Name
+	}
+
+	if body.Email != nil && *body.Email != user.Email {
+		if err := s.store.Users.SetEmail(r.Context(), user.ID, *body.Email); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		user.Email, user.EmailVerified = *body.Email, false
+	}
+
+	json.NewEncoder(w).Encode(newUserBody(*user))
+}
+
+// deleteUserHandler soft-deletes a user. Their profiles and the records
+// attached to them are kept, unlinked.
+func (s *server) deleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.pathUser(w, r)
+	if !ok {
+		return
+	}
+	if principalFrom(r.Context()).UserID == user.ID {
+		http.Error(w, "You cannot delete your own account", http.StatusForbidden)
+		return
+	}
+
+	if err := s.store.Users.DeleteUser(r.Context(), user.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// disableUserHandler stops a user from logging in and ends their sessions.
+// Their access tokens and API keys stop working at once.
+func (s *server) disableUserHandler(w http.ResponseWriter, r *http.Request) {
+	s.setUserDisabled(w, r, true)
+}
+
+func (s *server) enableUserHandler(w http.ResponseWriter, r *http.Request) {
+	s.setUserDisabled(w, r, false)
+}
+
+func (s *server) setUserDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	user, ok := s.pathUser(w, r)
+	if !ok {
+		return
+	}
+	if disabled && principalFrom(r.Context()).UserID == user.ID {
+		http.Error(w, "You cannot disable your own account", http.StatusForbidden)
+		return
+	}
+
+	if err := s.store.Users.SetDisabled(r.Context(), user.ID, disabled); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	user.Disabled = disabled
+	json.NewEncoder(w).Encode(newUserBody(*user))
+}
+
+// forcePasswordResetHandler clears a user's password and logs them out
+// everywhere. They are sent a reset link, or, without an email, the reset
+// token is returned for the admin to pass on.
+func (s *server) forcePasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.pathUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.store.Users.ForcePasswordReset(r.Context(), user.ID, time.Now()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	token, err := s.sendPasswordReset(r.Context(), user,
+		"An administrator reset the password of your account "+user.Username+".", "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]string{"message": "Password reset link sent to the user's email"}
+	if user.Email == "" {
+		response = map[string]string{"message": "The user has no email; pass the reset token on", "reset_token": token}
+	}
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(response)
+}
+
+// linkProfileHandler links an unlinked Student, Teacher or IPM profile to a
+// user. The user must not already have a profile of that kind.
+func (s *server) linkProfileHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.pathUser(w, r)
+	if !ok {
+		return
+	}
+	kind, ok := pathProfileKind(w, r)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		ID uint `json:"id"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil || body.ID == 0 {
+		http.Error(w, "id is required", http.StatusBadRequest)
+		return
+	}
+
+	profiles, err := s.store.Users.GetProfileIDs(r.Context(), user.Username)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	linked := map[store.ProfileKind]uint{
+		store.ProfileStudent: profiles.StudentID,
+		store.ProfileTeacher: profiles.TeacherID,
+		store.ProfileIPM:     profiles.IPMID,
+	}[kind]
+	if linked == body.ID {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if linked != 0 {
+		http.Error(w, "The user already has a profile of this kind; unlink it first", http.StatusConflict)
+		return
+	}
+
+	err = s.store.Users.LinkProfile(r.Context(), kind, body.ID, user.Username)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Profile not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, store.ErrConflict) {
+		http.Error(w, "The profile is linked to another user", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// unlinkProfileHandler unlinks the user's profile of a kind. The profile and
+// its records are kept.
+func (s *server) unlinkProfileHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.pathUser(w, r)
+	if !ok {
+		return
+	}
+	kind, ok := pathProfileKind(w, r)
+	if !ok {
+		return
+	}
+
+	err := s.store.Users.UnlinkProfile(r.Context(), kind, user.Username)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "The user has no profile of this kind", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// pathUser loads the user named by {userid}, answering 400 or 404 itself
+// when it cannot.
+func (s *server) pathUser(w http.ResponseWriter, r *http.Request) (*store.User, bool) {
+	userId, err := pathID(r, "userid")
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return nil, false
+	}
+	user, err := s.store.Users.GetUser(r.Context(), userId)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	return user, true
+}
+
+// pathProfileKind parses the {kind} route variable.
+func pathProfileKind(w http.ResponseWriter, r *http.Request) (store.ProfileKind, bool) {
+	kind := store.ProfileKind(mux.Vars(r)["kind"])
+	switch kind {
+	case store.ProfileStudent, store.ProfileTeacher, store.ProfileIPM:
+		return kind, true
+	}
+	http.Error(w, "Profile kind must be student, teacher or ipm", http.StatusBadRequest)
+	return "", false
+}
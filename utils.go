@@ -1,8 +1,13 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
 )
 
 func loggingMiddleware(next http.Handler) http.Handler {
@@ -14,3 +19,47 @@ func loggingMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// pathID parses the numeric route variable name, e.g. {userid}.
+func pathID(r *http.Request, name string) (uint, error) {
+	id, err := strconv.ParseUint(mux.Vars(r)[name], 10, 64)
+	return uint(id), err
+}
+
+const (
+	defaultPerPage = 50
+	maxPerPage     = 200
+)
+
+// pagination is a page of a list, read from ?page= and ?per_page=. It is
+// embedded in list responses, which fill in Total.
+type pagination struct {
+	Page    int   `json:"page"`
+	PerPage int   `json:"per_page"`
+	Total   int64 `json:"total"`
+}
+
+// pageParams parses the page query parameters. Pages count from 1.
+func pageParams(r *http.Request) (pagination, error) {
+	page := pagination{Page: 1, PerPage: defaultPerPage}
+	query := r.URL.Query()
+	if value := query.Get("page"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return page, errors.New("page must be a positive number")
+		}
+		page.Page = n
+	}
+	if value := query.Get("per_page"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxPerPage {
+			return page, fmt.Errorf("per_page must be between 1 and %d", maxPerPage)
+		}
+		page.PerPage = n
+	}
+	return page, nil
+}
+
+func (p pagination) offset() int {
+	return (p.Page - 1) * p.PerPage
+}